@@ -4,7 +4,9 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func BenchmarkPut(b *testing.B) {
@@ -66,3 +68,36 @@ func BenchmarkPutBatch(b *testing.B) {
 		}
 	}
 }
+
+func BenchmarkPutParallelSyncAlways(b *testing.B) {
+	os.Remove("benchmark.db")
+	db, err := OpenWithConfig("benchmark.db", &Config{
+		FlushInterval:  time.Minute * 15,
+		MaxBufferBytes: 10 * 1024 * 1024,
+		WALSyncMode:    WALSyncAlways,
+	})
+	if err != nil {
+		b.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+	defer os.Remove("benchmark.db")
+
+	store, err := NewStore[TestUser](db, "users")
+	if err != nil {
+		b.Fatalf("Failed to create store: %v", err)
+	}
+
+	// Concurrent writers share WAL appends and syncs through group commit
+	var counter atomic.Int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			key := fmt.Sprintf("user_%d", counter.Add(1))
+			user := TestUser{UUID: key, Name: "John", Email: "john@example.com", Age: 30}
+			err := store.Put(context.Background(), user)
+			if err != nil {
+				b.Fatalf("Failed to put: %v", err)
+			}
+		}
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"slices"
 	"sort"
 	"sync"
+	"sync/atomic"
 
 	"github.com/vmihailenco/msgpack/v5"
 )
@@ -15,8 +16,13 @@ type bTree struct {
 	mutex           sync.RWMutex
 	dirty           bool
 	version         uint64
+	signature       string // describes how the indexed values are encoded, persisted with the tree
+	generation      uint64 // nodes of another generation are shared with clones and copied before changing them
 }
 
+// bTreeGenerations hands out the generations of trees, so a tree and its clones never share one
+var bTreeGenerations atomic.Uint64
+
 // bTreeItem represents a key-value pair for bulk operations
 type bTreeItem struct {
 	Key   string
@@ -28,6 +34,7 @@ type persistedBTree struct {
 	Version   uint64     `msgpack:"version"`
 	Branching int        `msgpack:"branching"`
 	Root      *bTreeNode `msgpack:"root"`
+	Signature string     `msgpack:"signature,omitempty"`
 }
 
 // newBTree creates a new B-tree index with the given branching factor
@@ -80,8 +87,8 @@ func (t *bTree) minKeys() int {
 }
 
 func (t *bTree) borrowFromLeft(parent *bTreeNode, childIndex int) {
-	node := parent.Children[childIndex]
-	leftSibling := parent.Children[childIndex-1]
+	node := parent.mutableChild(childIndex, t.generation)
+	leftSibling := parent.mutableChild(childIndex-1, t.generation)
 
 	// Move parent's separator key down to node
 	node.Keys = slices.Insert(node.Keys, 0, parent.Keys[childIndex-1])
@@ -104,8 +111,8 @@ func (t *bTree) borrowFromLeft(parent *bTreeNode, childIndex int) {
 }
 
 func (t *bTree) borrowFromRight(parent *bTreeNode, childIndex int) {
-	node := parent.Children[childIndex]
-	rightSibling := parent.Children[childIndex+1]
+	node := parent.mutableChild(childIndex, t.generation)
+	rightSibling := parent.mutableChild(childIndex+1, t.generation)
 
 	// Move parent's separator key down to node
 	node.Keys = slices.Insert(node.Keys, len(node.Keys), parent.Keys[childIndex])
@@ -127,8 +134,8 @@ func (t *bTree) borrowFromRight(parent *bTreeNode, childIndex int) {
 }
 
 func (t *bTree) mergeWithLeft(parent *bTreeNode, childIndex int) {
-	node := parent.Children[childIndex]
-	leftSibling := parent.Children[childIndex-1]
+	node := parent.mutableChild(childIndex, t.generation)
+	leftSibling := parent.mutableChild(childIndex-1, t.generation)
 
 	// Move parent's separator key down to left sibling
 	leftSibling.Keys = slices.Insert(leftSibling.Keys, len(leftSibling.Keys), parent.Keys[childIndex-1])
@@ -152,8 +159,8 @@ func (t *bTree) mergeWithLeft(parent *bTreeNode, childIndex int) {
 }
 
 func (t *bTree) mergeWithRight(parent *bTreeNode, childIndex int) {
-	node := parent.Children[childIndex]
-	rightSibling := parent.Children[childIndex+1]
+	node := parent.mutableChild(childIndex, t.generation)
+	rightSibling := parent.mutableChild(childIndex+1, t.generation)
 
 	// Move parent's separator key down to node
 	node.Keys = slices.Insert(node.Keys, len(node.Keys), parent.Keys[childIndex])
@@ -220,7 +227,8 @@ func (t *bTree) rebalance(parent *bTreeNode, childIndex int) {
 func (t *bTree) findPredecessor(node *bTreeNode) (string, []string) {
 	if node.IsLeaf {
 		last := len(node.Keys) - 1
-		return node.Keys[last], node.Values[last]
+		// The leaf may be shared with a clone, the record keys must not be changed through the new owner
+		return node.Keys[last], slices.Clone(node.Values[last])
 	}
 	return t.findPredecessor(node.Children[len(node.Children)-1])
 }
@@ -236,13 +244,13 @@ func (t *bTree) removeKeyFromSubtree(parent *bTreeNode, node *bTreeNode, index i
 			predKey, predValues := t.findPredecessor(node.Children[i])
 			node.Keys[i] = predKey
 			node.Values[i] = predValues
-			t.removeKeyFromSubtree(node, node.Children[i], i, predKey)
+			t.removeKeyFromSubtree(node, node.mutableChild(i, t.generation), i, predKey)
 			t.rebalance(node, i)
 		}
 		return
 	}
 	if !node.IsLeaf {
-		t.removeKeyFromSubtree(node, node.Children[i], i, key)
+		t.removeKeyFromSubtree(node, node.mutableChild(i, t.generation), i, key)
 	}
 }
 
@@ -263,17 +271,28 @@ func (t *bTree) deleteRecursive(parent *bTreeNode, node *bTreeNode, index int, k
 			}
 			t.rebalance(parent, index)
 		} else {
+			values := node.Values[i]
+			for j, v := range values {
+				if v == value {
+					node.Values[i] = append(values[:j], values[j+1:]...)
+					break
+				}
+			}
+			if len(node.Values[i]) > 0 {
+				// Other records still hold the value
+				return
+			}
 			// Internal node: replace with predecessor
 			predKey, predValues := t.findPredecessor(node.Children[i])
 			node.Keys[i] = predKey
 			node.Values[i] = predValues
-			t.removeKeyFromSubtree(node, node.Children[i], i, predKey)
+			t.removeKeyFromSubtree(node, node.mutableChild(i, t.generation), i, predKey)
 			t.rebalance(parent, index)
 		}
 		return
 	}
 	if !node.IsLeaf {
-		t.deleteRecursive(node, node.Children[i], i, key, value)
+		t.deleteRecursive(node, node.mutableChild(i, t.generation), i, key, value)
 	}
 	t.rebalance(parent, index)
 }
@@ -323,7 +342,7 @@ func (t *bTree) countUniqueValues() int {
 func (t *bTree) delete(indexValue string, recordKey string) {
 	t.mutex.Lock()
 	defer t.mutex.Unlock()
-	t.deleteRecursive(nil, t.Root, 0, indexValue, recordKey)
+	t.deleteRecursive(nil, t.mutableRoot(), 0, indexValue, recordKey)
 	// If root has no keys and has children, make the child the new root
 	if len(t.Root.Keys) == 0 && len(t.Root.Children) == 1 {
 		t.Root = t.Root.Children[0]
@@ -341,6 +360,84 @@ func (t *bTree) getAllKeys() []string {
 	return result
 }
 
+// walkValues calls fn with the record keys of each index value in order of the values,
+// or in reverse order if descending, until fn returns false.
+// fn must not modify the record keys or the tree.
+func (t *bTree) walkValues(descending bool, fn func(recordKeys []string) bool) {
+	t.walkRange("", "", true, true, descending, fn)
+}
+
+// walkRange calls fn with the record keys of each index value in the given range, in order of the values,
+// or in reverse order if descending, until fn returns false. An empty min or max leaves the range
+// unbounded on that side. Subtrees outside the range are skipped.
+// fn must not modify the record keys or the tree.
+func (t *bTree) walkRange(min string, max string, includeMin bool, includeMax bool, descending bool, fn func(recordKeys []string) bool) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	bounds := valueBounds{min: min, max: max, includeMin: includeMin, includeMax: includeMax}
+	t.walkRangeRecursive(t.Root, bounds, descending, fn)
+}
+
+// valueBounds is the range of index values a walk visits
+type valueBounds struct {
+	min, max               string
+	includeMin, includeMax bool
+}
+
+// belowMin reports whether the value is before the range
+func (b valueBounds) belowMin(value string) bool {
+	return b.min != "" && (value < b.min || (value == b.min && !b.includeMin))
+}
+
+// aboveMax reports whether the value is after the range
+func (b valueBounds) aboveMax(value string) bool {
+	return b.max != "" && (value > b.max || (value == b.max && !b.includeMax))
+}
+
+func (t *bTree) walkRangeRecursive(node *bTreeNode, bounds valueBounds, descending bool, fn func(recordKeys []string) bool) bool {
+	if node == nil {
+		return true
+	}
+	count := len(node.Keys)
+	for step := 0; step <= count; step++ {
+		child := step
+		if descending {
+			child = count - step
+		}
+		// The child holds the values between the keys around it
+		skip := (child < count && bounds.min != "" && node.Keys[child] <= bounds.min) ||
+			(child > 0 && bounds.max != "" && node.Keys[child-1] >= bounds.max)
+		if !node.IsLeaf && !skip && !t.walkRangeRecursive(node.Children[child], bounds, descending, fn) {
+			return false
+		}
+		if step == count {
+			break
+		}
+		value := step
+		if descending {
+			value = count - 1 - step
+		}
+		switch {
+		case bounds.belowMin(node.Keys[value]):
+			if descending {
+				// Every value left to walk is smaller
+				return false
+			}
+			continue
+		case bounds.aboveMax(node.Keys[value]):
+			if !descending {
+				// Every value left to walk is larger
+				return false
+			}
+			continue
+		}
+		if !fn(node.Values[value]) {
+			return false
+		}
+	}
+	return true
+}
+
 // insert adds a record key to the index under the given index value
 func (t *bTree) insert(indexValue string, recordKey string) {
 	t.mutex.Lock()
@@ -349,31 +446,60 @@ func (t *bTree) insert(indexValue string, recordKey string) {
 	if root.isFull(t.BranchingFactor) {
 		// Split root
 		newRoot := &bTreeNode{
-			Keys:     make([]string, 0),
-			Values:   make([][]string, 0),
-			Children: []*bTreeNode{root},
-			IsLeaf:   false,
+			Keys:       make([]string, 0),
+			Values:     make([][]string, 0),
+			Children:   []*bTreeNode{root},
+			IsLeaf:     false,
+			generation: t.generation,
 		}
-		newRoot.splitChild(t.BranchingFactor, 0)
+		newRoot.splitChild(t.BranchingFactor, 0, t.generation)
 		t.Root = newRoot
 	}
-	t.Root.insertNonFull(t.BranchingFactor, indexValue, recordKey)
+	t.mutableRoot().insertNonFull(t.BranchingFactor, indexValue, recordKey, t.generation)
 	t.dirty = true
 	t.version++
 }
 
 // rangeSearch finds all record keys for index values in the given range
 func (t *bTree) rangeSearch(min string, max string, includeMin bool, includeMax bool) []string {
+	return t.rangeSearchLimit(min, max, includeMin, includeMax, 0)
+}
+
+// rangeSearchLimit finds record keys for index values in the given range,
+// stopping after limit keys if limit is greater than 0
+func (t *bTree) rangeSearchLimit(min string, max string, includeMin bool, includeMax bool, limit int) []string {
 	t.mutex.RLock()
 	defer t.mutex.RUnlock()
 	it := newBTreeIterator(t, min, max, includeMin, includeMax)
 	var result []string
 	for it.hasNext() {
+		if limit > 0 && len(result) >= limit {
+			break
+		}
 		result = append(result, it.next())
 	}
 	return result
 }
 
+// prefixSearch finds record keys for index values starting with prefix,
+// stopping after limit keys if limit is greater than 0
+func (t *bTree) prefixSearch(prefix string, limit int) []string {
+	return t.rangeSearchLimit(prefix, prefixEnd(prefix), true, false, limit)
+}
+
+// prefixEnd returns the smallest string greater than every string starting with prefix,
+// or an empty string, meaning unbounded, if there is none
+func prefixEnd(prefix string) string {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return string(end[:i+1])
+		}
+	}
+	return ""
+}
+
 // bulkInsert inserts multiple key-value pairs efficiently
 func (t *bTree) bulkInsert(items []bTreeItem) {
 	t.mutex.Lock()
@@ -389,15 +515,16 @@ func (t *bTree) bulkInsert(items []bTreeItem) {
 		if root.isFull(t.BranchingFactor) {
 			// Split root
 			newRoot := &bTreeNode{
-				Keys:     make([]string, 0),
-				Values:   make([][]string, 0),
-				Children: []*bTreeNode{root},
-				IsLeaf:   false,
+				Keys:       make([]string, 0),
+				Values:     make([][]string, 0),
+				Children:   []*bTreeNode{root},
+				IsLeaf:     false,
+				generation: t.generation,
 			}
-			newRoot.splitChild(t.BranchingFactor, 0)
+			newRoot.splitChild(t.BranchingFactor, 0, t.generation)
 			t.Root = newRoot
 		}
-		t.Root.insertNonFull(t.BranchingFactor, item.Key, item.Value)
+		t.mutableRoot().insertNonFull(t.BranchingFactor, item.Key, item.Value, t.generation)
 	}
 	t.dirty = true
 	t.version++
@@ -414,7 +541,7 @@ func (t *bTree) bulkDelete(items []bTreeItem) {
 	})
 
 	for _, item := range items {
-		t.deleteRecursive(nil, t.Root, 0, item.Key, item.Value)
+		t.deleteRecursive(nil, t.mutableRoot(), 0, item.Key, item.Value)
 		// Handle root becoming empty
 		if len(t.Root.Keys) == 0 && len(t.Root.Children) == 1 {
 			t.Root = t.Root.Children[0]
@@ -440,7 +567,38 @@ func (t *bTree) bulkSearch(keys []string) map[string][]string {
 func (t *bTree) search(indexValue string) []string {
 	t.mutex.RLock()
 	defer t.mutex.RUnlock()
-	return t.searchRecursive(t.Root, indexValue)
+	recordKeys := t.searchRecursive(t.Root, indexValue)
+	if recordKeys == nil {
+		return nil
+	}
+	// Callers may reorder or append to the result, which must not change the tree
+	return append(make([]string, 0, len(recordKeys)), recordKeys...)
+}
+
+// clone returns a copy of the B-tree that is unaffected by later changes.
+// The copy shares all nodes with the tree, each tree copies a shared node the first time it changes it,
+// so cloning takes constant time and later changes copy only the nodes they touch.
+func (t *bTree) clone() *bTree {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.generation = bTreeGenerations.Add(1)
+	return &bTree{
+		Root:            t.Root,
+		BranchingFactor: t.BranchingFactor,
+		dirty:           t.dirty,
+		version:         t.version,
+		signature:       t.signature,
+		generation:      bTreeGenerations.Add(1),
+	}
+}
+
+// mutableRoot returns the root, first replacing it with a copy if it is shared with a clone.
+// The caller must hold the write lock.
+func (t *bTree) mutableRoot() *bTreeNode {
+	if t.Root.generation != t.generation {
+		t.Root = t.Root.copyFor(t.generation)
+	}
+	return t.Root
 }
 
 // serialize encodes the B-tree to msgpack bytes with versioning
@@ -452,6 +610,7 @@ func (t *bTree) serialize() ([]byte, error) {
 		Version:   t.version,
 		Branching: t.BranchingFactor,
 		Root:      t.Root,
+		Signature: t.signature,
 	}
 
 	data, err := msgpack.Marshal(pb)
@@ -474,6 +633,7 @@ func deserializeBTree(data []byte) (*bTree, error) {
 		Root:            pb.Root,
 		BranchingFactor: pb.Branching,
 		version:         pb.Version,
+		signature:       pb.Signature,
 		dirty:           false, // Loaded from disk, not dirty
 	}
 
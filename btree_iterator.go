@@ -5,6 +5,8 @@ import "sort"
 type iteratorNode struct {
 	node  *bTreeNode
 	index int
+	// visited is set once the key after child index of an internal node has been handled
+	visited bool
 }
 
 // bTreeIterator provides efficient iteration over B-tree range queries
@@ -87,8 +89,27 @@ func (it *bTreeIterator) advance() {
 			// Leaf exhausted, pop it
 			it.path = it.path[:len(it.path)-1]
 		} else {
-			// Internal node, move to next child
+			// Internal nodes hold keys too, visit the one between the finished child and the next
+			if !current.visited {
+				current.visited = true
+				if current.index < len(node.Keys) {
+					key := node.Keys[current.index]
+					if it.isKeyGreaterThanMax(key) {
+						it.finished = true
+						return
+					}
+					if it.isInRange(key) {
+						it.currentValues = node.Values[current.index]
+						it.valueIndex = 0
+						return
+					}
+				}
+				continue
+			}
+
+			// Move to next child
 			current.index++
+			current.visited = false
 			if current.index < len(node.Children) {
 				// Check for subtree pruning
 				if it.isSubtreeLessThanMin(node, current.index) {
@@ -8,10 +8,35 @@ import (
 
 // bTreeNode represents a node in the B-tree index
 type bTreeNode struct {
-	Keys     []string     // sorted indexed values (strings)
-	Values   [][]string   // for each key, list of record keys
-	Children []*bTreeNode // child nodes (len = len(Keys)+1 for internal nodes)
-	IsLeaf   bool
+	Keys       []string     // sorted indexed values (strings)
+	Values     [][]string   // for each key, list of record keys
+	Children   []*bTreeNode // child nodes (len = len(Keys)+1 for internal nodes)
+	IsLeaf     bool
+	generation uint64 // generation of the tree that owns the node, nodes of older generations are shared with clones
+}
+
+// copyFor returns a copy of the node owned by the given generation, sharing the children
+func (n *bTreeNode) copyFor(generation uint64) *bTreeNode {
+	copied := &bTreeNode{
+		Keys:       slices.Clone(n.Keys),
+		Values:     make([][]string, len(n.Values)),
+		Children:   slices.Clone(n.Children),
+		IsLeaf:     n.IsLeaf,
+		generation: generation,
+	}
+	for i, values := range n.Values {
+		copied.Values[i] = slices.Clone(values)
+	}
+	return copied
+}
+
+// mutableChild returns the child at index i, first replacing it with a copy if another generation owns it.
+// The node itself must be owned by the generation.
+func (n *bTreeNode) mutableChild(i int, generation uint64) *bTreeNode {
+	if n.Children[i].generation != generation {
+		n.Children[i] = n.Children[i].copyFor(generation)
+	}
+	return n.Children[i]
 }
 
 // isFull returns true if the node has reached maximum capacity
@@ -19,14 +44,15 @@ func (n *bTreeNode) isFull(t int) bool {
 	return len(n.Keys) >= 2*t-1
 }
 
-// splitChild splits a full child node
-func (n *bTreeNode) splitChild(aCount int, bCount int) {
-	aChildren := n.Children[bCount]
+// splitChild splits a full child node, the new node is owned by the generation
+func (n *bTreeNode) splitChild(aCount int, bCount int, generation uint64) {
+	aChildren := n.mutableChild(bCount, generation)
 	bChildren := &bTreeNode{
-		Keys:     make([]string, 0, 2*aCount-1),
-		Values:   make([][]string, 0, 2*aCount-1),
-		Children: make([]*bTreeNode, 0, 2*aCount),
-		IsLeaf:   aChildren.IsLeaf,
+		Keys:       make([]string, 0, 2*aCount-1),
+		Values:     make([][]string, 0, 2*aCount-1),
+		Children:   make([]*bTreeNode, 0, 2*aCount),
+		IsLeaf:     aChildren.IsLeaf,
+		generation: generation,
 	}
 
 	// Move t keys and values from y to z
@@ -52,8 +78,9 @@ func (n *bTreeNode) splitChild(aCount int, bCount int) {
 	aChildren.Values = aChildren.Values[:mid]
 }
 
-// insertNonFull inserts a key-value pair into a non-full node
-func (n *bTreeNode) insertNonFull(t int, key string, value string) {
+// insertNonFull inserts a key-value pair into a non-full node owned by the generation,
+// copying the nodes on the way down that another generation owns
+func (n *bTreeNode) insertNonFull(t int, key string, value string, generation uint64) {
 	if len(n.Keys) != len(n.Values) {
 		panic(fmt.Sprintf("BTree invariant violated: len(Keys)=%d, len(Values)=%d", len(n.Keys), len(n.Values)))
 	}
@@ -71,16 +98,24 @@ func (n *bTreeNode) insertNonFull(t int, key string, value string) {
 			n.Keys = slices.Insert(n.Keys, i, key)
 			n.Values = slices.Insert(n.Values, i, []string{value})
 		}
+	} else if i < len(n.Keys) && n.Keys[i] == key {
+		// Key exists in this internal node, append to its list
+		n.Values[i] = append(n.Values[i], value)
 	} else {
 		// Descend to child
 		child := n.Children[i]
 		if child.isFull(t) {
-			n.splitChild(t, i)
+			n.splitChild(t, i, generation)
+			if key == n.Keys[i] {
+				// The key moved up to this node
+				n.Values[i] = append(n.Values[i], value)
+				return
+			}
 			if key > n.Keys[i] {
 				i++
 			}
 		}
-		n.Children[i].insertNonFull(t, key, value)
+		n.mutableChild(i, generation).insertNonFull(t, key, value, generation)
 	}
 }
 
@@ -3,8 +3,10 @@ package nnut
 import (
 	"context"
 	"fmt"
+	"math/rand"
 	"path/filepath"
 	"reflect"
+	"sort"
 	"sync"
 	"testing"
 )
@@ -174,6 +176,215 @@ func TestBTreeIndex_RangeSearch(t *testing.T) {
 	}
 }
 
+func TestBTreeIndex_PrefixSearch(t *testing.T) {
+	bt := newBTree(4)
+
+	// Insert enough values to span several nodes
+	for i := 0; i < 50; i++ {
+		bt.insert(fmt.Sprintf("jo%02d", i), fmt.Sprintf("key%d", i))
+	}
+	bt.insert("j", "short")
+	bt.insert("jp", "after")
+	bt.insert("\xffa", "high")
+
+	keys := bt.prefixSearch("jo", 0)
+	if len(keys) != 50 {
+		t.Errorf("Expected 50 keys, got %d: %v", len(keys), keys)
+	}
+
+	keys = bt.prefixSearch("jo", 5)
+	expected := []string{"key0", "key1", "key2", "key3", "key4"}
+	if len(keys) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, keys)
+	}
+	for i, key := range expected {
+		if keys[i] != key {
+			t.Errorf("Expected %s at position %d, got %s", key, i, keys[i])
+		}
+	}
+
+	keys = bt.prefixSearch("\xff", 0)
+	if len(keys) != 1 || keys[0] != "high" {
+		t.Errorf("Expected [high], got %v", keys)
+	}
+
+	if end := prefixEnd("a\xff\xff"); end != "b" {
+		t.Errorf("Expected prefix end b, got %q", end)
+	}
+	if end := prefixEnd("\xff"); end != "" {
+		t.Errorf("Expected unbounded prefix end, got %q", end)
+	}
+}
+
+func TestBTreeIndex_WalkValues(t *testing.T) {
+	bt := newBTree(4)
+
+	// Insert enough values to span several nodes
+	var expected []string
+	for i := 0; i < 50; i++ {
+		bt.insert(fmt.Sprintf("v%02d", i), fmt.Sprintf("key%d", i))
+		expected = append(expected, fmt.Sprintf("key%d", i))
+	}
+	bt.insert("v10", "extra")
+	expected = append(expected[:11], append([]string{"extra"}, expected[11:]...)...)
+
+	var ascending []string
+	bt.walkValues(false, func(recordKeys []string) bool {
+		ascending = append(ascending, recordKeys...)
+		return true
+	})
+	if fmt.Sprint(ascending) != fmt.Sprint(expected) {
+		t.Errorf("Expected %v, got %v", expected, ascending)
+	}
+
+	var descending [][]string
+	bt.walkValues(true, func(recordKeys []string) bool {
+		descending = append(descending, recordKeys)
+		return len(descending) < 40
+	})
+	if len(descending) != 40 || descending[0][0] != "key49" || descending[39][0] != "key10" || len(descending[39]) != 2 {
+		t.Errorf("Expected 40 values from v49 down to v10, got %v", descending)
+	}
+}
+
+func TestBTreeIndex_WalkRange(t *testing.T) {
+	bt := newBTree(4)
+	for i := 0; i < 50; i++ {
+		bt.insert(fmt.Sprintf("v%02d", i), fmt.Sprintf("key%02d", i))
+	}
+
+	tests := []struct {
+		min, max               string
+		includeMin, includeMax bool
+	}{
+		{"v10", "v20", true, true},
+		{"v10", "v20", false, false},
+		{"", "v05", true, false},
+		{"v45", "", false, true},
+		{"v10a", "v11", true, true},
+		{"", "", true, true},
+	}
+	for _, test := range tests {
+		expected := bt.rangeSearch(test.min, test.max, test.includeMin, test.includeMax)
+		var ascending []string
+		bt.walkRange(test.min, test.max, test.includeMin, test.includeMax, false, func(recordKeys []string) bool {
+			ascending = append(ascending, recordKeys...)
+			return true
+		})
+		if fmt.Sprint(ascending) != fmt.Sprint(expected) {
+			t.Errorf("Range %+v: expected %v, got %v", test, expected, ascending)
+		}
+		var descending []string
+		bt.walkRange(test.min, test.max, test.includeMin, test.includeMax, true, func(recordKeys []string) bool {
+			descending = append([]string{recordKeys[0]}, descending...)
+			return true
+		})
+		if fmt.Sprint(descending) != fmt.Sprint(expected) {
+			t.Errorf("Range %+v descending: expected %v, got %v", test, expected, descending)
+		}
+	}
+
+	var visited []string
+	bt.walkRange("v30", "", true, true, false, func(recordKeys []string) bool {
+		visited = append(visited, recordKeys...)
+		return len(visited) < 3
+	})
+	if fmt.Sprint(visited) != "[key30 key31 key32]" {
+		t.Errorf("Expected the walk to stop after 3 values, got %v", visited)
+	}
+}
+
+func TestBTreeIndex_CloneCopyOnWrite(t *testing.T) {
+	bt := newBTree(2)
+	for i := 0; i < 200; i++ {
+		bt.insert(fmt.Sprintf("v%03d", i%50), fmt.Sprintf("key%03d", i))
+	}
+	before := bt.getAllKeys()
+
+	// Changes to the tree leave the clone as it was, and the other way round
+	cloned := bt.clone()
+	for i := 0; i < 200; i += 3 {
+		bt.delete(fmt.Sprintf("v%03d", i%50), fmt.Sprintf("key%03d", i))
+	}
+	for i := 200; i < 300; i++ {
+		bt.insert(fmt.Sprintf("v%03d", i%70), fmt.Sprintf("key%03d", i))
+	}
+	if after := cloned.getAllKeys(); fmt.Sprint(after) != fmt.Sprint(before) {
+		t.Fatalf("Expected the clone to be unchanged, got %d keys instead of %d", len(after), len(before))
+	}
+	changed := bt.getAllKeys()
+	for i := 0; i < 200; i += 2 {
+		cloned.delete(fmt.Sprintf("v%03d", i%50), fmt.Sprintf("key%03d", i))
+	}
+	cloned.insert("v999", "extra")
+	if after := bt.getAllKeys(); fmt.Sprint(after) != fmt.Sprint(changed) {
+		t.Fatalf("Expected the tree to be unaffected by changes to its clone")
+	}
+	if count := cloned.countKeys(); count != 101 {
+		t.Fatalf("Expected 101 keys in the clone, got %d", count)
+	}
+	if count := bt.countKeys(); count != 233 {
+		t.Fatalf("Expected 233 keys in the tree, got %d", count)
+	}
+
+	// Clones taken between random changes keep the contents of their time
+	random := rand.New(rand.NewSource(1))
+	tree := newBTree(2)
+	model := make(map[string]map[string]bool)
+	type checkpoint struct {
+		tree     *bTree
+		contents string
+	}
+	var checkpoints []checkpoint
+	contents := func(model map[string]map[string]bool) string {
+		var values []string
+		for _, keys := range model {
+			for key := range keys {
+				values = append(values, key)
+			}
+		}
+		sort.Strings(values)
+		return fmt.Sprint(values)
+	}
+	treeContents := func(tree *bTree) string {
+		var values []string
+		tree.walkValues(false, func(recordKeys []string) bool {
+			values = append(values, recordKeys...)
+			return true
+		})
+		sort.Strings(values)
+		return fmt.Sprint(values)
+	}
+	for step := 0; step < 3000; step++ {
+		value := fmt.Sprintf("v%02d", random.Intn(40))
+		key := fmt.Sprintf("%s=k%d", value, random.Intn(20))
+		if model[value][key] {
+			tree.delete(value, key)
+			delete(model[value], key)
+			if len(model[value]) == 0 {
+				delete(model, value)
+			}
+		} else {
+			tree.insert(value, key)
+			if model[value] == nil {
+				model[value] = make(map[string]bool)
+			}
+			model[value][key] = true
+		}
+		if step%250 == 0 {
+			checkpoints = append(checkpoints, checkpoint{tree: tree.clone(), contents: contents(model)})
+		}
+	}
+	if got := treeContents(tree); got != contents(model) {
+		t.Fatalf("Expected the tree to match the model")
+	}
+	for i, checkpoint := range checkpoints {
+		if got := treeContents(checkpoint.tree); got != checkpoint.contents {
+			t.Fatalf("Expected clone %d to keep its contents", i)
+		}
+	}
+}
+
 func TestBTreeIndex_BulkOperations(t *testing.T) {
 	bt := newBTree(4)
 
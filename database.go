@@ -8,6 +8,7 @@ import (
 	"log"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/vmihailenco/msgpack/v5"
@@ -20,7 +21,8 @@ type Config struct {
 	// Default is 15 minutes.
 	FlushInterval time.Duration
 
-	// WALPath is the file path for the Write-Ahead Log.
+	// WALPath is the base file path for the Write-Ahead Log.
+	// The WAL is written to numbered segment files named WALPath + "." + epoch.
 	// If empty, defaults to dbPath + ".wal".
 	WALPath string
 
@@ -40,8 +42,63 @@ type Config struct {
 	// BoltOptions contains bbolt-specific options that are passed to the underlying bbolt database.
 	// This allows full configuration control over bbolt's behavior including timeouts, sync options, etc.
 	BoltOptions *bbolt.Options
+
+	// WALSyncMode controls when writes to the WAL are synced to stable storage.
+	// Default is WALSyncNever, which leaves syncing to the operating system.
+	WALSyncMode WALSyncMode
+
+	// WALSyncInterval is how often the WAL is synced when WALSyncMode is WALSyncInterval.
+	// Default is 100 milliseconds.
+	WALSyncInterval time.Duration
+
+	// WALRecoveryMode controls how a damaged WAL is handled when the database is opened.
+	// Default is WALRecoverySalvage.
+	WALRecoveryMode WALRecoveryMode
+
+	// MaxBufferBytesHardLimit is the size of pending operations at which writes are no longer accepted
+	// until a flush drains the buffer. It must not be smaller than MaxBufferBytes.
+	// Default is 0, which leaves the buffer unbounded.
+	MaxBufferBytesHardLimit int
+
+	// BufferFullPolicy controls what a write does when the buffer has reached MaxBufferBytesHardLimit.
+	// Default is BufferFullBlock.
+	BufferFullPolicy BufferFullPolicy
 }
 
+// WALSyncMode determines the trade-off between durability and write throughput of the WAL.
+type WALSyncMode int
+
+const (
+	// WALSyncNever never syncs the WAL explicitly. Acknowledged writes can be lost on power failure.
+	WALSyncNever WALSyncMode = iota
+	// WALSyncAlways syncs the WAL before a write returns, so acknowledged writes survive power failure.
+	WALSyncAlways
+	// WALSyncInterval syncs the WAL in the background every WALSyncInterval.
+	// At most one interval of acknowledged writes can be lost on power failure.
+	WALSyncInterval
+)
+
+// WALRecoveryMode determines how replay handles a WAL segment with damaged entries.
+type WALRecoveryMode int
+
+const (
+	// WALRecoverySalvage replays every entry up to the first damaged one and moves the damaged tail
+	// to a ".corrupt" file next to the segment. The outcome is available from DB.RecoveryReport.
+	WALRecoverySalvage WALRecoveryMode = iota
+	// WALRecoveryStrict refuses to open the database when the WAL is damaged, leaving the WAL untouched.
+	WALRecoveryStrict
+)
+
+// BufferFullPolicy determines how writes behave while the operations buffer is at its hard limit.
+type BufferFullPolicy int
+
+const (
+	// BufferFullBlock makes writes wait until a flush frees enough space or their context is done.
+	BufferFullBlock BufferFullPolicy = iota
+	// BufferFullFail makes writes return a BufferFullError immediately.
+	BufferFullFail
+)
+
 // DB represents a database instance with WAL support.
 // It wraps bbolt.DB and adds Write-Ahead Logging for improved durability.
 type DB struct {
@@ -49,18 +106,32 @@ type DB struct {
 	config *Config
 	logger *bbolt.Logger
 
-	walFile               *os.File
+	walFile               *os.File // active segment of the current epoch
 	walMutex              sync.Mutex
+	walDirty              bool          // WAL has writes that have not been synced yet
+	currentEpoch          atomic.Uint64 // epoch of the active segment, only changed while holding walMutex
+	commitQueue           []*commitRequest
+	committing            bool // a writer is leading a group commit
+	commitMutex           sync.Mutex
+	nextTxID              atomic.Uint64
 	operationsBuffer      map[string]operation
+	flushingOperations    map[string]operation // operations being committed by Flush, still visible to readers
 	operationsBufferMutex sync.Mutex
-	bytesInBuffer         uint64
-	currentEpoch          uint64
-	currentEpochMutex     sync.Mutex
+	bytesInBuffer         uint64        // size of operationsBuffer
+	bytesFlushing         uint64        // size of flushingOperations
+	bytesReserved         uint64        // size of admitted operations not yet in operationsBuffer
+	bufferDrained         chan struct{} // closed and replaced whenever buffer space is freed
+	flushMutex            sync.Mutex
+	snapshotMutex         sync.RWMutex // held for writing while a snapshot is taken
+	uniqueMutex           sync.Mutex   // serializes checking and applying changes to unique indexes
+	flushError            error        // error of the most recent flush, nil when healthy
+	flushErrorMutex       sync.RWMutex
 
 	indexes      map[string]*bTree // indexKey -> BTree for serialization on flush
 	indexesMutex sync.RWMutex
 
 	indexesNeedRebuild map[string]bool // indexKey -> needs rebuild (set during WAL replay)
+	recoveryReport     RecoveryReport
 
 	flushChannel   chan struct{}
 	closeChannel   chan struct{}
@@ -73,6 +144,7 @@ const (
 	OperationPut OperationType = iota
 	OperationDelete
 	OperationIndex
+	OperationCommit // marks the end of a transaction's operations in the WAL
 )
 
 type operation struct {
@@ -81,6 +153,7 @@ type operation struct {
 	Value  []byte
 	Type   OperationType
 	Epoch  uint64
+	TxID   uint64 `msgpack:",omitempty"` // transaction the operation belongs to, 0 outside transactions
 }
 
 type walEntry struct {
@@ -88,6 +161,11 @@ type walEntry struct {
 	Checksum  uint32
 }
 
+const (
+	flushRetryBaseDelay = 100 * time.Millisecond
+	flushRetryMaxDelay  = 30 * time.Second
+)
+
 var (
 	discardLogger = &bbolt.DefaultLogger{Logger: log.New(io.Discard, "", 0)}
 )
@@ -121,6 +199,24 @@ func validateConfig(config *Config) error {
 	if config.FlushChannelSize < 0 {
 		return InvalidConfigError{Field: "FlushChannelSize", Value: config.FlushChannelSize, Reason: "cannot be negative"}
 	}
+	if config.WALSyncMode < WALSyncNever || config.WALSyncMode > WALSyncInterval {
+		return InvalidConfigError{Field: "WALSyncMode", Value: config.WALSyncMode, Reason: "unknown sync mode"}
+	}
+	if config.WALSyncInterval < 0 {
+		return InvalidConfigError{Field: "WALSyncInterval", Value: config.WALSyncInterval, Reason: "cannot be negative"}
+	}
+	if config.WALRecoveryMode < WALRecoverySalvage || config.WALRecoveryMode > WALRecoveryStrict {
+		return InvalidConfigError{Field: "WALRecoveryMode", Value: config.WALRecoveryMode, Reason: "unknown recovery mode"}
+	}
+	if config.MaxBufferBytesHardLimit < 0 {
+		return InvalidConfigError{Field: "MaxBufferBytesHardLimit", Value: config.MaxBufferBytesHardLimit, Reason: "cannot be negative"}
+	}
+	if config.MaxBufferBytesHardLimit > 0 && config.MaxBufferBytesHardLimit < config.MaxBufferBytes {
+		return InvalidConfigError{Field: "MaxBufferBytesHardLimit", Value: config.MaxBufferBytesHardLimit, Reason: "cannot be smaller than MaxBufferBytes"}
+	}
+	if config.BufferFullPolicy < BufferFullBlock || config.BufferFullPolicy > BufferFullFail {
+		return InvalidConfigError{Field: "BufferFullPolicy", Value: config.BufferFullPolicy, Reason: "unknown buffer full policy"}
+	}
 	return nil
 }
 
@@ -136,6 +232,9 @@ func OpenWithConfig(path string, config *Config) (*DB, error) {
 	if config != nil && config.FlushChannelSize == 0 {
 		config.FlushChannelSize = 10
 	}
+	if config != nil && config.WALSyncInterval == 0 {
+		config.WALSyncInterval = 100 * time.Millisecond
+	}
 
 	if err := validateConfig(config); err != nil {
 		return nil, err
@@ -175,7 +274,7 @@ func OpenWithConfig(path string, config *Config) (*DB, error) {
 		config:             config,
 		logger:             &logger,
 		operationsBuffer:   make(map[string]operation),
-		currentEpoch:       1,
+		bufferDrained:      make(chan struct{}),
 		indexes:            make(map[string]*bTree),
 		indexesNeedRebuild: make(map[string]bool),
 		flushChannel:       make(chan struct{}, config.FlushChannelSize),
@@ -190,17 +289,27 @@ func OpenWithConfig(path string, config *Config) (*DB, error) {
 		database.Close()
 		return nil, err
 	}
-	databaseInstance.Logger().Info("Successfully replayed WAL from path: %s", config.WALPath)
+	report := databaseInstance.RecoveryReport()
+	if report.Corrupted() {
+		databaseInstance.Logger().Warningf("Recovered WAL from path %s with damage: %d entries applied, %d bytes discarded at offset %d of %s, quarantined to %s",
+			config.WALPath, report.EntriesApplied, report.BytesDiscarded, report.FirstBadOffset, report.CorruptSegment, report.QuarantinePath)
+	} else {
+		databaseInstance.Logger().Info("Successfully replayed WAL from path: %s", config.WALPath)
+	}
 
-	// Prepare WAL file for logging new operations to enable crash recovery
-	databaseInstance.walFile, err = os.OpenFile(config.WALPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	// Prepare WAL segment for logging new operations to enable crash recovery
+	err = databaseInstance.openWALSegment(databaseInstance.currentEpoch.Load())
 	if err != nil {
 		database.Close()
-		return nil, FileSystemError{Path: config.WALPath, Operation: "create", Err: err}
+		return nil, err
 	}
 
 	databaseInstance.closeWaitGroup.Add(1)
 	go databaseInstance.flushWAL()
+	if config.WALSyncMode == WALSyncInterval {
+		databaseInstance.closeWaitGroup.Add(1)
+		go databaseInstance.syncWAL()
+	}
 	return databaseInstance, nil
 }
 
@@ -209,6 +318,10 @@ func (db *DB) getLatestBufferedOperation(bucket []byte, key string) (operation,
 	db.operationsBufferMutex.Lock()
 	defer db.operationsBufferMutex.Unlock()
 	op, exists := db.operationsBuffer[bufferKey(bucket, key)]
+	if !exists {
+		// Operations being flushed are not in bbolt until the flush commits
+		op, exists = db.flushingOperations[bufferKey(bucket, key)]
+	}
 	return op, exists
 }
 
@@ -217,6 +330,14 @@ func (db *DB) getBufferedOperationsForBucket(bucket []byte) []operation {
 	db.operationsBufferMutex.Lock()
 	defer db.operationsBufferMutex.Unlock()
 	var operations []operation
+	for key, operation := range db.flushingOperations {
+		if _, superseded := db.operationsBuffer[key]; superseded {
+			continue
+		}
+		if bytes.Equal(operation.Bucket, bucket) {
+			operations = append(operations, operation)
+		}
+	}
 	for _, operation := range db.operationsBuffer {
 		if bytes.Equal(operation.Bucket, bucket) {
 			operations = append(operations, operation)
@@ -232,131 +353,112 @@ func (db *DB) Logger() bbolt.Logger {
 	return *db.logger
 }
 
-func (db *DB) replayWAL() error {
-	file, err := os.Open(db.config.WALPath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			// No WAL, ok
-			return nil
-		}
-		return FileSystemError{Path: db.config.WALPath, Operation: "open", Err: err}
-	}
-	defer file.Close()
-
-	decoder := msgpack.GetDecoder()
-	defer msgpack.PutDecoder(decoder)
-	decoder.Reset(file)
-	operationIndex := 0
-	for {
-		var entry walEntry
-		err := decoder.Decode(&entry)
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			// Corrupted WAL file cannot be trusted, discard to avoid applying invalid operations
-			os.Remove(db.config.WALPath)
-			// Don't return error, as DB is consistent without WAL
-			break
-		}
-
-		// Verify checksum
-		var operationBuffer bytes.Buffer
-		operationEncoder := msgpack.NewEncoder(&operationBuffer)
-		err = operationEncoder.Encode(entry.Operation)
-		if err != nil {
-			db.Logger().Errorf("Error re-encoding operation for checksum: %v", err)
-			os.Remove(db.config.WALPath)
-			break
-		}
-		encodedOp := operationBuffer.Bytes()
-		computedChecksum := crc32.ChecksumIEEE(encodedOp)
-		if computedChecksum != entry.Checksum {
-			db.Logger().Errorf("WAL checksum mismatch at operation %d", operationIndex)
-			os.Remove(db.config.WALPath)
-			break
-		}
-
-		operation := entry.Operation
-
-		// Mark indexes as needing rebuild if dirty marker found
-		if operation.Type == OperationIndex {
-			db.indexesNeedRebuild[operation.Key] = true
-		}
-
-		// Reapply data operations to restore database state
-		if operation.Type == OperationPut || operation.Type == OperationDelete {
-			err = db.Update(func(transaction *bbolt.Tx) error {
-				bucket, err := transaction.CreateBucketIfNotExists(operation.Bucket)
-				if err != nil {
-					return WALReplayError{WALPath: db.config.WALPath, OperationIndex: operationIndex, Err: err}
-				}
-				if operation.Type == OperationPut {
-					err = bucket.Put([]byte(operation.Key), operation.Value)
-					if err != nil {
-						return WALReplayError{WALPath: db.config.WALPath, OperationIndex: operationIndex, Err: err}
-					}
-				} else if operation.Type == OperationDelete {
-					err = bucket.Delete([]byte(operation.Key))
-					if err != nil {
-						return WALReplayError{WALPath: db.config.WALPath, OperationIndex: operationIndex, Err: err}
-					}
-				}
-
-				return nil
-			})
-			if err != nil {
-				return WrappedError{Operation: "replay_wal", Err: err}
-			}
-		}
-		operationIndex++
-	}
-
-	// WAL is no longer needed after successful replay
-	os.Remove(db.config.WALPath)
-
-	return nil
-}
-
 func (db *DB) flushWAL() {
 	defer db.closeWaitGroup.Done()
 	ticker := time.NewTicker(db.config.FlushInterval)
 	defer ticker.Stop()
+
+	// Failed flushes are retried with backoff instead of waiting for the next interval
+	var retry <-chan time.Time
+	failures := 0
+	flush := func() {
+		if err := db.Flush(); err != nil {
+			failures++
+			delay := flushRetryDelay(failures, db.config.FlushInterval)
+			db.Logger().Warningf("Retrying flush in %v after %d failures", delay, failures)
+			retry = time.After(delay)
+			return
+		}
+		failures = 0
+		retry = nil
+	}
+
 	for {
 		select {
 		case <-ticker.C:
-			db.Flush()
+			flush()
 		case <-db.flushChannel:
-			db.Flush()
+			flush()
 			ticker.Reset(db.config.FlushInterval)
+		case <-retry:
+			flush()
 		case <-db.closeChannel:
 			return
 		}
 	}
 }
 
+// flushRetryDelay returns the exponential backoff delay after the given number of consecutive failures
+func flushRetryDelay(failures int, flushInterval time.Duration) time.Duration {
+	maxDelay := min(flushRetryMaxDelay, flushInterval)
+	delay := flushRetryBaseDelay
+	for i := 1; i < failures && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxDelay)
+}
+
+// Degraded returns true if the most recent flush failed.
+// While degraded, pending operations are kept in memory and in the WAL, and flushing is retried with backoff.
+func (db *DB) Degraded() bool {
+	return db.FlushErr() != nil
+}
+
+// FlushErr returns the error of the most recent flush, or nil if it succeeded.
+func (db *DB) FlushErr() error {
+	db.flushErrorMutex.RLock()
+	defer db.flushErrorMutex.RUnlock()
+	return db.flushError
+}
+
+// setFlushError records the outcome of a flush for Degraded and FlushErr
+func (db *DB) setFlushError(err error) {
+	db.flushErrorMutex.Lock()
+	db.flushError = err
+	db.flushErrorMutex.Unlock()
+}
+
 // Flush forces an immediate flush of the WAL buffer to disk.
 // This ensures all pending operations are persisted to the database.
-func (db *DB) Flush() {
+// If the flush fails the operations remain buffered and a FlushError is returned.
+func (db *DB) Flush() error {
+	// Flushes must commit in epoch order, otherwise removing segments could drop uncommitted operations
+	db.flushMutex.Lock()
+	defer db.flushMutex.Unlock()
+
+	db.walMutex.Lock()
 	db.operationsBufferMutex.Lock()
-	db.currentEpochMutex.Lock()
+	if len(db.operationsBuffer) == 0 {
+		db.operationsBufferMutex.Unlock()
+		db.walMutex.Unlock()
+		return nil
+	}
+
+	// Rotate to a new segment so writes arriving during the flush outlive its cleanup
+	committedEpoch := db.currentEpoch.Load()
+	if err := db.openWALSegment(committedEpoch + 1); err != nil {
+		flushError := FlushError{OperationCount: len(db.operationsBuffer), Err: err}
+		db.operationsBufferMutex.Unlock()
+		db.walMutex.Unlock()
+		db.Logger().Errorf("Flush error: %v", flushError)
+		db.setFlushError(flushError)
+		return flushError
+	}
+
 	operations := make([]operation, 0, len(db.operationsBuffer))
 	for _, operation := range db.operationsBuffer {
-		operation.Epoch = db.currentEpoch
 		operations = append(operations, operation)
 	}
+	db.flushingOperations = db.operationsBuffer
 	db.operationsBuffer = make(map[string]operation)
+	db.bytesFlushing = db.bytesInBuffer
 	db.bytesInBuffer = 0
 	db.operationsBufferMutex.Unlock()
-	db.currentEpochMutex.Unlock()
-
-	if len(operations) == 0 {
-		return
-	}
+	db.walMutex.Unlock()
 
 	db.Logger().Infof("Flushing %d operations to database", len(operations))
 
-	err := db.Update(func(transaction *bbolt.Tx) error {
+	err := db.DB.Update(func(transaction *bbolt.Tx) error {
 		for _, operation := range operations {
 			bucket, err := transaction.CreateBucketIfNotExists(operation.Bucket)
 			if err != nil {
@@ -392,114 +494,49 @@ func (db *DB) Flush() {
 		return nil
 	})
 	if err != nil {
-		db.Logger().Errorf("Flush error: %v", FlushError{OperationCount: len(operations), Err: err})
-		return
+		flushError := FlushError{OperationCount: len(operations), Err: err}
+		db.Logger().Errorf("Flush error: %v", flushError)
+		db.requeueFlushingOperations()
+		db.setFlushError(flushError)
+		return flushError
 	}
 
+	db.operationsBufferMutex.Lock()
+	db.flushingOperations = nil
+	db.bytesFlushing = 0
+	db.notifyBufferDrainedLocked()
+	db.operationsBufferMutex.Unlock()
+	db.setFlushError(nil)
+
 	db.Logger().Infof("Successfully flushed %d operations to database", len(operations))
 
-	// Truncate WAL after successful flush
-	db.currentEpochMutex.Lock()
-	committedEpoch := db.currentEpoch
-	db.currentEpoch++
-	db.currentEpochMutex.Unlock()
-	db.truncateWAL(committedEpoch)
+	// Segments of committed epochs are no longer needed for recovery
+	db.removeWALSegments(committedEpoch)
+	return nil
 }
 
-func (db *DB) truncateWAL(committedEpoch uint64) {
-	db.walMutex.Lock()
-	defer db.walMutex.Unlock()
-
-	// Close WAL file
-	if err := db.walFile.Close(); err != nil {
-		db.Logger().Errorf("Error closing WAL for truncation: %v", err)
-		return
-	}
-
-	// Read entire WAL
-	data, err := os.ReadFile(db.config.WALPath)
-	if err != nil {
-		db.Logger().Errorf("Error reading WAL for truncation: %v", err)
-		// Reopen WAL
-		db.walFile, err = os.OpenFile(db.config.WALPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
-		if err != nil {
-			db.Logger().Errorf("Error reopening WAL: %v", err)
-		}
-		return
-	}
-
-	// Decode and filter operations
-	var remainingOperations []operation
-	decoder := msgpack.GetDecoder()
-	defer msgpack.PutDecoder(decoder)
-	decoder.Reset(bytes.NewReader(data))
-	for {
-		var entry walEntry
-		err := decoder.Decode(&entry)
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			db.Logger().Errorf("Error decoding WAL entry: %v", err)
-			// On decode error, keep all remaining data
-			break
-		}
-		// Verify checksum
-		var operationBuffer bytes.Buffer
-		operationEncoder := msgpack.NewEncoder(&operationBuffer)
-		err = operationEncoder.Encode(entry.Operation)
-		if err != nil {
-			db.Logger().Errorf("Error re-encoding operation for checksum: %v", err)
-			continue
-		}
-		encodedOperation := operationBuffer.Bytes()
-		computedChecksum := crc32.ChecksumIEEE(encodedOperation)
-		if computedChecksum != entry.Checksum {
-			db.Logger().Errorf("WAL checksum mismatch during truncation")
+// requeueFlushingOperations returns the operations of a failed flush to the buffer.
+// Operations written to the same keys since the flush started are newer and take precedence.
+func (db *DB) requeueFlushingOperations() {
+	db.operationsBufferMutex.Lock()
+	defer db.operationsBufferMutex.Unlock()
+	for key, operation := range db.flushingOperations {
+		if _, superseded := db.operationsBuffer[key]; superseded {
 			continue
 		}
-		if entry.Operation.Epoch > committedEpoch {
-			remainingOperations = append(remainingOperations, entry.Operation)
-		}
-	}
-
-	// Encode remaining operations
-	var buffer bytes.Buffer
-	encoder := msgpack.NewEncoder(&buffer)
-	for _, operation := range remainingOperations {
-		if err := encoder.Encode(operation); err != nil {
-			db.Logger().Errorf("Error encoding remaining operation: %v", err)
-			// On error, don't truncate
-			db.walFile, err = os.OpenFile(db.config.WALPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
-			if err != nil {
-				db.Logger().Errorf("Error reopening WAL: %v", err)
-			}
-			return
-		}
-	}
-
-	// Write back to WAL
-	err = os.WriteFile(db.config.WALPath, buffer.Bytes(), 0644)
-	if err != nil {
-		db.Logger().Errorf("Error writing truncated WAL: %v", err)
-		// Reopen
-		db.walFile, err = os.OpenFile(db.config.WALPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
-		if err != nil {
-			db.Logger().Errorf("Error reopening WAL: %v", err)
-		}
-		return
-	}
-
-	// Reopen WAL for append
-	db.walFile, err = os.OpenFile(db.config.WALPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
-	if err != nil {
-		db.Logger().Errorf("Error reopening WAL after truncation: %v", err)
+		db.operationsBuffer[key] = operation
+		db.bytesInBuffer += operationSize(operation)
 	}
+	db.flushingOperations = nil
+	db.bytesFlushing = 0
+	db.notifyBufferDrainedLocked()
 }
 
-// Close flushes any data from the WAL to the database and closes the database
+// Close flushes any data from the WAL to the database and closes the database.
+// If the final flush fails the database is still closed, the pending operations stay
+// in the WAL to be replayed on the next open, and the FlushError is returned.
 func (db *DB) Close() error {
-	db.Flush()
+	flushErr := db.Flush()
 
 	// Close channels to stop background goroutines (only if not already closed)
 	select {
@@ -510,8 +547,23 @@ func (db *DB) Close() error {
 	}
 	db.closeWaitGroup.Wait()
 
+	// Persist anything still pending in the WAL before releasing it
+	db.walMutex.Lock()
+	if err := db.syncWALFileLocked(); err != nil {
+		db.Logger().Errorf("WAL sync error: %v", err)
+	}
+	db.walFile.Close()
+	// An empty segment holds nothing to recover
+	if info, err := os.Stat(db.walFile.Name()); err == nil && info.Size() == 0 {
+		os.Remove(db.walFile.Name())
+	}
+	db.walMutex.Unlock()
+
 	// Close the underlying bolt database
-	return db.DB.Close()
+	if err := db.DB.Close(); err != nil {
+		return err
+	}
+	return flushErr
 }
 
 // Export creates a backup of the database to the specified destination path.
@@ -524,7 +576,9 @@ func (db *DB) Export(destinationPath string) error {
 	}
 
 	// Flush all pending operations to ensure DB is up-to-date
-	db.Flush()
+	if err := db.Flush(); err != nil {
+		return err
+	}
 
 	// Create destination file for DB backup
 	destinationFile, err := os.Create(destinationPath)
@@ -551,45 +605,200 @@ func bufferKey(bucket []byte, key string) string {
 	return string(bucket) + "\x00" + key
 }
 
-// writeOperations adds multiple operations to WAL and buffer atomically
+// commitRequest is a set of operations waiting to be appended to the WAL by a group commit
+type commitRequest struct {
+	operations []operation
+	epoch      uint64 // epoch the operations were encoded for
+	walBytes   []byte
+	reserved   uint64 // buffer space admitted for the operations
+	done       chan error
+	lead       chan struct{} // signalled when the request is handed the lead of the next group commit
+}
+
+// writeOperations adds multiple operations to WAL and buffer atomically.
+// Concurrent callers are coalesced into a single WAL append and sync, each caller
+// returns once its own operations are as durable as the sync mode promises.
 func (db *DB) writeOperations(ctx context.Context, operations []operation) error {
-	if len(operations) == 0 {
-		return nil
+	request, err := db.prepareWrite(ctx, operations)
+	if err != nil {
+		return err
 	}
+	return db.submitWrite(request)
+}
 
-	db.currentEpochMutex.Lock()
-	currentEpoch := db.currentEpoch
-	db.currentEpochMutex.Unlock()
-	for i := range operations {
-		operations[i].Epoch = currentEpoch
+// prepareWrite encodes the operations and reserves buffer space for them, waiting for a flush
+// when the buffer is full. The returned request must be passed to submitWrite, or its space given
+// back with releaseBufferSpace. A nil request means there is nothing to write.
+func (db *DB) prepareWrite(ctx context.Context, operations []operation) (*commitRequest, error) {
+	if len(operations) == 0 {
+		return nil, nil
 	}
 
 	select {
 	case <-ctx.Done():
-		return ctx.Err()
+		return nil, ctx.Err()
 	default:
 	}
 
+	// Encode before queueing so the group commit only has to append
+	request := &commitRequest{
+		operations: operations,
+		epoch:      db.currentEpoch.Load(),
+		done:       make(chan error, 1),
+		lead:       make(chan struct{}, 1),
+	}
+	for i := range operations {
+		operations[i].Epoch = request.epoch
+	}
+	walBytes, err := encodeWALEntries(operations)
+	if err != nil {
+		return nil, err
+	}
+	request.walBytes = walBytes
+
+	// Wait for buffer space before the operations reach the WAL
+	for _, operation := range operations {
+		request.reserved += operationSize(operation)
+	}
+	if err := db.reserveBufferSpace(ctx, request.reserved); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// submitWrite hands a prepared request to the group commit and waits for it to be committed
+func (db *DB) submitWrite(request *commitRequest) error {
+	if request == nil {
+		return nil
+	}
+
+	// The first caller to find no commit in progress leads, the others wait to be committed
+	// by it or to be handed the lead of the next group
+	db.commitMutex.Lock()
+	db.commitQueue = append(db.commitQueue, request)
+	if db.committing {
+		db.commitMutex.Unlock()
+		select {
+		case err := <-request.done:
+			return err
+		case <-request.lead:
+		}
+	} else {
+		db.committing = true
+		db.commitMutex.Unlock()
+	}
+
+	db.leadCommit()
+	return <-request.done
+}
+
+// leadCommit commits the queued requests as one group, then hands the lead to the first
+// request queued in the meantime, so the leader returns as soon as its own group is durable
+func (db *DB) leadCommit() {
+	db.commitMutex.Lock()
+	requests := db.commitQueue
+	db.commitQueue = nil
+	db.commitMutex.Unlock()
+
+	if len(requests) > 0 {
+		db.commitGroup(requests)
+	}
+
+	db.commitMutex.Lock()
+	defer db.commitMutex.Unlock()
+	if len(db.commitQueue) == 0 {
+		db.committing = false
+		return
+	}
+	db.commitQueue[0].lead <- struct{}{}
+}
+
+// commitGroup appends the operations of all requests to the WAL in one write and adds them to the buffer
+func (db *DB) commitGroup(requests []*commitRequest) {
+	err := db.appendGroup(requests)
+	if err != nil {
+		// Nothing was added to the buffer, give back the space admitted for the group
+		for _, request := range requests {
+			db.releaseBufferSpace(request.reserved)
+		}
+	}
+	for _, request := range requests {
+		request.done <- err
+	}
+}
+
+// appendGroup writes a group of requests to the WAL and the buffer
+func (db *DB) appendGroup(requests []*commitRequest) error {
+	// Hold the WAL for the whole write so a flush cannot rotate the segment in between
+	db.walMutex.Lock()
+	defer db.walMutex.Unlock()
+	epoch := db.currentEpoch.Load()
+
+	var walBuffer bytes.Buffer
+	for _, request := range requests {
+		// A flush rotated the segment since encoding, the operations belong to the new epoch
+		if request.epoch != epoch {
+			for i := range request.operations {
+				request.operations[i].Epoch = epoch
+			}
+			walBytes, err := encodeWALEntries(request.operations)
+			if err != nil {
+				return err
+			}
+			request.epoch = epoch
+			request.walBytes = walBytes
+		}
+		walBuffer.Write(request.walBytes)
+	}
+
+	// Write batch to WAL file
+	_, err := db.walFile.Write(walBuffer.Bytes())
+	if err != nil {
+		return FileSystemError{Path: db.walFile.Name(), Operation: "write_batch", Err: err}
+	}
+	db.walDirty = true
+
+	// Only report success once the batch is durable when requested
+	if db.config.WALSyncMode == WALSyncAlways {
+		if err := db.syncWALFileLocked(); err != nil {
+			return err
+		}
+	}
+
 	// Add to buffer with deduplication (preserve full data)
 	db.operationsBufferMutex.Lock()
-	bufferBytes := uint64(0)
-	for _, operation := range operations {
-		key := bufferKey(operation.Bucket, operation.Key)
-		db.operationsBuffer[key] = operation
-		bufferBytes += uint64(len(operation.Value))
+	bufferedBefore := db.bufferedBytesLocked()
+	for _, request := range requests {
+		for _, operation := range request.operations {
+			// Commit markers only matter to WAL replay
+			if operation.Type == OperationCommit {
+				continue
+			}
+			key := bufferKey(operation.Bucket, operation.Key)
+			if replaced, exists := db.operationsBuffer[key]; exists {
+				db.bytesInBuffer -= operationSize(replaced)
+			}
+			db.operationsBuffer[key] = operation
+			db.bytesInBuffer += operationSize(operation)
+		}
+		db.bytesReserved -= request.reserved
+	}
+	// Replacing buffered operations can take less space than was admitted
+	if db.bufferedBytesLocked() < bufferedBefore {
+		db.notifyBufferDrainedLocked()
 	}
-	db.bytesInBuffer += bufferBytes
 	shouldFlush := db.bytesInBuffer >= uint64(db.config.MaxBufferBytes)
 	db.operationsBufferMutex.Unlock()
 
 	if shouldFlush {
-		select {
-		case db.flushChannel <- struct{}{}:
-		default:
-		}
+		db.triggerFlush()
 	}
 
-	// Encode all entries for WAL
+	return nil
+}
+
+// encodeWALEntries encodes operations into checksummed WAL entries
+func encodeWALEntries(operations []operation) ([]byte, error) {
 	var walBuffer bytes.Buffer
 	walEncoder := msgpack.NewEncoder(&walBuffer)
 	for _, operation := range operations {
@@ -604,7 +813,7 @@ func (db *DB) writeOperations(ctx context.Context, operations []operation) error
 		operationEncoder := msgpack.NewEncoder(&operationBuffer)
 		err := operationEncoder.Encode(walOperation)
 		if err != nil {
-			return WrappedError{Operation: "encode operation batch", Err: err}
+			return nil, WrappedError{Operation: "encode operation batch", Err: err}
 		}
 		encodedOperator := operationBuffer.Bytes()
 
@@ -617,18 +826,8 @@ func (db *DB) writeOperations(ctx context.Context, operations []operation) error
 		// Encode entry
 		err = walEncoder.Encode(entry)
 		if err != nil {
-			return WrappedError{Operation: "encode WAL entry batch", Err: err}
+			return nil, WrappedError{Operation: "encode WAL entry batch", Err: err}
 		}
 	}
-	walBytes := walBuffer.Bytes()
-
-	// Write batch to WAL file
-	db.walMutex.Lock()
-	_, err := db.walFile.Write(walBytes)
-	db.walMutex.Unlock()
-	if err != nil {
-		return FileSystemError{Path: db.config.WALPath, Operation: "write_batch", Err: err}
-	}
-
-	return nil
+	return walBuffer.Bytes(), nil
 }
@@ -0,0 +1,73 @@
+package nnut
+
+import (
+	"context"
+)
+
+// operationSize returns the number of bytes an operation occupies in the buffer
+func operationSize(operation operation) uint64 {
+	return uint64(len(operation.Bucket) + len(operation.Key) + len(operation.Value))
+}
+
+// bufferedBytesLocked returns the size of all pending operations, the caller must hold operationsBufferMutex
+func (db *DB) bufferedBytesLocked() uint64 {
+	return db.bytesInBuffer + db.bytesFlushing + db.bytesReserved
+}
+
+// reserveBufferSpace admits size bytes of operations into the buffer.
+// Once the hard limit is reached it blocks until a flush frees space or fails fast, depending on BufferFullPolicy.
+// A write is always admitted into an empty buffer so operations larger than the limit cannot stall forever.
+func (db *DB) reserveBufferSpace(ctx context.Context, size uint64) error {
+	limit := uint64(db.config.MaxBufferBytesHardLimit)
+
+	db.operationsBufferMutex.Lock()
+	for limit > 0 {
+		buffered := db.bufferedBytesLocked()
+		if buffered == 0 || buffered+size <= limit {
+			break
+		}
+		if db.config.BufferFullPolicy == BufferFullFail {
+			db.operationsBufferMutex.Unlock()
+			db.triggerFlush()
+			return BufferFullError{BufferedBytes: buffered, RequestedBytes: size, LimitBytes: limit}
+		}
+		drained := db.bufferDrained
+		db.operationsBufferMutex.Unlock()
+
+		db.Logger().Debugf("Buffer full with %d bytes, waiting to write %d bytes", buffered, size)
+		db.triggerFlush()
+		select {
+		case <-drained:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-db.closeChannel:
+			return BufferFullError{BufferedBytes: buffered, RequestedBytes: size, LimitBytes: limit}
+		}
+		db.operationsBufferMutex.Lock()
+	}
+	db.bytesReserved += size
+	db.operationsBufferMutex.Unlock()
+	return nil
+}
+
+// releaseBufferSpace gives back buffer space reserved for operations that will not be buffered
+func (db *DB) releaseBufferSpace(size uint64) {
+	db.operationsBufferMutex.Lock()
+	defer db.operationsBufferMutex.Unlock()
+	db.bytesReserved -= size
+	db.notifyBufferDrainedLocked()
+}
+
+// notifyBufferDrainedLocked wakes writers waiting for buffer space, the caller must hold operationsBufferMutex
+func (db *DB) notifyBufferDrainedLocked() {
+	close(db.bufferDrained)
+	db.bufferDrained = make(chan struct{})
+}
+
+// triggerFlush asks the background flusher to flush without waiting for it
+func (db *DB) triggerFlush() {
+	select {
+	case db.flushChannel <- struct{}{}:
+	default:
+	}
+}
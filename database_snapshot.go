@@ -0,0 +1,121 @@
+package nnut
+
+import (
+	"sync"
+
+	"go.etcd.io/bbolt"
+)
+
+// Snapshot is a consistent read-only view of the database at the time it was taken.
+// It pins a bbolt read transaction together with a copy of the pending operations and indexes,
+// so reads through it are unaffected by later writes and flushes.
+// Indexes are copied on write: taking a snapshot costs one copy of the pending operations,
+// and while it is held each write copies the index nodes it changes the first time.
+// A Snapshot must be released with Release, a long lived snapshot keeps bbolt from reusing pages.
+// While a snapshot is open a flush that needs to grow the bbolt memory map waits for its release,
+// so set BoltOptions.InitialMmapSize when flushing while holding a snapshot.
+type Snapshot struct {
+	database    *DB
+	transaction *bbolt.Tx
+	operations  map[string]operation // bufferKey -> pending operation at the time of the snapshot
+	indexes     map[string]*bTree    // indexKey -> copy of the index at the time of the snapshot
+	mutex       sync.RWMutex         // held for reading while the read transaction is in use
+	released    bool
+}
+
+// Snapshot takes a consistent read-only view of the database.
+// Use Store.WithSnapshot to read from it and Release it when done.
+func (db *DB) Snapshot() (*Snapshot, error) {
+	// Wait for writers to finish applying index changes and buffering their operations
+	db.snapshotMutex.Lock()
+	defer db.snapshotMutex.Unlock()
+
+	// Without a flush in progress bbolt holds exactly the state the pending operations build on
+	db.flushMutex.Lock()
+	defer db.flushMutex.Unlock()
+
+	transaction, err := db.DB.Begin(false)
+	if err != nil {
+		return nil, WrappedError{Operation: "snapshot", Err: err}
+	}
+
+	db.operationsBufferMutex.Lock()
+	operations := make(map[string]operation, len(db.flushingOperations)+len(db.operationsBuffer))
+	for key, operation := range db.flushingOperations {
+		operations[key] = operation
+	}
+	for key, operation := range db.operationsBuffer {
+		operations[key] = operation
+	}
+	db.operationsBufferMutex.Unlock()
+
+	db.indexesMutex.RLock()
+	indexes := make(map[string]*bTree, len(db.indexes))
+	for indexKey, index := range db.indexes {
+		indexes[indexKey] = index.clone()
+	}
+	db.indexesMutex.RUnlock()
+
+	db.Logger().Debugf("Took snapshot with %d pending operations and %d indexes", len(operations), len(indexes))
+	return &Snapshot{
+		database:    db,
+		transaction: transaction,
+		operations:  operations,
+		indexes:     indexes,
+	}, nil
+}
+
+// Release ends the snapshot and frees its read transaction.
+// Reads through the snapshot fail with a SnapshotReleasedError afterwards. Releasing twice is a no-op.
+func (s *Snapshot) Release() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.released {
+		return nil
+	}
+	s.released = true
+	s.operations = nil
+	s.indexes = nil
+	if err := s.transaction.Rollback(); err != nil {
+		return WrappedError{Operation: "release_snapshot", Err: err}
+	}
+	return nil
+}
+
+// view runs fn with the snapshot's read transaction
+func (s *Snapshot) view(fn func(transaction *bbolt.Tx) error) error {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.released {
+		return SnapshotReleasedError{}
+	}
+	return fn(s.transaction)
+}
+
+// bufferedOperation returns the operation pending for a key when the snapshot was taken
+func (s *Snapshot) bufferedOperation(bucket []byte, key string) (operation, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	operation, exists := s.operations[bufferKey(bucket, key)]
+	return operation, exists
+}
+
+// bufferedOperationsForBucket returns all operations pending for a bucket when the snapshot was taken
+func (s *Snapshot) bufferedOperationsForBucket(bucket []byte) []operation {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	var operations []operation
+	for _, operation := range s.operations {
+		if string(operation.Bucket) == string(bucket) {
+			operations = append(operations, operation)
+		}
+	}
+	return operations
+}
+
+// beginWrite keeps snapshots from being taken until the returned function is called,
+// so index changes and the operations they belong to are always captured together
+func (db *DB) beginWrite() func() {
+	db.snapshotMutex.RLock()
+	return db.snapshotMutex.RUnlock
+}
@@ -0,0 +1,208 @@
+package nnut
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+func TestSnapshotIsolation(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	db, err := OpenWithConfig(dbPath, &Config{
+		FlushInterval:  time.Hour,
+		MaxBufferBytes: 1000000,
+		// Flushing below must not need to remap while the snapshot is open
+		BoltOptions: &bbolt.Options{InitialMmapSize: 1 << 20},
+	})
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	users, err := NewStore[TestUser](db, "users")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	ctx := context.Background()
+
+	// One record in bbolt and one pending in the buffer
+	if err := users.Put(ctx, TestUser{UUID: "user1", Name: "John"}); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	if err := users.Put(ctx, TestUser{UUID: "user2", Name: "Jane"}); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+
+	snapshot, err := db.Snapshot()
+	if err != nil {
+		t.Fatalf("Failed to take snapshot: %v", err)
+	}
+	defer snapshot.Release()
+	view := users.WithSnapshot(snapshot)
+
+	// Later writes and flushes must not leak into the snapshot
+	if err := users.Put(ctx, TestUser{UUID: "user1", Name: "Johnny"}); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if err := users.Delete(ctx, "user2"); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	if err := users.Put(ctx, TestUser{UUID: "user3", Name: "Bob"}); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+
+	user1, err := view.Get(ctx, "user1")
+	if err != nil || user1.Name != "John" {
+		t.Fatalf("Expected snapshot to see John, got %v (%v)", user1, err)
+	}
+	if _, err := view.Get(ctx, "user2"); err != nil {
+		t.Fatalf("Expected snapshot to see buffered user2: %v", err)
+	}
+	if _, err := view.Get(ctx, "user3"); err == nil {
+		t.Fatal("Expected snapshot not to see user3")
+	}
+	if has, _ := view.Has(ctx, "user3"); has {
+		t.Fatal("Expected snapshot not to have user3")
+	}
+	batch, err := view.GetBatch(ctx, []string{"user1", "user2", "user3"})
+	if err != nil || len(batch) != 2 || batch["user1"].Name != "John" {
+		t.Fatalf("Expected snapshot batch of user1 and user2, got %v (%v)", batch, err)
+	}
+	if count, err := view.Count(ctx); err != nil || count != 2 {
+		t.Fatalf("Expected snapshot count 2, got %d (%v)", count, err)
+	}
+	results, err := view.GetQuery(ctx, &Query{})
+	if err != nil || len(results) != 2 {
+		t.Fatalf("Expected snapshot query to return 2 records, got %v (%v)", results, err)
+	}
+	for _, result := range results {
+		if result.UUID == "user1" && result.Name != "John" {
+			t.Fatalf("Expected snapshot query to see John, got %v", result)
+		}
+	}
+	if count, err := view.CountQuery(ctx, &Query{Conditions: []Condition{{Field: "Name", Value: "John"}}}); err != nil || count != 1 {
+		t.Fatalf("Expected snapshot to find John, got %d (%v)", count, err)
+	}
+	if count, err := view.CountQuery(ctx, &Query{Conditions: []Condition{{Field: "Name", Value: "Johnny"}}}); err != nil || count != 0 {
+		t.Fatalf("Expected snapshot not to find Johnny, got %d (%v)", count, err)
+	}
+
+	// The live store sees the latest state
+	if count, err := users.Count(ctx); err != nil || count != 2 {
+		t.Fatalf("Expected live count 2, got %d (%v)", count, err)
+	}
+	if user1, err := users.Get(ctx, "user1"); err != nil || user1.Name != "Johnny" {
+		t.Fatalf("Expected live store to see Johnny, got %v (%v)", user1, err)
+	}
+}
+
+func TestSnapshotReadOnly(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	users, err := NewStore[TestUser](db, "users")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	ctx := context.Background()
+	if err := users.Put(ctx, TestUser{UUID: "user1", Name: "John"}); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+
+	snapshot, err := db.Snapshot()
+	if err != nil {
+		t.Fatalf("Failed to take snapshot: %v", err)
+	}
+	defer snapshot.Release()
+	view := users.WithSnapshot(snapshot)
+
+	user := TestUser{UUID: "user2", Name: "Jane"}
+	writes := map[string]error{
+		"Put":         view.Put(ctx, user),
+		"Insert":      view.Insert(ctx, user),
+		"PutBatch":    view.PutBatch(ctx, []TestUser{user}),
+		"Update":      view.Update(ctx, "user1", func(value *TestUser) error { return nil }),
+		"Delete":      view.Delete(ctx, "user1"),
+		"DeleteBatch": view.DeleteBatch(ctx, []string{"user1"}),
+	}
+	_, writes["DeleteQuery"] = view.DeleteQuery(ctx, &Query{})
+	for name, err := range writes {
+		if !errors.As(err, &ReadOnlyStoreError{}) {
+			t.Errorf("Expected ReadOnlyStoreError from %s, got %v", name, err)
+		}
+	}
+
+	if _, err := users.Get(ctx, "user1"); err != nil {
+		t.Fatalf("Expected rejected delete to leave user1 in place: %v", err)
+	}
+	if has, _ := users.Has(ctx, "user2"); has {
+		t.Fatal("Expected rejected put to leave user2 absent")
+	}
+}
+
+func TestSnapshotRelease(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	users, err := NewStore[TestUser](db, "users")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	ctx := context.Background()
+	if err := users.Put(ctx, TestUser{UUID: "user1", Name: "John"}); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+
+	snapshot, err := db.Snapshot()
+	if err != nil {
+		t.Fatalf("Failed to take snapshot: %v", err)
+	}
+	view := users.WithSnapshot(snapshot)
+	if err := snapshot.Release(); err != nil {
+		t.Fatalf("Failed to release snapshot: %v", err)
+	}
+	if err := snapshot.Release(); err != nil {
+		t.Fatalf("Expected second release to be a no-op: %v", err)
+	}
+
+	if _, err := view.Get(ctx, "user1"); !errors.As(err, &SnapshotReleasedError{}) {
+		t.Fatalf("Expected SnapshotReleasedError, got %v", err)
+	}
+
+	// A released snapshot no longer holds back flushes that grow the file
+	values := make([]TestUser, 1000)
+	for i := range values {
+		values[i] = TestUser{UUID: fmt.Sprintf("user%d", i+2), Name: "Jane", Email: "jane@example.com"}
+	}
+	if err := users.PutBatch(ctx, values); err != nil {
+		t.Fatalf("Failed to put batch: %v", err)
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+}
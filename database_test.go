@@ -153,7 +153,7 @@ func TestWALIndexMarkerSerialization(t *testing.T) {
 	}
 
 	// Read WAL and verify OpIndexDirty has no Value
-	walFile, err := os.Open(db.config.WALPath)
+	walFile, err := os.Open(db.walFile.Name())
 	if err != nil {
 		t.Fatalf("Failed to open WAL: %v", err)
 	}
@@ -0,0 +1,180 @@
+package nnut
+
+import (
+	"context"
+	"sort"
+)
+
+// Tx collects writes to one or more stores so they are committed or discarded together.
+// A Tx is only valid inside the function passed to DB.Update.
+type Tx struct {
+	database *DB
+	ctx      context.Context
+	plans    []txPlan             // writes in the order they were made
+	writes   map[string]operation // bufferKey -> latest data operation, for reads within the transaction
+	closed   bool
+}
+
+// txPlan is a write made in a transaction. It is planned again on commit, against the records
+// as they are then, so writes made outside the transaction in the meantime are not undone in the indexes.
+type txPlan struct {
+	store  keyLocker
+	bucket string
+	key    string
+	plan   func() (operation, []indexChange, []string, error)
+}
+
+// keyLocker locks the keys of a store so no other write to them can interleave
+type keyLocker interface {
+	lockKeys(keys []string) func()
+}
+
+// Update runs fn in a transaction spanning any number of stores.
+// The writes made through the Tx are applied atomically when fn returns nil, and discarded
+// when fn returns an error or panics. Index changes only become visible on commit.
+// The underlying bbolt update is still available as db.DB.Update.
+func (db *DB) Update(ctx context.Context, fn func(tx *Tx) error) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+
+	tx := &Tx{
+		database: db,
+		ctx:      ctx,
+		writes:   make(map[string]operation),
+	}
+	defer func() {
+		tx.closed = true
+	}()
+
+	if err := fn(tx); err != nil {
+		db.Logger().Debugf("Rolling back transaction with %d operations: %v", len(tx.plans), err)
+		return err
+	}
+	return tx.commit()
+}
+
+// add records a write and the operation it planned for reads within the transaction
+func (tx *Tx) add(operation operation, plan txPlan) error {
+	if tx.closed {
+		return TxClosedError{}
+	}
+	tx.plans = append(tx.plans, plan)
+	tx.writes[bufferKey(operation.Bucket, operation.Key)] = operation
+	return nil
+}
+
+// bufferedOperation returns the latest write to a key made in the transaction
+func (tx *Tx) bufferedOperation(bucket []byte, key string) (operation, bool) {
+	operation, exists := tx.writes[bufferKey(bucket, key)]
+	return operation, exists
+}
+
+// commit writes the transaction to the WAL as one group terminated by a commit marker
+func (tx *Tx) commit() error {
+	if len(tx.plans) == 0 {
+		tx.closed = true
+		return nil
+	}
+
+	// Hold every written key until the transaction is buffered, and plan the writes again
+	// against the records as they are now
+	unlock := tx.lockKeys()
+	defer unlock()
+	tx.writes = make(map[string]operation)
+	operations := make([]operation, 0, len(tx.plans)+1)
+	var indexChanges []indexChange
+	modifiedIndexes := make(map[string]bool)
+	for _, plan := range tx.plans {
+		dataOperation, changes, modified, err := plan.plan()
+		if err != nil {
+			tx.closed = true
+			return err
+		}
+		tx.writes[bufferKey(dataOperation.Bucket, dataOperation.Key)] = dataOperation
+		operations = append(operations, dataOperation)
+		indexChanges = append(indexChanges, changes...)
+		for _, indexKey := range modified {
+			modifiedIndexes[indexKey] = true
+		}
+	}
+	tx.closed = true
+
+	txID := tx.database.nextTxID.Add(1)
+	indexKeys := make([]string, 0, len(modifiedIndexes))
+	for indexKey := range modifiedIndexes {
+		indexKeys = append(indexKeys, indexKey)
+	}
+	operations = append(operations, indexMarkers(indexKeys)...)
+	for i := range operations {
+		operations[i].TxID = txID
+	}
+	operations = append(operations, operation{Type: OperationCommit, TxID: txID})
+
+	tx.database.Logger().Debugf("Committing transaction %d with %d operations", txID, len(tx.plans))
+	return tx.database.writeWithIndexChanges(tx.ctx, operations, indexChanges)
+}
+
+// lockKeys locks the keys written in the transaction and returns the function that unlocks them.
+// Stores are locked in the order of their buckets so concurrent commits cannot deadlock.
+func (tx *Tx) lockKeys() func() {
+	var firstWrites []txPlan // the first write through each store
+	keys := make(map[keyLocker][]string)
+	for _, plan := range tx.plans {
+		if _, seen := keys[plan.store]; !seen {
+			firstWrites = append(firstWrites, plan)
+		}
+		keys[plan.store] = append(keys[plan.store], plan.key)
+	}
+	sort.SliceStable(firstWrites, func(i, j int) bool {
+		return firstWrites[i].bucket < firstWrites[j].bucket
+	})
+
+	unlocks := make([]func(), 0, len(firstWrites))
+	for _, plan := range firstWrites {
+		unlocks = append(unlocks, plan.store.lockKeys(keys[plan.store]))
+	}
+	return func() {
+		for i := len(unlocks) - 1; i >= 0; i-- {
+			unlocks[i]()
+		}
+	}
+}
+
+// writeWithIndexChanges applies index changes and writes the operations.
+// Buffer space is reserved before the indexes change, so a write that waits for or is refused buffer space
+// never shows in the indexes. If the write fails the index changes are reverted so the indexes keep matching the data.
+func (db *DB) writeWithIndexChanges(ctx context.Context, operations []operation, indexChanges []indexChange) error {
+	request, err := db.prepareWrite(ctx, operations)
+	if err != nil {
+		return err
+	}
+
+	endWrite := db.beginWrite()
+	defer endWrite()
+
+	if hasUniqueChanges(indexChanges) {
+		// No other write may claim a unique value between the check and applying the changes
+		db.uniqueMutex.Lock()
+		defer db.uniqueMutex.Unlock()
+		if err := checkUniqueChanges(indexChanges); err != nil {
+			if request != nil {
+				db.releaseBufferSpace(request.reserved)
+			}
+			return err
+		}
+	}
+
+	for _, change := range indexChanges {
+		change.apply()
+	}
+	if err := db.submitWrite(request); err != nil {
+		for i := len(indexChanges) - 1; i >= 0; i-- {
+			indexChanges[i].revert()
+		}
+		return err
+	}
+	return nil
+}
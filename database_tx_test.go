@@ -0,0 +1,336 @@
+package nnut
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestOrder for testing transactions across stores
+type TestOrder struct {
+	ID     string `nnut:"key"`
+	UserID string `nnut:"index"`
+	Item   string
+}
+
+func TestTxCommitAcrossStores(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	users, err := NewStore[TestUser](db, "users")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	orders, err := NewStore[TestOrder](db, "orders")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	user := TestUser{UUID: "user1", Name: "John", Email: "john@example.com", Age: 30}
+	order := TestOrder{ID: "order1", UserID: "user1", Item: "Book"}
+	err = db.Update(context.Background(), func(tx *Tx) error {
+		if err := users.PutTx(tx, user); err != nil {
+			return err
+		}
+		if err := orders.PutTx(tx, order); err != nil {
+			return err
+		}
+		// Index changes stay invisible until commit
+		if users.indexes[primaryKeyIndexName].search("user1") != nil {
+			t.Error("Expected primary key index to be unchanged before commit")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to commit transaction: %v", err)
+	}
+
+	retrievedUser, err := users.Get(context.Background(), "user1")
+	if err != nil || retrievedUser != user {
+		t.Fatalf("Expected committed user %v, got %v (%v)", user, retrievedUser, err)
+	}
+	retrievedOrder, err := orders.Get(context.Background(), "order1")
+	if err != nil || retrievedOrder != order {
+		t.Fatalf("Expected committed order %v, got %v (%v)", order, retrievedOrder, err)
+	}
+	if keys := orders.indexes["UserID"].search("user1"); len(keys) != 1 || keys[0] != "order1" {
+		t.Fatalf("Expected order in UserID index, got %v", keys)
+	}
+
+	// Commit markers are never buffered
+	db.operationsBufferMutex.Lock()
+	for _, operation := range db.operationsBuffer {
+		if operation.Type == OperationCommit {
+			t.Error("Commit marker should not be buffered")
+		}
+	}
+	db.operationsBufferMutex.Unlock()
+}
+
+func TestTxRollback(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	users, err := NewStore[TestUser](db, "users")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	err = users.Put(context.Background(), TestUser{UUID: "user1", Name: "John"})
+	if err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+
+	failure := errors.New("abort")
+	err = db.Update(context.Background(), func(tx *Tx) error {
+		if err := users.PutTx(tx, TestUser{UUID: "user2", Name: "Jane"}); err != nil {
+			return err
+		}
+		if err := users.DeleteTx(tx, "user1"); err != nil {
+			return err
+		}
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("Expected rollback error, got %v", err)
+	}
+
+	if _, err := users.Get(context.Background(), "user2"); err == nil {
+		t.Fatal("Expected rolled back put to be discarded")
+	}
+	if _, err := users.Get(context.Background(), "user1"); err != nil {
+		t.Fatalf("Expected rolled back delete to be discarded: %v", err)
+	}
+	if keys := users.indexes["Name"].search("Jane"); len(keys) != 0 {
+		t.Fatalf("Expected Name index to be unchanged, got %v", keys)
+	}
+}
+
+func TestTxReadsOwnWrites(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	users, err := NewStore[TestUser](db, "users")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	err = db.Update(context.Background(), func(tx *Tx) error {
+		if err := users.PutTx(tx, TestUser{UUID: "user1", Name: "John"}); err != nil {
+			return err
+		}
+		if err := users.PutTx(tx, TestUser{UUID: "user1", Name: "Johnny"}); err != nil {
+			return err
+		}
+		retrieved, err := users.GetTx(tx, "user1")
+		if err != nil {
+			return err
+		}
+		if retrieved.Name != "Johnny" {
+			t.Errorf("Expected transaction to see its latest write, got %v", retrieved)
+		}
+		if err := users.PutTx(tx, TestUser{UUID: "user2", Name: "Jane"}); err != nil {
+			return err
+		}
+		if err := users.DeleteTx(tx, "user2"); err != nil {
+			return err
+		}
+		if _, err := users.GetTx(tx, "user2"); err == nil {
+			t.Error("Expected deleted record to be invisible in the transaction")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to commit transaction: %v", err)
+	}
+
+	// Indexes only reflect the final state of each record
+	if keys := users.indexes["Name"].search("John"); len(keys) != 0 {
+		t.Fatalf("Expected overwritten name to be removed from index, got %v", keys)
+	}
+	if keys := users.indexes["Name"].search("Johnny"); len(keys) != 1 {
+		t.Fatalf("Expected final name in index, got %v", keys)
+	}
+	if users.indexes[primaryKeyIndexName].search("user2") != nil {
+		t.Fatal("Expected deleted record to be absent from primary key index")
+	}
+}
+
+func TestTxCommitAfterConcurrentWrite(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	users, err := NewStore[TestUser](db, "users")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	ctx := context.Background()
+	if err := users.Put(ctx, TestUser{UUID: "user1", Name: "v1"}); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if err := users.Put(ctx, TestUser{UUID: "user2", Name: "v1"}); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+
+	// Writes outside the transaction land between its writes and its commit
+	err = db.Update(ctx, func(tx *Tx) error {
+		if err := users.PutTx(tx, TestUser{UUID: "user1", Name: "v2"}); err != nil {
+			return err
+		}
+		if err := users.DeleteTx(tx, "user2"); err != nil {
+			return err
+		}
+		if err := users.Put(ctx, TestUser{UUID: "user1", Name: "v3"}); err != nil {
+			return err
+		}
+		return users.Put(ctx, TestUser{UUID: "user2", Name: "v3"})
+	})
+	if err != nil {
+		t.Fatalf("Failed to commit transaction: %v", err)
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+
+	// The commit replaces the records as they were when it was applied
+	results, err := users.GetQuery(ctx, &Query{Conditions: []Condition{{Field: "Name", Value: "v2"}}})
+	if err != nil || len(results) != 1 || results[0].UUID != "user1" || results[0].Name != "v2" {
+		t.Fatalf("Expected user1 named v2, got %v (%v)", results, err)
+	}
+	for _, name := range []string{"v1", "v3"} {
+		if keys := users.indexes["Name"].search(name); len(keys) != 0 {
+			t.Fatalf("Expected no index entries for %s, got %v", name, keys)
+		}
+	}
+	if count := users.indexes[primaryKeyIndexName].countKeys(); count != 1 {
+		t.Fatalf("Expected a single record, got %d", count)
+	}
+}
+
+func TestTxClosed(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	users, err := NewStore[TestUser](db, "users")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	var leaked *Tx
+	err = db.Update(context.Background(), func(tx *Tx) error {
+		leaked = tx
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to commit transaction: %v", err)
+	}
+	err = users.PutTx(leaked, TestUser{UUID: "user1", Name: "John"})
+	if !errors.As(err, &TxClosedError{}) {
+		t.Fatalf("Expected TxClosedError, got %v", err)
+	}
+}
+
+func TestTxReplaySkipsIncompleteTransaction(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	config := &Config{
+		FlushInterval:  time.Hour,
+		MaxBufferBytes: 1000000,
+	}
+	db, err := OpenWithConfig(dbPath, config)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+
+	users, err := NewStore[TestUser](db, "users")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	orders, err := NewStore[TestOrder](db, "orders")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	// A complete transaction followed by one torn before its commit marker
+	commit := func(userKey, orderKey string) {
+		err := db.Update(context.Background(), func(tx *Tx) error {
+			if err := users.PutTx(tx, TestUser{UUID: userKey, Name: "John"}); err != nil {
+				return err
+			}
+			return orders.PutTx(tx, TestOrder{ID: orderKey, UserID: userKey})
+		})
+		if err != nil {
+			t.Fatalf("Failed to commit transaction: %v", err)
+		}
+	}
+	commit("user1", "order1")
+	commit("user2", "order2")
+
+	marker, err := encodeWALEntries([]operation{{Type: OperationCommit, Epoch: db.currentEpoch.Load(), TxID: db.nextTxID.Load()}})
+	if err != nil {
+		t.Fatalf("Failed to encode commit marker: %v", err)
+	}
+	segmentPath := db.walFile.Name()
+	crashDB(db)
+	info, err := os.Stat(segmentPath)
+	if err != nil {
+		t.Fatalf("Failed to stat WAL segment: %v", err)
+	}
+	if err := os.Truncate(segmentPath, info.Size()-int64(len(marker))); err != nil {
+		t.Fatalf("Failed to truncate WAL segment: %v", err)
+	}
+
+	db2, err := OpenWithConfig(dbPath, config)
+	if err != nil {
+		t.Fatalf("Failed to reopen DB: %v", err)
+	}
+	defer db2.Close()
+	users2, err := NewStore[TestUser](db2, "users")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	orders2, err := NewStore[TestOrder](db2, "orders")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	if _, err := users2.Get(context.Background(), "user1"); err != nil {
+		t.Fatalf("Expected complete transaction to be replayed: %v", err)
+	}
+	if _, err := orders2.Get(context.Background(), "order1"); err != nil {
+		t.Fatalf("Expected complete transaction to be replayed: %v", err)
+	}
+	if _, err := users2.Get(context.Background(), "user2"); err == nil {
+		t.Fatal("Expected incomplete transaction to be skipped")
+	}
+	if _, err := orders2.Get(context.Background(), "order2"); err == nil {
+		t.Fatal("Expected incomplete transaction to be skipped")
+	}
+}
@@ -0,0 +1,359 @@
+package nnut
+
+import (
+	"bytes"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"go.etcd.io/bbolt"
+)
+
+// walSegment is a WAL file holding the operations written during a single epoch
+type walSegment struct {
+	Path  string
+	Epoch uint64
+}
+
+// walSegmentPath returns the path of the WAL segment for the given epoch
+func (db *DB) walSegmentPath(epoch uint64) string {
+	// Zero padding keeps the lexical order of segment files equal to their epoch order
+	return fmt.Sprintf("%s.%020d", db.config.WALPath, epoch)
+}
+
+// listWALSegments returns the WAL segments on disk ordered by epoch
+func (db *DB) listWALSegments() ([]walSegment, error) {
+	directory := filepath.Dir(db.config.WALPath)
+	prefix := filepath.Base(db.config.WALPath) + "."
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, FileSystemError{Path: directory, Operation: "list", Err: err}
+	}
+
+	var segments []walSegment
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		epoch, err := strconv.ParseUint(name[len(prefix):], 10, 64)
+		if err != nil {
+			// Not a segment, skip unrelated files sharing the prefix
+			continue
+		}
+		segments = append(segments, walSegment{Path: filepath.Join(directory, name), Epoch: epoch})
+	}
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].Epoch < segments[j].Epoch
+	})
+	return segments, nil
+}
+
+// openWALSegment makes the segment for the given epoch the active WAL file.
+// The caller must hold walMutex.
+func (db *DB) openWALSegment(epoch uint64) error {
+	path := db.walSegmentPath(epoch)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return FileSystemError{Path: path, Operation: "create", Err: err}
+	}
+
+	// The directory entry of a new segment only survives a power loss once the directory is synced
+	if db.config.WALSyncMode != WALSyncNever {
+		if err := syncDirectory(filepath.Dir(path)); err != nil {
+			file.Close()
+			os.Remove(path)
+			return err
+		}
+	}
+
+	if db.walFile != nil {
+		// Keep the previous segment as durable as the sync mode promises before letting go of it
+		if db.config.WALSyncMode != WALSyncNever {
+			if err := db.syncWALFileLocked(); err != nil {
+				file.Close()
+				os.Remove(path)
+				return err
+			}
+		}
+		db.walFile.Close()
+	}
+
+	db.walFile = file
+	db.walDirty = false
+	db.currentEpoch.Store(epoch)
+	return nil
+}
+
+// removeWALSegments deletes the segments of all epochs up to and including the committed epoch
+func (db *DB) removeWALSegments(committedEpoch uint64) {
+	segments, err := db.listWALSegments()
+	if err != nil {
+		db.Logger().Errorf("Error listing WAL segments: %v", err)
+		return
+	}
+	for _, segment := range segments {
+		if segment.Epoch > committedEpoch {
+			break
+		}
+		if err := os.Remove(segment.Path); err != nil && !os.IsNotExist(err) {
+			db.Logger().Errorf("Error removing WAL segment %s: %v", segment.Path, err)
+		}
+	}
+	// A removed segment reappearing after a power loss would replay operations older than the database
+	if db.config.WALSyncMode != WALSyncNever {
+		if err := syncDirectory(filepath.Dir(db.config.WALPath)); err != nil {
+			db.Logger().Errorf("Error syncing WAL directory: %v", err)
+		}
+	}
+}
+
+// syncDirectory syncs a directory so the files created in or removed from it are durable
+func syncDirectory(path string) error {
+	directory, err := os.Open(path)
+	if err != nil {
+		return FileSystemError{Path: path, Operation: "open", Err: err}
+	}
+	defer directory.Close()
+	if err := directory.Sync(); err != nil {
+		return FileSystemError{Path: path, Operation: "sync", Err: err}
+	}
+	return nil
+}
+
+// RecoveryReport describes what replaying the WAL recovered when the database was opened.
+type RecoveryReport struct {
+	SegmentsReplayed int    // number of WAL segments found and replayed
+	EntriesApplied   int    // number of valid WAL entries reapplied
+	BytesDiscarded   int64  // number of bytes after the last valid entry that could not be replayed
+	FirstBadOffset   int64  // offset of the first damaged entry within CorruptSegment, -1 if none
+	CorruptSegment   string // path of the segment containing the first damaged entry
+	QuarantinePath   string // path the damaged tail of CorruptSegment was moved to
+}
+
+// Corrupted returns true if part of the WAL was damaged and could not be replayed.
+func (r RecoveryReport) Corrupted() bool {
+	return r.FirstBadOffset >= 0
+}
+
+// replayWAL reapplies the operations of all WAL segments left behind by a previous session
+func (db *DB) replayWAL() error {
+	db.recoveryReport = RecoveryReport{FirstBadOffset: -1}
+	var paths []string
+
+	// A WAL written before segmentation predates every segment
+	if _, err := os.Stat(db.config.WALPath); err == nil {
+		paths = append(paths, db.config.WALPath)
+	}
+
+	segments, err := db.listWALSegments()
+	if err != nil {
+		return err
+	}
+	lastEpoch := uint64(0)
+	for _, segment := range segments {
+		paths = append(paths, segment.Path)
+		lastEpoch = segment.Epoch
+	}
+
+	for _, path := range paths {
+		if err := db.replayWALSegment(path); err != nil {
+			return err
+		}
+		db.recoveryReport.SegmentsReplayed++
+	}
+
+	// WAL is no longer needed after successful replay
+	for _, path := range paths {
+		os.Remove(path)
+	}
+
+	// Continue after the last epoch so new segments never collide with leftovers
+	db.currentEpoch.Store(lastEpoch + 1)
+
+	return nil
+}
+
+// replayWALSegment reapplies the valid prefix of a single WAL segment.
+// A damaged tail is quarantined or reported depending on the recovery mode.
+func (db *DB) replayWALSegment(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// No WAL, ok
+			return nil
+		}
+		return FileSystemError{Path: path, Operation: "read", Err: err}
+	}
+
+	reader := bytes.NewReader(data)
+	decoder := msgpack.GetDecoder()
+	defer msgpack.PutDecoder(decoder)
+	decoder.Reset(reader)
+	operationIndex := 0
+	pending := make(map[uint64][]operation) // transaction id -> operations waiting for the commit marker
+	defer func() {
+		for txID, operations := range pending {
+			db.Logger().Warningf("Discarding %d operations of incomplete transaction %d in WAL %s", len(operations), txID, path)
+		}
+	}()
+	for {
+		offset := int64(len(data) - reader.Len())
+		var entry walEntry
+		err := decoder.Decode(&entry)
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return db.handleCorruptWAL(path, data, offset, err)
+		}
+
+		// Verify checksum
+		var operationBuffer bytes.Buffer
+		operationEncoder := msgpack.NewEncoder(&operationBuffer)
+		err = operationEncoder.Encode(entry.Operation)
+		if err != nil {
+			return db.handleCorruptWAL(path, data, offset, err)
+		}
+		encodedOp := operationBuffer.Bytes()
+		computedChecksum := crc32.ChecksumIEEE(encodedOp)
+		if computedChecksum != entry.Checksum {
+			db.Logger().Errorf("WAL checksum mismatch at operation %d in %s", operationIndex, path)
+			return db.handleCorruptWAL(path, data, offset, errWALChecksumMismatch)
+		}
+
+		switch {
+		case entry.Operation.Type == OperationCommit:
+			err = db.replayOperations(path, operationIndex, pending[entry.Operation.TxID])
+			delete(pending, entry.Operation.TxID)
+		case entry.Operation.TxID != 0:
+			// Transactions are only reapplied once their commit marker shows they were written completely
+			pending[entry.Operation.TxID] = append(pending[entry.Operation.TxID], entry.Operation)
+		default:
+			err = db.replayOperations(path, operationIndex, []operation{entry.Operation})
+		}
+		if err != nil {
+			return err
+		}
+		operationIndex++
+	}
+
+	return nil
+}
+
+// replayOperations reapplies operations recovered from a WAL segment in a single bbolt transaction
+func (db *DB) replayOperations(path string, operationIndex int, operations []operation) error {
+	// Mark indexes as needing rebuild if dirty marker found
+	hasData := false
+	for _, operation := range operations {
+		if operation.Type == OperationIndex {
+			db.indexesNeedRebuild[operation.Key] = true
+		} else if operation.Type == OperationPut || operation.Type == OperationDelete {
+			hasData = true
+		}
+	}
+
+	// Reapply data operations to restore database state
+	if hasData {
+		err := db.DB.Update(func(transaction *bbolt.Tx) error {
+			for _, operation := range operations {
+				if operation.Type != OperationPut && operation.Type != OperationDelete {
+					continue
+				}
+				bucket, err := transaction.CreateBucketIfNotExists(operation.Bucket)
+				if err != nil {
+					return WALReplayError{WALPath: path, OperationIndex: operationIndex, Err: err}
+				}
+				if operation.Type == OperationPut {
+					err = bucket.Put([]byte(operation.Key), operation.Value)
+				} else {
+					err = bucket.Delete([]byte(operation.Key))
+				}
+				if err != nil {
+					return WALReplayError{WALPath: path, OperationIndex: operationIndex, Err: err}
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return WrappedError{Operation: "replay_wal", Err: err}
+		}
+	}
+	db.recoveryReport.EntriesApplied += len(operations)
+	return nil
+}
+
+// handleCorruptWAL deals with a damaged WAL segment whose entries before offset were replayed.
+// In salvage mode the damaged tail is moved to a ".corrupt" file so it can be inspected later.
+func (db *DB) handleCorruptWAL(path string, data []byte, offset int64, cause error) error {
+	if db.config.WALRecoveryMode == WALRecoveryStrict {
+		return WALCorruptionError{WALPath: path, Offset: offset, Err: cause}
+	}
+
+	discarded := int64(len(data)) - offset
+	db.Logger().Warningf("Discarding %d damaged bytes at offset %d of WAL %s: %v", discarded, offset, path, cause)
+
+	quarantinePath := path + ".corrupt"
+	if err := os.WriteFile(quarantinePath, data[offset:], 0644); err != nil {
+		return FileSystemError{Path: quarantinePath, Operation: "quarantine", Err: err}
+	}
+
+	db.recoveryReport.BytesDiscarded += discarded
+	if !db.recoveryReport.Corrupted() {
+		db.recoveryReport.FirstBadOffset = offset
+		db.recoveryReport.CorruptSegment = path
+		db.recoveryReport.QuarantinePath = quarantinePath
+	}
+	return nil
+}
+
+// RecoveryReport returns what replaying the WAL recovered when the database was opened.
+func (db *DB) RecoveryReport() RecoveryReport {
+	return db.recoveryReport
+}
+
+// syncWAL periodically syncs pending WAL writes to stable storage
+func (db *DB) syncWAL() {
+	defer db.closeWaitGroup.Done()
+	ticker := time.NewTicker(db.config.WALSyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := db.syncWALFile(); err != nil {
+				db.Logger().Errorf("WAL sync error: %v", err)
+			}
+		case <-db.closeChannel:
+			return
+		}
+	}
+}
+
+// syncWALFile syncs the WAL file if it has unsynced writes
+func (db *DB) syncWALFile() error {
+	db.walMutex.Lock()
+	defer db.walMutex.Unlock()
+	return db.syncWALFileLocked()
+}
+
+// syncWALFileLocked syncs the WAL file, the caller must hold walMutex
+func (db *DB) syncWALFileLocked() error {
+	if !db.walDirty {
+		return nil
+	}
+	if err := db.walFile.Sync(); err != nil {
+		return FileSystemError{Path: db.walFile.Name(), Operation: "sync", Err: err}
+	}
+	db.walDirty = false
+	return nil
+}
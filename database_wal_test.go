@@ -2,13 +2,33 @@ package nnut
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 )
 
+// walSegmentsSize returns the combined size of all WAL segments of the database
+func walSegmentsSize(t *testing.T, db *DB) int64 {
+	t.Helper()
+	segments, err := db.listWALSegments()
+	if err != nil {
+		t.Fatalf("Failed to list WAL segments: %v", err)
+	}
+	var size int64
+	for _, segment := range segments {
+		info, err := os.Stat(segment.Path)
+		if err != nil {
+			t.Fatalf("Failed to stat WAL segment: %v", err)
+		}
+		size += info.Size()
+	}
+	return size
+}
+
 func TestWALFlushInterval(t *testing.T) {
 	config := &Config{
 		FlushInterval: 100 * time.Millisecond,
@@ -32,26 +52,17 @@ func TestWALFlushInterval(t *testing.T) {
 		t.Fatalf("Failed to put: %v", err)
 	}
 
-	// Check that WAL file exists and has data before automatic flush
-	walPath := "test.db.wal"
-	walData, err := os.ReadFile(walPath)
-	if err != nil {
-		t.Fatalf("Failed to read WAL file before flush: %v", err)
-	}
-	if len(walData) == 0 {
+	// Check that WAL segments have data before automatic flush
+	initialSize := walSegmentsSize(t, db)
+	if initialSize == 0 {
 		t.Fatal("WAL file should contain data before flush")
 	}
-	initialSize := len(walData)
 
 	// Wait for automatic flush to occur based on FlushInterval
 	time.Sleep(200 * time.Millisecond)
 
-	// Check that WAL file is truncated after automatic flush
-	walDataAfter, err := os.ReadFile(walPath)
-	if err != nil {
-		t.Fatalf("Failed to read WAL file after automatic flush: %v", err)
-	}
-	finalSize := len(walDataAfter)
+	// Check that committed WAL segments are removed after automatic flush
+	finalSize := walSegmentsSize(t, db)
 
 	if finalSize >= initialSize {
 		t.Fatalf("WAL file should be truncated after automatic flush (initial: %d, final: %d)", initialSize, finalSize)
@@ -188,7 +199,7 @@ func TestWALCorruptionHandling(t *testing.T) {
 	store.Put(context.Background(), user)
 
 	// Corrupt the WAL by truncating it
-	walPath := dbPath + ".wal"
+	walPath := db.walFile.Name()
 	file, err := os.OpenFile(walPath, os.O_RDWR, 0644)
 	if err != nil {
 		t.Fatalf("Failed to open WAL: %v", err)
@@ -248,12 +259,7 @@ func TestWALTruncation(t *testing.T) {
 	}
 
 	// Check WAL has content
-	walPath := dbPath + ".wal"
-	stat, err := os.Stat(walPath)
-	if err != nil {
-		t.Fatalf("WAL file should exist: %v", err)
-	}
-	initialSize := stat.Size()
+	initialSize := walSegmentsSize(t, db)
 	if initialSize == 0 {
 		t.Fatal("WAL should have content before flush")
 	}
@@ -265,11 +271,7 @@ func TestWALTruncation(t *testing.T) {
 	time.Sleep(100 * time.Millisecond)
 
 	// WAL should be truncated (empty, since all committed)
-	stat, err = os.Stat(walPath)
-	if err != nil {
-		t.Fatalf("WAL file should exist: %v", err)
-	}
-	if stat.Size() != 0 {
+	if walSegmentsSize(t, db) != 0 {
 		t.Fatal("WAL should be empty after flush of all operations")
 	}
 
@@ -280,11 +282,7 @@ func TestWALTruncation(t *testing.T) {
 	}
 
 	// WAL should have content again
-	stat, err = os.Stat(walPath)
-	if err != nil {
-		t.Fatalf("WAL file should exist: %v", err)
-	}
-	if stat.Size() == 0 {
+	if walSegmentsSize(t, db) == 0 {
 		t.Fatal("WAL should have content after new operations")
 	}
 
@@ -295,11 +293,7 @@ func TestWALTruncation(t *testing.T) {
 	time.Sleep(100 * time.Millisecond)
 
 	// WAL should be empty again
-	stat, err = os.Stat(walPath)
-	if err != nil {
-		t.Fatalf("WAL file should exist: %v", err)
-	}
-	if stat.Size() != 0 {
+	if walSegmentsSize(t, db) != 0 {
 		t.Fatal("WAL should be empty after second flush")
 	}
 
@@ -355,12 +349,7 @@ func TestWALCreationAndFlushOnClose(t *testing.T) {
 	}
 
 	// Check WAL is created and has content
-	walPath := dbPath + ".wal"
-	stat, err := os.Stat(walPath)
-	if err != nil {
-		t.Fatalf("WAL file should exist: %v", err)
-	}
-	if stat.Size() == 0 {
+	if walSegmentsSize(t, db) == 0 {
 		t.Fatal("WAL should have content after mutation")
 	}
 
@@ -368,11 +357,7 @@ func TestWALCreationAndFlushOnClose(t *testing.T) {
 	db.Close()
 
 	// Check WAL is empty
-	stat, err = os.Stat(walPath)
-	if err != nil {
-		t.Fatalf("WAL file should still exist: %v", err)
-	}
-	if stat.Size() != 0 {
+	if walSegmentsSize(t, db) != 0 {
 		t.Fatal("WAL should be empty after close")
 	}
 
@@ -396,3 +381,920 @@ func TestWALCreationAndFlushOnClose(t *testing.T) {
 		t.Fatal("Data not committed to DB")
 	}
 }
+
+func TestWALSyncModes(t *testing.T) {
+	t.Parallel()
+	modes := []struct {
+		name string
+		mode WALSyncMode
+	}{
+		{"never", WALSyncNever},
+		{"always", WALSyncAlways},
+		{"interval", WALSyncInterval},
+	}
+	for _, tt := range modes {
+		t.Run(tt.name, func(t *testing.T) {
+			dbPath := filepath.Join(t.TempDir(), "sync.db")
+			config := &Config{
+				FlushInterval:   time.Hour,
+				WALSyncMode:     tt.mode,
+				WALSyncInterval: 10 * time.Millisecond,
+			}
+			db, err := OpenWithConfig(dbPath, config)
+			if err != nil {
+				t.Fatalf("Failed to open DB: %v", err)
+			}
+
+			store, err := NewStore[TestUser](db, "users")
+			if err != nil {
+				t.Fatalf("Failed to create store: %v", err)
+			}
+			err = store.Put(context.Background(), TestUser{UUID: "key1", Name: "John", Email: "john@example.com"})
+			if err != nil {
+				t.Fatalf("Failed to put: %v", err)
+			}
+
+			switch tt.mode {
+			case WALSyncAlways:
+				db.walMutex.Lock()
+				dirty := db.walDirty
+				db.walMutex.Unlock()
+				if dirty {
+					t.Fatal("WAL should be synced before Put returns")
+				}
+			case WALSyncInterval:
+				time.Sleep(50 * time.Millisecond)
+				db.walMutex.Lock()
+				dirty := db.walDirty
+				db.walMutex.Unlock()
+				if dirty {
+					t.Fatal("WAL should be synced by the background syncer")
+				}
+			}
+
+			db.Close()
+
+			// Data should survive a reopen regardless of the sync mode
+			db2, err := OpenWithConfig(dbPath, config)
+			if err != nil {
+				t.Fatalf("Failed to reopen DB: %v", err)
+			}
+			defer db2.Close()
+			store2, err := NewStore[TestUser](db2, "users")
+			if err != nil {
+				t.Fatalf("Failed to create store: %v", err)
+			}
+			retrieved, err := store2.Get(context.Background(), "key1")
+			if err != nil {
+				t.Fatalf("Failed to get: %v", err)
+			}
+			if retrieved.Name != "John" {
+				t.Fatal("Data not recovered")
+			}
+		})
+	}
+}
+
+func TestSyncDirectory(t *testing.T) {
+	t.Parallel()
+	if err := syncDirectory(t.TempDir()); err != nil {
+		t.Fatalf("Failed to sync directory: %v", err)
+	}
+	missing := filepath.Join(t.TempDir(), "missing")
+	if err := syncDirectory(missing); !errors.As(err, &FileSystemError{}) {
+		t.Fatalf("Expected FileSystemError for a missing directory, got %v", err)
+	}
+}
+
+func TestWALSegmentRotation(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	config := &Config{
+		FlushInterval:  time.Hour,
+		MaxBufferBytes: 1000000,
+	}
+	db, err := OpenWithConfig(dbPath, config)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+
+	store, err := NewStore[TestUser](db, "users")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	err = store.Put(context.Background(), TestUser{UUID: "user0", Name: "Before"})
+	if err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	firstSegment := db.walFile.Name()
+
+	// A flush rotates to a new segment and removes the committed one
+	db.Flush()
+	if db.walFile.Name() == firstSegment {
+		t.Fatal("Flush should rotate to a new WAL segment")
+	}
+	if _, err := os.Stat(firstSegment); !os.IsNotExist(err) {
+		t.Fatal("Committed WAL segment should be removed after flush")
+	}
+
+	err = store.Put(context.Background(), TestUser{UUID: "user1", Name: "After"})
+	if err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	segments, err := db.listWALSegments()
+	if err != nil {
+		t.Fatalf("Failed to list WAL segments: %v", err)
+	}
+	if len(segments) != 1 || segments[0].Path != db.walFile.Name() {
+		t.Fatalf("Expected only the active WAL segment, got %v", segments)
+	}
+
+	// Leave the uncommitted segment behind and reopen to replay it
+	crashDB(db)
+	db2, err := OpenWithConfig(dbPath, config)
+	if err != nil {
+		t.Fatalf("Failed to reopen DB: %v", err)
+	}
+	defer db2.Close()
+	if db2.currentEpoch.Load() <= segments[0].Epoch {
+		t.Fatalf("Expected epoch after %d, got %d", segments[0].Epoch, db2.currentEpoch.Load())
+	}
+
+	store2, err := NewStore[TestUser](db2, "users")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	for key, name := range map[string]string{"user0": "Before", "user1": "After"} {
+		retrieved, err := store2.Get(context.Background(), key)
+		if err != nil {
+			t.Fatalf("Failed to get %s: %v", key, err)
+		}
+		if retrieved.Name != name {
+			t.Fatalf("Expected name %s for %s, got %s", name, key, retrieved.Name)
+		}
+	}
+}
+
+// crashDB stops a database without flushing, leaving its WAL segments behind as after a crash.
+func crashDB(db *DB) {
+	close(db.closeChannel)
+	db.closeWaitGroup.Wait()
+	db.walFile.Close()
+	db.DB.Close()
+}
+
+func TestWALSalvageCorruptTail(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	config := &Config{
+		FlushInterval:  time.Hour,
+		MaxBufferBytes: 1000000,
+	}
+	db, err := OpenWithConfig(dbPath, config)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	store, err := NewStore[TestUser](db, "users")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		err = store.Put(context.Background(), TestUser{UUID: fmt.Sprintf("user%d", i), Name: "Salvaged"})
+		if err != nil {
+			t.Fatalf("Failed to put: %v", err)
+		}
+	}
+
+	// Append a torn write after the valid entries
+	walPath := db.walFile.Name()
+	crashDB(db)
+	stat, err := os.Stat(walPath)
+	if err != nil {
+		t.Fatalf("Failed to stat WAL: %v", err)
+	}
+	validSize := stat.Size()
+	garbage := []byte{0x82, 0xa9, 'O', 'p', 'e', 'r'}
+	file, err := os.OpenFile(walPath, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("Failed to open WAL: %v", err)
+	}
+	file.Write(garbage)
+	file.Close()
+
+	db2, err := OpenWithConfig(dbPath, config)
+	if err != nil {
+		t.Fatalf("Failed to reopen DB: %v", err)
+	}
+	defer db2.Close()
+
+	report := db2.RecoveryReport()
+	if !report.Corrupted() {
+		t.Fatal("Expected recovery report to flag corruption")
+	}
+	if report.SegmentsReplayed != 1 {
+		t.Fatalf("Expected 1 segment replayed, got %d", report.SegmentsReplayed)
+	}
+	if report.EntriesApplied == 0 {
+		t.Fatal("Expected valid entries to be applied")
+	}
+	if report.FirstBadOffset != validSize {
+		t.Fatalf("Expected first bad offset %d, got %d", validSize, report.FirstBadOffset)
+	}
+	if report.BytesDiscarded != int64(len(garbage)) {
+		t.Fatalf("Expected %d bytes discarded, got %d", len(garbage), report.BytesDiscarded)
+	}
+	if report.CorruptSegment != walPath {
+		t.Fatalf("Expected corrupt segment %s, got %s", walPath, report.CorruptSegment)
+	}
+	quarantined, err := os.ReadFile(report.QuarantinePath)
+	if err != nil {
+		t.Fatalf("Failed to read quarantined tail: %v", err)
+	}
+	if string(quarantined) != string(garbage) {
+		t.Fatalf("Quarantined tail does not match damaged bytes")
+	}
+
+	// Every entry before the damage is recovered
+	store2, err := NewStore[TestUser](db2, "users")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		retrieved, err := store2.Get(context.Background(), fmt.Sprintf("user%d", i))
+		if err != nil {
+			t.Fatalf("Failed to get user%d: %v", i, err)
+		}
+		if retrieved.Name != "Salvaged" {
+			t.Fatalf("Data not recovered for user%d", i)
+		}
+	}
+}
+
+func TestWALStrictRecovery(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	config := &Config{
+		FlushInterval:   time.Hour,
+		WALRecoveryMode: WALRecoveryStrict,
+	}
+	db, err := OpenWithConfig(dbPath, config)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	store, err := NewStore[TestUser](db, "users")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	err = store.Put(context.Background(), TestUser{UUID: "user0", Name: "Strict"})
+	if err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	walPath := db.walFile.Name()
+	crashDB(db)
+
+	file, err := os.OpenFile(walPath, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("Failed to open WAL: %v", err)
+	}
+	file.Write([]byte{0xc1})
+	file.Close()
+
+	_, err = OpenWithConfig(dbPath, config)
+	var corruptionErr WALCorruptionError
+	if !errors.As(err, &corruptionErr) {
+		t.Fatalf("Expected WALCorruptionError, got %v", err)
+	}
+	if corruptionErr.WALPath != walPath {
+		t.Fatalf("Expected corrupt WAL %s, got %s", walPath, corruptionErr.WALPath)
+	}
+	if _, err := os.Stat(walPath); err != nil {
+		t.Fatalf("Strict recovery should leave the WAL in place: %v", err)
+	}
+}
+
+func TestFlushFailureRequeuesOperations(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	config := &Config{
+		FlushInterval:  time.Hour,
+		MaxBufferBytes: 1000000,
+	}
+	db, err := OpenWithConfig(dbPath, config)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	store, err := NewStore[TestUser](db, "users")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	user := TestUser{UUID: "user0", Name: "Pending", Email: "pending@example.com"}
+	err = store.Put(context.Background(), user)
+	if err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+
+	// An operation without bucket makes the bbolt transaction fail
+	invalid := operation{Key: "invalid", Value: []byte{0x01}, Type: OperationPut}
+	err = db.writeOperations(context.Background(), []operation{invalid})
+	if err != nil {
+		t.Fatalf("Failed to write operation: %v", err)
+	}
+
+	err = db.Flush()
+	var flushErr FlushError
+	if !errors.As(err, &flushErr) {
+		t.Fatalf("Expected FlushError, got %v", err)
+	}
+	if !db.Degraded() || db.FlushErr() == nil {
+		t.Fatal("Database should be degraded after a failed flush")
+	}
+
+	// Failed operations are still visible
+	retrieved, err := store.Get(context.Background(), "user0")
+	if err != nil {
+		t.Fatalf("Failed to get after failed flush: %v", err)
+	}
+	if retrieved != user {
+		t.Fatalf("Expected %v after failed flush, got %v", user, retrieved)
+	}
+
+	// Newer writes win over requeued operations
+	user.Name = "Updated"
+	err = store.Put(context.Background(), user)
+	if err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+
+	db.operationsBufferMutex.Lock()
+	delete(db.operationsBuffer, bufferKey(nil, "invalid"))
+	db.operationsBufferMutex.Unlock()
+
+	err = db.Flush()
+	if err != nil {
+		t.Fatalf("Expected flush to recover, got %v", err)
+	}
+	if db.Degraded() {
+		t.Fatal("Database should not be degraded after a successful flush")
+	}
+	if walSegmentsSize(t, db) != 0 {
+		t.Fatal("WAL should be empty after recovering flush")
+	}
+	retrieved, err = store.Get(context.Background(), "user0")
+	if err != nil {
+		t.Fatalf("Failed to get after flush: %v", err)
+	}
+	if retrieved.Name != "Updated" {
+		t.Fatalf("Expected updated name after flush, got %s", retrieved.Name)
+	}
+}
+
+func TestFlushRetryDelay(t *testing.T) {
+	tests := []struct {
+		failures      int
+		flushInterval time.Duration
+		expected      time.Duration
+	}{
+		{1, time.Hour, flushRetryBaseDelay},
+		{2, time.Hour, 2 * flushRetryBaseDelay},
+		{4, time.Hour, 8 * flushRetryBaseDelay},
+		{100, time.Hour, flushRetryMaxDelay},
+		{100, time.Second, time.Second},
+	}
+	for _, tt := range tests {
+		if delay := flushRetryDelay(tt.failures, tt.flushInterval); delay != tt.expected {
+			t.Errorf("flushRetryDelay(%d, %v) = %v, expected %v", tt.failures, tt.flushInterval, delay, tt.expected)
+		}
+	}
+}
+
+func TestGroupCommitConcurrentWriters(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	config := &Config{
+		FlushInterval:  time.Hour,
+		MaxBufferBytes: 1000000,
+		WALSyncMode:    WALSyncAlways,
+	}
+	db, err := OpenWithConfig(dbPath, config)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+
+	store, err := NewStore[TestUser](db, "users")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	const writers = 50
+	var waitGroup sync.WaitGroup
+	errs := make(chan error, writers)
+	for i := 0; i < writers; i++ {
+		waitGroup.Add(1)
+		go func(i int) {
+			defer waitGroup.Done()
+			errs <- store.Put(context.Background(), TestUser{UUID: fmt.Sprintf("user%d", i), Name: fmt.Sprintf("User %d", i)})
+		}(i)
+	}
+	waitGroup.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Failed to put: %v", err)
+		}
+	}
+
+	// Every acknowledged write must be in the WAL
+	crashDB(db)
+	db2, err := OpenWithConfig(dbPath, config)
+	if err != nil {
+		t.Fatalf("Failed to reopen DB: %v", err)
+	}
+	defer db2.Close()
+	store2, err := NewStore[TestUser](db2, "users")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	for i := 0; i < writers; i++ {
+		retrieved, err := store2.Get(context.Background(), fmt.Sprintf("user%d", i))
+		if err != nil {
+			t.Fatalf("Failed to get user%d after recovery: %v", i, err)
+		}
+		if retrieved.Name != fmt.Sprintf("User %d", i) {
+			t.Fatalf("Data mismatch for user%d: got %v", i, retrieved)
+		}
+	}
+}
+
+func TestGroupCommitCoalescesWriters(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	config := &Config{
+		FlushInterval:  time.Hour,
+		MaxBufferBytes: 1000000,
+		WALSyncMode:    WALSyncAlways,
+	}
+	db, err := OpenWithConfig(dbPath, config)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+
+	store, err := NewStore[TestUser](db, "users")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	err = store.Put(context.Background(), TestUser{UUID: "user0", Name: "First"})
+	if err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+
+	// Pretend a commit is in progress so the writers queue up behind it
+	db.commitMutex.Lock()
+	db.committing = true
+	db.commitMutex.Unlock()
+
+	const writers = 10
+	errs := make(chan error, writers)
+	for i := 1; i <= writers; i++ {
+		go func(i int) {
+			errs <- store.Put(context.Background(), TestUser{UUID: fmt.Sprintf("user%d", i), Name: fmt.Sprintf("User %d", i)})
+		}(i)
+	}
+	for {
+		db.commitMutex.Lock()
+		queued := len(db.commitQueue)
+		db.commitMutex.Unlock()
+		if queued == writers {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Rotate the segment so the queued operations have to be encoded again for the new epoch
+	err = db.Flush()
+	if err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	epoch := db.currentEpoch.Load()
+
+	db.leadCommit()
+	for i := 0; i < writers; i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("Failed to put: %v", err)
+		}
+	}
+	if db.committing {
+		t.Fatal("Expected the group commit to finish")
+	}
+	db.operationsBufferMutex.Lock()
+	for _, operation := range db.operationsBuffer {
+		if operation.Epoch != epoch {
+			t.Errorf("Expected buffered operation in epoch %d, got %d", epoch, operation.Epoch)
+		}
+	}
+	db.operationsBufferMutex.Unlock()
+
+	crashDB(db)
+	db2, err := OpenWithConfig(dbPath, config)
+	if err != nil {
+		t.Fatalf("Failed to reopen DB: %v", err)
+	}
+	defer db2.Close()
+	store2, err := NewStore[TestUser](db2, "users")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	for i := 0; i <= writers; i++ {
+		if _, err := store2.Get(context.Background(), fmt.Sprintf("user%d", i)); err != nil {
+			t.Fatalf("Failed to get user%d after recovery: %v", i, err)
+		}
+	}
+}
+
+func TestGroupCommitHandsOffLead(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	config := &Config{
+		FlushInterval:  time.Hour,
+		MaxBufferBytes: 1000000,
+		WALSyncMode:    WALSyncAlways,
+	}
+	db, err := OpenWithConfig(dbPath, config)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	store, err := NewStore[TestUser](db, "users")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	// Hold the WAL so the leader is stuck committing its own group
+	db.walMutex.Lock()
+	leaderErr := make(chan error, 1)
+	go func() {
+		leaderErr <- store.Put(context.Background(), TestUser{UUID: "leader", Name: "Leader"})
+	}()
+	for {
+		db.commitMutex.Lock()
+		leading := db.committing && len(db.commitQueue) == 0
+		db.commitMutex.Unlock()
+		if leading {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// A writer queueing behind the leader's group
+	operations := []operation{{Bucket: []byte("users"), Key: "follower", Value: []byte("value"), Type: OperationPut}}
+	walBytes, err := encodeWALEntries(operations)
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	follower := &commitRequest{
+		operations: operations,
+		epoch:      db.currentEpoch.Load(),
+		walBytes:   walBytes,
+		done:       make(chan error, 1),
+		lead:       make(chan struct{}, 1),
+	}
+	db.commitMutex.Lock()
+	db.commitQueue = append(db.commitQueue, follower)
+	db.commitMutex.Unlock()
+
+	// The leader returns once its own group is durable, without committing the follower
+	db.walMutex.Unlock()
+	if err := <-leaderErr; err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if len(follower.done) != 0 {
+		t.Fatal("Expected the leader not to commit the follower's group")
+	}
+	select {
+	case <-follower.lead:
+	default:
+		t.Fatal("Expected the follower to be handed the lead")
+	}
+
+	db.leadCommit()
+	if err := <-follower.done; err != nil {
+		t.Fatalf("Failed to commit follower: %v", err)
+	}
+	if _, ok := db.getLatestBufferedOperation([]byte("users"), "follower"); !ok {
+		t.Fatal("Expected the follower's operation in the buffer")
+	}
+	db.commitMutex.Lock()
+	committing := db.committing
+	db.commitMutex.Unlock()
+	if committing {
+		t.Fatal("Expected the group commit to finish")
+	}
+}
+
+func TestBufferAccounting(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	config := &Config{
+		FlushInterval:  time.Hour,
+		MaxBufferBytes: 1000000,
+	}
+	db, err := OpenWithConfig(dbPath, config)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	store, err := NewStore[TestUser](db, "users")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	user := TestUser{UUID: "user1", Name: "John", Email: "john@example.com", Age: 30}
+	err = store.Put(context.Background(), user)
+	if err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+
+	// Keys, buckets and index markers count towards the buffer size
+	bufferSize := func() (uint64, uint64) {
+		db.operationsBufferMutex.Lock()
+		defer db.operationsBufferMutex.Unlock()
+		expected := uint64(0)
+		for _, operation := range db.operationsBuffer {
+			expected += operationSize(operation)
+		}
+		return db.bytesInBuffer, expected
+	}
+	size, expected := bufferSize()
+	if size != expected {
+		t.Fatalf("Expected %d buffered bytes, got %d", expected, size)
+	}
+
+	// Overwriting a buffered key replaces its size instead of adding to it
+	err = store.Put(context.Background(), user)
+	if err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	resize, _ := bufferSize()
+	if resize != size {
+		t.Fatalf("Expected %d buffered bytes after overwrite, got %d", size, resize)
+	}
+
+	db.Flush()
+	size, _ = bufferSize()
+	if size != 0 || db.bytesFlushing != 0 || db.bytesReserved != 0 {
+		t.Fatalf("Expected empty buffer after flush, got %d buffered, %d flushing, %d reserved", size, db.bytesFlushing, db.bytesReserved)
+	}
+}
+
+func TestBufferHardLimitFailFast(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	config := &Config{
+		FlushInterval:           time.Hour,
+		MaxBufferBytes:          100,
+		MaxBufferBytesHardLimit: 500,
+		BufferFullPolicy:        BufferFullFail,
+	}
+	db, err := OpenWithConfig(dbPath, config)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	store, err := NewStore[TestUser](db, "users")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	// Stall flushing so the buffer cannot drain
+	db.flushMutex.Lock()
+	var bufferFullError BufferFullError
+	for i := 0; i < 100; i++ {
+		err = store.Put(context.Background(), TestUser{UUID: fmt.Sprintf("user%d", i), Name: "John"})
+		if err != nil {
+			break
+		}
+	}
+	if !errors.As(err, &bufferFullError) {
+		db.flushMutex.Unlock()
+		t.Fatalf("Expected BufferFullError, got %v", err)
+	}
+	if bufferFullError.LimitBytes != 500 || bufferFullError.BufferedBytes+bufferFullError.RequestedBytes <= 500 {
+		t.Errorf("Unexpected BufferFullError %+v", bufferFullError)
+	}
+	db.flushMutex.Unlock()
+
+	// Writes are accepted again once a flush drained the buffer
+	err = db.Flush()
+	if err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	err = store.Put(context.Background(), TestUser{UUID: "after", Name: "John"})
+	if err != nil {
+		t.Fatalf("Failed to put after flush: %v", err)
+	}
+}
+
+func TestBufferHardLimitRevertsBatchIndexes(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	config := &Config{
+		FlushInterval:           time.Hour,
+		MaxBufferBytes:          100,
+		MaxBufferBytesHardLimit: 500,
+		BufferFullPolicy:        BufferFullFail,
+	}
+	db, err := OpenWithConfig(dbPath, config)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	store, err := NewStore[TestUser](db, "users")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	ctx := context.Background()
+	if err := store.Put(ctx, TestUser{UUID: "user0", Name: "John", Age: 30}); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+
+	// Stall flushing and fill the buffer
+	db.flushMutex.Lock()
+	defer db.flushMutex.Unlock()
+	stored := []string{"user0"}
+	for i := 1; ; i++ {
+		key := fmt.Sprintf("user%d", i)
+		if err := store.Put(ctx, TestUser{UUID: key, Name: "John", Age: 30}); err != nil {
+			break
+		}
+		stored = append(stored, key)
+	}
+
+	check := func() {
+		t.Helper()
+		count, err := store.Count(ctx)
+		if err != nil || count != len(stored) {
+			t.Fatalf("Expected %d records, got %d (%v)", len(stored), count, err)
+		}
+		results, err := store.GetQuery(ctx, &Query{Conditions: []Condition{{Field: "Name", Value: "John"}}})
+		if err != nil || len(results) != len(stored) {
+			t.Fatalf("Expected %d records named John, got %d (%v)", len(stored), len(results), err)
+		}
+		if has, _ := store.Has(ctx, "batch0"); has {
+			t.Fatal("Expected the rejected batch to leave no index entries")
+		}
+	}
+
+	// Rejected batch writes leave the indexes as they were
+	var bufferFullError BufferFullError
+	err = store.PutBatch(ctx, []TestUser{{UUID: "batch0", Name: "Jane"}, {UUID: stored[0], Name: "Jane"}})
+	if !errors.As(err, &bufferFullError) {
+		t.Fatalf("Expected BufferFullError, got %v", err)
+	}
+	check()
+	if err := store.DeleteBatch(ctx, stored); !errors.As(err, &bufferFullError) {
+		t.Fatalf("Expected BufferFullError, got %v", err)
+	}
+	check()
+	if _, err := store.DeleteQuery(ctx, &Query{Conditions: []Condition{{Field: "Age", Value: 30}}}); !errors.As(err, &bufferFullError) {
+		t.Fatalf("Expected BufferFullError, got %v", err)
+	}
+	check()
+}
+
+func TestBufferHardLimitBlocks(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	config := &Config{
+		FlushInterval:           time.Hour,
+		MaxBufferBytes:          100,
+		MaxBufferBytesHardLimit: 500,
+	}
+	db, err := OpenWithConfig(dbPath, config)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	store, err := NewStore[TestUser](db, "users")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	// Stall flushing and fill the buffer until a write blocks
+	db.flushMutex.Lock()
+	i := 0
+	for ; i < 100; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		err = store.Put(ctx, TestUser{UUID: fmt.Sprintf("user%d", i), Name: "John"})
+		cancel()
+		if err != nil {
+			break
+		}
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		db.flushMutex.Unlock()
+		t.Fatalf("Expected blocked write to time out, got %v", err)
+	}
+
+	// A blocked write proceeds once the stalled flush drains the buffer
+	done := make(chan error, 1)
+	go func() {
+		done <- store.Put(context.Background(), TestUser{UUID: fmt.Sprintf("user%d", i), Name: "John"})
+	}()
+	select {
+	case err := <-done:
+		db.flushMutex.Unlock()
+		t.Fatalf("Expected write to block, got %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	db.flushMutex.Unlock()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Failed to put after flush: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Write stayed blocked after flush")
+	}
+	if _, err := store.Get(context.Background(), fmt.Sprintf("user%d", i)); err != nil {
+		t.Fatalf("Failed to get: %v", err)
+	}
+}
+
+func TestBufferFullWriteLeavesNoIndexEntry(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	config := &Config{
+		FlushInterval:           time.Hour,
+		MaxBufferBytes:          100,
+		MaxBufferBytesHardLimit: 500,
+		BufferFullPolicy:        BufferFullBlock,
+	}
+	db, err := OpenWithConfig(dbPath, config)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	store, err := NewStore[TestUser](db, "users")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	ctx := context.Background()
+	if err := store.Put(ctx, TestUser{UUID: "user0", Name: "John", Age: 30}); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+
+	// Stall flushing and fill the buffer up to the hard limit
+	db.flushMutex.Lock()
+	defer db.flushMutex.Unlock()
+	stored := 1
+	for i := 1; ; i++ {
+		timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		err := store.Put(timeoutCtx, TestUser{UUID: fmt.Sprintf("user%d", i), Name: "John", Age: 30})
+		cancel()
+		if err != nil {
+			break
+		}
+		stored++
+	}
+
+	check := func() {
+		t.Helper()
+		if count, err := store.Count(ctx); err != nil || count != stored {
+			t.Fatalf("Expected %d records, got %d (%v)", stored, count, err)
+		}
+		if has, _ := store.Has(ctx, "waiting"); has {
+			t.Fatal("Expected the waiting write to leave no index entry")
+		}
+		if _, err := store.Get(ctx, "waiting"); !errors.As(err, &KeyNotFoundError{}) {
+			t.Fatalf("Expected KeyNotFoundError, got %v", err)
+		}
+	}
+
+	// A write waiting for buffer space is not visible, and stays invisible once it gives up
+	timeoutCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	result := make(chan error, 1)
+	go func() {
+		result <- store.Put(timeoutCtx, TestUser{UUID: "waiting", Name: "Jane", Age: 20})
+	}()
+	time.Sleep(50 * time.Millisecond)
+	check()
+	if err := <-result; !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected DeadlineExceeded, got %v", err)
+	}
+	check()
+}
@@ -0,0 +1,188 @@
+package nnut
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// IndexEncoder encodes values of a field type into strings whose byte order matches the order of the values.
+// It is used to index fields, to compare them with condition values and to sort results.
+// The encoder also receives condition values, which may have a different type than the field,
+// and returns false for values it cannot order together with the field's values.
+type IndexEncoder func(value reflect.Value) (string, bool)
+
+// indexEncoders holds the encoders for specific types, taking precedence over kindEncoders
+var indexEncoders = struct {
+	sync.RWMutex
+	byType map[reflect.Type]IndexEncoder
+}{
+	byType: map[reflect.Type]IndexEncoder{
+		reflect.TypeOf(time.Time{}): encodeTime,
+	},
+}
+
+// kindEncoders holds the encoders for the basic kinds, including named types based on them
+var kindEncoders = map[reflect.Kind]IndexEncoder{
+	reflect.String:  encodeString,
+	reflect.Bool:    encodeBool,
+	reflect.Int:     encodeSigned,
+	reflect.Int8:    encodeSigned,
+	reflect.Int16:   encodeSigned,
+	reflect.Int32:   encodeSigned,
+	reflect.Int64:   encodeSigned,
+	reflect.Uint:    encodeUnsigned,
+	reflect.Uint8:   encodeUnsigned,
+	reflect.Uint16:  encodeUnsigned,
+	reflect.Uint32:  encodeUnsigned,
+	reflect.Uint64:  encodeUnsigned,
+	reflect.Float32: encodeFloat,
+	reflect.Float64: encodeFloat,
+}
+
+// RegisterIndexEncoder makes fields of the given type indexable and queryable using encoder.
+// It replaces any encoder registered for the type before and must be called before stores using the type are created.
+// Changing the encoding of a type invalidates indexes persisted with the previous encoding.
+func RegisterIndexEncoder(typ reflect.Type, encoder IndexEncoder) {
+	indexEncoders.Lock()
+	defer indexEncoders.Unlock()
+	indexEncoders.byType[typ] = encoder
+}
+
+// lookupIndexEncoder returns the encoder for a field type
+func lookupIndexEncoder(typ reflect.Type) (IndexEncoder, bool) {
+	indexEncoders.RLock()
+	encoder, exists := indexEncoders.byType[typ]
+	indexEncoders.RUnlock()
+	if exists {
+		return encoder, true
+	}
+	encoder, exists = kindEncoders[typ.Kind()]
+	return encoder, exists
+}
+
+// encodeValue encodes a condition or field value, rejecting missing values
+func encodeValue(encoder IndexEncoder, value interface{}) (string, bool) {
+	if value == nil {
+		return "", false
+	}
+	return encoder(reflect.ValueOf(value))
+}
+
+func isSignedKind(kind reflect.Kind) bool {
+	return kind >= reflect.Int && kind <= reflect.Int64
+}
+
+func isUnsignedKind(kind reflect.Kind) bool {
+	return kind >= reflect.Uint && kind <= reflect.Uint64
+}
+
+func isFloatKind(kind reflect.Kind) bool {
+	return kind == reflect.Float32 || kind == reflect.Float64
+}
+
+// encodeString orders strings by their bytes
+func encodeString(value reflect.Value) (string, bool) {
+	if value.Kind() != reflect.String {
+		return "", false
+	}
+	return value.String(), true
+}
+
+// encodeBool orders false before true
+func encodeBool(value reflect.Value) (string, bool) {
+	if value.Kind() != reflect.Bool {
+		return "", false
+	}
+	if value.Bool() {
+		return "1", true
+	}
+	return "0", true
+}
+
+// encodeSigned orders signed integers, accepting any number that is a representable integer
+func encodeSigned(value reflect.Value) (string, bool) {
+	kind := value.Kind()
+	switch {
+	case isSignedKind(kind):
+		return encodeIndexInt(value.Int()), true
+	case isUnsignedKind(kind):
+		if value.Uint() > math.MaxInt64 {
+			return "", false
+		}
+		return encodeIndexInt(int64(value.Uint())), true
+	case isFloatKind(kind):
+		float := value.Float()
+		if float != math.Trunc(float) || float < math.MinInt64 || float >= math.MaxInt64 {
+			return "", false
+		}
+		return encodeIndexInt(int64(float)), true
+	}
+	return "", false
+}
+
+// encodeUnsigned orders unsigned integers, accepting any number that is a representable non-negative integer
+func encodeUnsigned(value reflect.Value) (string, bool) {
+	kind := value.Kind()
+	switch {
+	case isUnsignedKind(kind):
+		return fmt.Sprintf("%016x", value.Uint()), true
+	case isSignedKind(kind):
+		if value.Int() < 0 {
+			return "", false
+		}
+		return fmt.Sprintf("%016x", uint64(value.Int())), true
+	case isFloatKind(kind):
+		float := value.Float()
+		if float != math.Trunc(float) || float < 0 || float >= math.MaxUint64 {
+			return "", false
+		}
+		return fmt.Sprintf("%016x", uint64(float)), true
+	}
+	return "", false
+}
+
+// encodeFloat orders floats, accepting any number
+func encodeFloat(value reflect.Value) (string, bool) {
+	var float float64
+	kind := value.Kind()
+	switch {
+	case isFloatKind(kind):
+		float = value.Float()
+	case isSignedKind(kind):
+		float = float64(value.Int())
+	case isUnsignedKind(kind):
+		float = float64(value.Uint())
+	default:
+		return "", false
+	}
+	if float == 0 {
+		// -0 equals 0, it must not encode apart from it
+		float = 0
+	}
+	// Flip the sign bit of positive values and all bits of negative ones so the bits sort like the values
+	bits := math.Float64bits(float)
+	if bits&(1<<63) == 0 {
+		bits ^= 1 << 63
+	} else {
+		bits = ^bits
+	}
+	return fmt.Sprintf("%016x", bits), true
+}
+
+// encodeTime orders times by the instant they represent
+func encodeTime(value reflect.Value) (string, bool) {
+	instant, ok := value.Interface().(time.Time)
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprintf("%s%08x", encodeIndexInt(instant.Unix()), instant.Nanosecond()), true
+}
+
+// encodeIndexInt encodes an int as fixed width hex with the sign bit flipped,
+// so negative values sort before positive ones
+func encodeIndexInt(value int64) string {
+	return fmt.Sprintf("%016x", uint64(value)^(1<<63))
+}
@@ -0,0 +1,137 @@
+package nnut
+
+import (
+	"context"
+	"math"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIndexEncoderOrder(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		values []interface{} // in ascending order
+	}{
+		{"int", []interface{}{math.MinInt64, -10, -1, 0, 1, 10, math.MaxInt64}},
+		{"int64", []interface{}{int64(-5), int64(0), int64(5)}},
+		{"uint", []interface{}{uint(0), uint(1), uint(255), uint(math.MaxUint32)}},
+		{"float64", []interface{}{math.Inf(-1), -2.5, -0.5, 0.0, 0.5, 2.5, math.Inf(1)}},
+		{"float32", []interface{}{float32(-1.5), float32(0), float32(1.5)}},
+		{"bool", []interface{}{false, true}},
+		{"string", []interface{}{"", "a", "ab", "b"}},
+		{"time", []interface{}{base.Add(-time.Hour), base, base.Add(time.Nanosecond), base.Add(time.Hour)}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			encoder, exists := lookupIndexEncoder(reflect.TypeOf(test.values[0]))
+			if !exists {
+				t.Fatal("Expected an encoder")
+			}
+			var previous string
+			for i, value := range test.values {
+				encoded, ok := encodeValue(encoder, value)
+				if !ok {
+					t.Fatalf("Failed to encode %v", value)
+				}
+				if i > 0 && strings.Compare(previous, encoded) >= 0 {
+					t.Fatalf("Expected encoding of %v to sort after %v", value, test.values[i-1])
+				}
+				previous = encoded
+			}
+		})
+	}
+}
+
+func TestIndexEncoderConversions(t *testing.T) {
+	signed, _ := lookupIndexEncoder(reflect.TypeOf(int64(0)))
+	unsigned, _ := lookupIndexEncoder(reflect.TypeOf(uint(0)))
+	float, _ := lookupIndexEncoder(reflect.TypeOf(0.0))
+
+	// Numbers of another type encode like the field type when representable
+	if a, _ := encodeValue(signed, 30); a != encodeIndexInt(30) {
+		t.Errorf("Expected int to encode like int64, got %q", a)
+	}
+	if a, _ := encodeValue(signed, 30.0); a != encodeIndexInt(30) {
+		t.Errorf("Expected integral float to encode like int64, got %q", a)
+	}
+	if a, b := encodeValueOrEmpty(float, math.Copysign(0, -1)), encodeValueOrEmpty(float, 0); a != b {
+		t.Errorf("Expected -0 to encode like 0, got %q and %q", a, b)
+	}
+	if a, b := encodeValueOrEmpty(float, 2), encodeValueOrEmpty(float, 2.0); a != b {
+		t.Errorf("Expected int and float to encode alike, got %q and %q", a, b)
+	}
+	if a, b := encodeValueOrEmpty(unsigned, 7), encodeValueOrEmpty(unsigned, uint8(7)); a != b {
+		t.Errorf("Expected int and uint8 to encode alike, got %q and %q", a, b)
+	}
+
+	rejected := []struct {
+		encoder IndexEncoder
+		value   interface{}
+	}{
+		{signed, 29.5},
+		{signed, "30"},
+		{unsigned, -1},
+		{float, "1.5"},
+		{signed, nil},
+	}
+	for _, test := range rejected {
+		if _, ok := encodeValue(test.encoder, test.value); ok {
+			t.Errorf("Expected %v to be rejected", test.value)
+		}
+	}
+}
+
+func encodeValueOrEmpty(encoder IndexEncoder, value interface{}) string {
+	encoded, _ := encodeValue(encoder, value)
+	return encoded
+}
+
+// testPriority is a custom type ordered by rank rather than name
+type testPriority string
+
+func TestRegisterIndexEncoder(t *testing.T) {
+	ranks := map[testPriority]string{"low": "0", "medium": "1", "high": "2"}
+	RegisterIndexEncoder(reflect.TypeOf(testPriority("")), func(value reflect.Value) (string, bool) {
+		if value.Type() != reflect.TypeOf(testPriority("")) {
+			return "", false
+		}
+		rank, exists := ranks[value.Interface().(testPriority)]
+		return rank, exists
+	})
+
+	type Task struct {
+		ID       string       `nnut:"key"`
+		Priority testPriority `nnut:"index"`
+	}
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+	store, err := NewStore[Task](db, "tasks")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	tasks := []Task{{ID: "1", Priority: "high"}, {ID: "2", Priority: "low"}, {ID: "3", Priority: "medium"}}
+	if err := store.PutBatch(context.Background(), tasks); err != nil {
+		t.Fatalf("Failed to put batch: %v", err)
+	}
+	db.Flush()
+
+	results, err := store.GetQuery(context.Background(), &Query{
+		Conditions: []Condition{{Field: "Priority", Value: testPriority("low"), Operator: GreaterThan}},
+		Index:      "Priority",
+		Sort:       Ascending,
+	})
+	if err != nil {
+		t.Fatalf("Failed to query: %v", err)
+	}
+	if len(results) != 2 || results[0].ID != "3" || results[1].ID != "1" {
+		t.Fatalf("Expected medium then high, got %v", results)
+	}
+}
@@ -1,9 +1,13 @@
 package nnut
 
 import (
+	"errors"
 	"fmt"
 )
 
+// errWALChecksumMismatch indicates a WAL entry whose content does not match its checksum.
+var errWALChecksumMismatch = errors.New("checksum mismatch")
+
 // InvalidTypeError indicates that the type does not meet the requirements (e.g., not a struct).
 type InvalidTypeError struct {
 	Type string
@@ -29,6 +33,23 @@ func (e KeyFieldNotStringError) Error() string {
 	return fmt.Sprintf("key field '%s' must be of type string", e.FieldName)
 }
 
+// VersionFieldNotIntegerError indicates that the field tagged with nnut:"version" is not an integer.
+type VersionFieldNotIntegerError struct {
+	FieldName string
+	Type      string
+}
+
+func (e VersionFieldNotIntegerError) Error() string {
+	return fmt.Sprintf("version field '%s' must be an integer, got %s", e.FieldName, e.Type)
+}
+
+// VersionFieldNotFoundError indicates that a versioned operation was used on a type without a nnut:"version" field.
+type VersionFieldNotFoundError struct{}
+
+func (e VersionFieldNotFoundError) Error() string {
+	return "no field tagged with nnut:\"version\""
+}
+
 // InvalidKeyError indicates that the provided key is invalid (e.g., empty or too long).
 type InvalidKeyError struct {
 	Key string
@@ -49,14 +70,24 @@ func (e InvalidFieldTypeError) Error() string {
 	return fmt.Sprintf("field '%s' has invalid type '%s', expected '%s'", e.FieldName, e.Actual, e.Expected)
 }
 
-// IndexFieldTypeError indicates an index field is not a string.
+// IndexFieldTypeError indicates an index field has a type without an index encoder.
 type IndexFieldTypeError struct {
 	FieldName string
 	Type      string
 }
 
 func (e IndexFieldTypeError) Error() string {
-	return fmt.Sprintf("index field '%s' must be string, got '%s'", e.FieldName, e.Type)
+	return fmt.Sprintf("index field '%s' has unsupported type '%s'", e.FieldName, e.Type)
+}
+
+// IndexDefinitionError indicates an index declared in the struct tags cannot be created.
+type IndexDefinitionError struct {
+	IndexName string
+	Reason    string
+}
+
+func (e IndexDefinitionError) Error() string {
+	return fmt.Sprintf("invalid index '%s': %s", e.IndexName, e.Reason)
 }
 
 // BucketNameError indicates an invalid bucket name.
@@ -99,6 +130,16 @@ func (e KeyNotFoundError) Error() string {
 	return fmt.Sprintf("key '%s' not found in bucket '%s'", e.Key, e.Bucket)
 }
 
+// AlreadyExistsError indicates that a record to be inserted already exists.
+type AlreadyExistsError struct {
+	Bucket string
+	Key    string
+}
+
+func (e AlreadyExistsError) Error() string {
+	return fmt.Sprintf("key '%s' already exists in bucket '%s'", e.Key, e.Bucket)
+}
+
 // WrappedError wraps an underlying error with additional context.
 type WrappedError struct {
 	Operation string
@@ -133,6 +174,21 @@ func (e WALReplayError) Unwrap() error {
 	return e.Err
 }
 
+// WALCorruptionError indicates a damaged WAL entry that could not be replayed.
+type WALCorruptionError struct {
+	WALPath string
+	Offset  int64
+	Err     error
+}
+
+func (e WALCorruptionError) Error() string {
+	return fmt.Sprintf("WAL %s is corrupted at offset %d: %v", e.WALPath, e.Offset, e.Err)
+}
+
+func (e WALCorruptionError) Unwrap() error {
+	return e.Err
+}
+
 // FlushError indicates an error during flush operation.
 type FlushError struct {
 	OperationCount int
@@ -215,3 +271,61 @@ type InvalidQueryError struct {
 func (e InvalidQueryError) Error() string {
 	return fmt.Sprintf("invalid query %s=%v: %s", e.Field, e.Value, e.Reason)
 }
+
+// BufferFullError indicates that a write was rejected because the operations buffer reached its hard limit.
+type BufferFullError struct {
+	BufferedBytes  uint64
+	RequestedBytes uint64
+	LimitBytes     uint64
+}
+
+func (e BufferFullError) Error() string {
+	return fmt.Sprintf("operations buffer is full: %d bytes buffered, %d bytes requested, limit %d bytes", e.BufferedBytes, e.RequestedBytes, e.LimitBytes)
+}
+
+// TxClosedError indicates that a transaction was used after DB.Update returned.
+type TxClosedError struct{}
+
+func (e TxClosedError) Error() string {
+	return "transaction is closed"
+}
+
+// VersionConflictError indicates that a conditional put found a different version than expected.
+type VersionConflictError struct {
+	Bucket   string
+	Key      string
+	Expected uint64
+	Actual   uint64
+}
+
+func (e VersionConflictError) Error() string {
+	return fmt.Sprintf("version conflict for key '%s' in bucket '%s': expected %d, found %d", e.Key, e.Bucket, e.Expected, e.Actual)
+}
+
+// UniqueConstraintError indicates a write would store a value of a unique index that another record already holds.
+type UniqueConstraintError struct {
+	Bucket string
+	Field  string
+	Value  interface{}
+	Key    string // key of the record holding the value
+}
+
+func (e UniqueConstraintError) Error() string {
+	return fmt.Sprintf("value '%v' of unique field '%s' in bucket '%s' is already used by key '%s'", e.Value, e.Field, e.Bucket, e.Key)
+}
+
+// SnapshotReleasedError indicates that a snapshot was read after it was released.
+type SnapshotReleasedError struct{}
+
+func (e SnapshotReleasedError) Error() string {
+	return "snapshot has been released"
+}
+
+// ReadOnlyStoreError indicates that a write was attempted through a store bound to a snapshot.
+type ReadOnlyStoreError struct {
+	Bucket string
+}
+
+func (e ReadOnlyStoreError) Error() string {
+	return fmt.Sprintf("store for bucket '%s' is a read-only snapshot view", e.Bucket)
+}
@@ -35,6 +35,18 @@ func TestWALReplayError(t *testing.T) {
 	}
 }
 
+func TestWALCorruptionError(t *testing.T) {
+	underlying := errors.New("unexpected EOF")
+	err := WALCorruptionError{WALPath: "/tmp/test.wal.1", Offset: 128, Err: underlying}
+	expected := "WAL /tmp/test.wal.1 is corrupted at offset 128: unexpected EOF"
+	if err.Error() != expected {
+		t.Errorf("Expected %q, got %q", expected, err.Error())
+	}
+	if !errors.Is(err, underlying) {
+		t.Error("WALCorruptionError should unwrap underlying error")
+	}
+}
+
 func TestFlushError(t *testing.T) {
 	underlying := errors.New("disk full")
 	err := FlushError{OperationCount: 100, Err: underlying}
@@ -47,6 +59,14 @@ func TestFlushError(t *testing.T) {
 	}
 }
 
+func TestBufferFullError(t *testing.T) {
+	err := BufferFullError{BufferedBytes: 900, RequestedBytes: 200, LimitBytes: 1000}
+	expected := "operations buffer is full: 900 bytes buffered, 200 bytes requested, limit 1000 bytes"
+	if err.Error() != expected {
+		t.Errorf("Expected %q, got %q", expected, err.Error())
+	}
+}
+
 func TestPartialBatchError(t *testing.T) {
 	failed := map[string]error{
 		"key1": errors.New("decode failed"),
@@ -128,8 +148,24 @@ func TestInvalidFieldTypeError(t *testing.T) {
 }
 
 func TestIndexFieldTypeError(t *testing.T) {
-	err := IndexFieldTypeError{FieldName: "Email", Type: "int"}
-	expected := "index field 'Email' must be string, got 'int'"
+	err := IndexFieldTypeError{FieldName: "Email", Type: "[]string"}
+	expected := "index field 'Email' has unsupported type '[]string'"
+	if err.Error() != expected {
+		t.Errorf("Expected %q, got %q", expected, err.Error())
+	}
+}
+
+func TestIndexDefinitionError(t *testing.T) {
+	err := IndexDefinitionError{IndexName: "Email", Reason: "name is already used by a field"}
+	expected := "invalid index 'Email': name is already used by a field"
+	if err.Error() != expected {
+		t.Errorf("Expected %q, got %q", expected, err.Error())
+	}
+}
+
+func TestUniqueConstraintError(t *testing.T) {
+	err := UniqueConstraintError{Bucket: "users", Field: "Email", Value: "ann@example.com", Key: "user1"}
+	expected := "value 'ann@example.com' of unique field 'Email' in bucket 'users' is already used by key 'user1'"
 	if err.Error() != expected {
 		t.Errorf("Expected %q, got %q", expected, err.Error())
 	}
@@ -174,6 +210,62 @@ func TestConfigValidation(t *testing.T) {
 			wantErr:  true,
 			errField: "WALPath",
 		},
+		{
+			name: "unknown WALSyncMode",
+			config: &Config{
+				FlushInterval:  time.Minute,
+				WALPath:        "/tmp/test.wal",
+				MaxBufferBytes: 1024 * 1024,
+				WALSyncMode:    WALSyncMode(42),
+			},
+			wantErr:  true,
+			errField: "WALSyncMode",
+		},
+		{
+			name: "negative WALSyncInterval",
+			config: &Config{
+				FlushInterval:   time.Minute,
+				WALPath:         "/tmp/test.wal",
+				MaxBufferBytes:  1024 * 1024,
+				WALSyncMode:     WALSyncInterval,
+				WALSyncInterval: -time.Second,
+			},
+			wantErr:  true,
+			errField: "WALSyncInterval",
+		},
+		{
+			name: "unknown WALRecoveryMode",
+			config: &Config{
+				FlushInterval:   time.Minute,
+				WALPath:         "/tmp/test.wal",
+				MaxBufferBytes:  1024 * 1024,
+				WALRecoveryMode: WALRecoveryMode(7),
+			},
+			wantErr:  true,
+			errField: "WALRecoveryMode",
+		},
+		{
+			name: "hard limit below MaxBufferBytes",
+			config: &Config{
+				FlushInterval:           time.Minute,
+				WALPath:                 "/tmp/test.wal",
+				MaxBufferBytes:          1024 * 1024,
+				MaxBufferBytesHardLimit: 1024,
+			},
+			wantErr:  true,
+			errField: "MaxBufferBytesHardLimit",
+		},
+		{
+			name: "unknown BufferFullPolicy",
+			config: &Config{
+				FlushInterval:    time.Minute,
+				WALPath:          "/tmp/test.wal",
+				MaxBufferBytes:   1024 * 1024,
+				BufferFullPolicy: BufferFullPolicy(7),
+			},
+			wantErr:  true,
+			errField: "BufferFullPolicy",
+		},
 		{
 			name: "valid config",
 			config: &Config{
@@ -289,3 +381,55 @@ func TestQueryValidation(t *testing.T) {
 		})
 	}
 }
+
+func TestTxClosedError(t *testing.T) {
+	err := TxClosedError{}
+	expected := "transaction is closed"
+	if err.Error() != expected {
+		t.Errorf("Expected %q, got %q", expected, err.Error())
+	}
+}
+
+func TestVersionFieldErrors(t *testing.T) {
+	notInteger := VersionFieldNotIntegerError{FieldName: "Version", Type: "string"}
+	expected := "version field 'Version' must be an integer, got string"
+	if notInteger.Error() != expected {
+		t.Errorf("Expected %q, got %q", expected, notInteger.Error())
+	}
+
+	notFound := VersionFieldNotFoundError{}
+	expected = "no field tagged with nnut:\"version\""
+	if notFound.Error() != expected {
+		t.Errorf("Expected %q, got %q", expected, notFound.Error())
+	}
+}
+
+func TestVersionConflictError(t *testing.T) {
+	err := VersionConflictError{Bucket: "users", Key: "123", Expected: 3, Actual: 4}
+	expected := "version conflict for key '123' in bucket 'users': expected 3, found 4"
+	if err.Error() != expected {
+		t.Errorf("Expected %q, got %q", expected, err.Error())
+	}
+}
+
+func TestAlreadyExistsError(t *testing.T) {
+	err := AlreadyExistsError{Bucket: "users", Key: "123"}
+	expected := "key '123' already exists in bucket 'users'"
+	if err.Error() != expected {
+		t.Errorf("Expected %q, got %q", expected, err.Error())
+	}
+}
+
+func TestSnapshotErrors(t *testing.T) {
+	released := SnapshotReleasedError{}
+	expected := "snapshot has been released"
+	if released.Error() != expected {
+		t.Errorf("Expected %q, got %q", expected, released.Error())
+	}
+
+	readOnly := ReadOnlyStoreError{Bucket: "users"}
+	expected = "store for bucket 'users' is a read-only snapshot view"
+	if readOnly.Error() != expected {
+		t.Errorf("Expected %q, got %q", expected, readOnly.Error())
+	}
+}
@@ -1,10 +1,11 @@
 module github.com/redkenrok/go-nnut
 
-go 1.25
+go 1.25.0
 
 require (
 	github.com/vmihailenco/msgpack/v5 v5.4.1
 	go.etcd.io/bbolt v1.4.3
+	golang.org/x/text v0.40.0
 )
 
 require (
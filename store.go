@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"reflect"
+	"sort"
 	"strings"
 	"sync"
 
@@ -42,19 +43,49 @@ func buildBTreeKey(bucketPrefix, fieldName string) string {
 // Store represents a typed bucket for storing and retrieving values of type T.
 // It provides type-safe operations with automatic indexing and serialization.
 type Store[T any] struct {
-	database    *DB
-	bucket      []byte
-	keyField    int               // index of the field tagged with nnut:"key"
-	indexFields map[string]int    // field name -> field index
-	fieldMap    map[string]int    // field name -> field index
-	indexes     map[string]*bTree // field name -> B-tree index (includes primary key as "__primary_key")
+	database         *DB
+	bucket           []byte
+	keyField         int                     // index of the field tagged with nnut:"key"
+	versionField     int                     // index of the field tagged with nnut:"version", -1 if none
+	indexFields      map[string][]int        // field name -> field index path
+	compositeIndexes map[string][]string     // composite index name -> field names in declaration order
+	uniqueFields     map[string]bool         // field name -> true for indexes tagged unique
+	foldFields       map[string]bool         // field name -> true for string fields tagged fold, whose encoder folds values
+	fulltextFields   map[string]bool         // field name -> true for string fields tagged fulltext, indexed by their terms
+	partialIndexes   map[string]PartialIndex // partial index name -> definition
+	fieldMap         map[string][]int        // field name -> field index path
+	encoders         map[string]IndexEncoder // field name -> encoder, for fields of an orderable type or slices of one
+	multiValueFields map[string]bool         // field name -> true for slice fields, whose encoder encodes the elements
+	indexes          map[string]*bTree       // field or composite index name -> B-tree index (includes primary key as "__primary_key")
+
+	keyLocks      map[string]*keyLock // key -> lock serializing read-modify-write cycles on the key
+	keyLocksMutex sync.Mutex          // guards keyLocks
+	snapshot      *Snapshot           // set for read-only views returned by WithSnapshot
+}
+
+// StoreOption configures a store created with NewStore.
+type StoreOption func(*storeOptions)
+
+// storeOptions holds the settings applied by StoreOptions
+type storeOptions struct {
+	partialIndexes []PartialIndex
 }
 
 // NewStore creates a new store for type T with the given bucket name.
 // It analyzes the struct tags of T to set up key fields and indexes.
 // The type T must have exactly one field tagged with `nnut:"key"` of type string.
 // Fields tagged with `nnut:"index"` will be automatically indexed for efficient querying.
-func NewStore[T any](database *DB, bucketName string) (*Store[T], error) {
+// Fields tagged with `nnut:"index:<name>"` form the composite index <name>, ordered by their values in declaration order.
+// Tag options are separated by commas, so a field can be indexed on its own and in composite indexes.
+// Fields tagged with `nnut:"index,unique"` reject writes of a value another record already holds.
+// String fields tagged with `nnut:"index,fold"` are indexed, compared and sorted ignoring case and Unicode representation.
+// String fields tagged with `nnut:"fulltext"` get an inverted index of their terms, searched with MatchAll and MatchAny.
+// Indexed slice fields get an index entry per element and are queried with the Contains operator.
+// An integer field tagged with `nnut:"version"` is incremented on every put and enables PutIfVersion.
+// Fields of nested structs and pointers to structs are named by their dotted path, such as Address.City,
+// in tags and queries, while fields of embedded structs keep their own names. Key and version fields must be top-level.
+// Options add indexes that cannot be declared in tags, such as partial indexes.
+func NewStore[T any](database *DB, bucketName string, options ...StoreOption) (*Store[T], error) {
 	// Validate bucket name
 	if bucketName == "" {
 		return nil, BucketNameError{BucketName: bucketName, Reason: "cannot be empty"}
@@ -75,60 +106,179 @@ func NewStore[T any](database *DB, bucketName string) (*Store[T], error) {
 		return nil, InvalidTypeError{Type: typeOfStruct.String()}
 	}
 	keyFieldIndex := -1
-	indexFields := make(map[string]int)
-	fieldMap := make(map[string]int)
-	for fieldIndex := 0; fieldIndex < typeOfStruct.NumField(); fieldIndex++ {
-		field := typeOfStruct.Field(fieldIndex)
-		fieldMap[field.Name] = fieldIndex
-		tagValue := field.Tag.Get("nnut")
-		if tagValue == "key" {
-			if field.Type.Kind() != reflect.String {
-				return nil, KeyFieldNotStringError{FieldName: field.Name}
+	versionFieldIndex := -1
+	indexFields := make(map[string][]int)
+	compositeIndexes := make(map[string][]string)
+	uniqueFields := make(map[string]bool)
+	foldFields := make(map[string]bool)
+	fulltextFields := make(map[string]bool)
+	fieldMap := make(map[string][]int)
+	encoders := make(map[string]IndexEncoder)
+	multiValueFields := make(map[string]bool)
+	var walkFields func(structType reflect.Type, prefix string, parentPath []int, visiting map[reflect.Type]bool) error
+	walkFields = func(structType reflect.Type, prefix string, parentPath []int, visiting map[reflect.Type]bool) error {
+		visiting[structType] = true
+		defer delete(visiting, structType)
+		var nestedFields []reflect.StructField
+		for fieldIndex := 0; fieldIndex < structType.NumField(); fieldIndex++ {
+			field := structType.Field(fieldIndex)
+			fieldName := prefix + field.Name
+			if _, shadowed := fieldMap[fieldName]; shadowed {
+				// A field of the outer struct hides the promoted field of the same name
+				continue
+			}
+			path := append(append([]int(nil), parentPath...), fieldIndex)
+			fieldMap[fieldName] = path
+			encoder, exists := lookupIndexEncoder(field.Type)
+			if exists {
+				encoders[fieldName] = encoder
+			} else if field.Type.Kind() == reflect.Slice {
+				// Slice fields are indexed and compared by their elements
+				if encoder, exists := lookupIndexEncoder(field.Type.Elem()); exists {
+					encoders[fieldName] = encoder
+					multiValueFields[fieldName] = true
+				}
+			} else if nestedType := nestedStructType(field.Type); nestedType != nil && !visiting[nestedType] && field.IsExported() {
+				field.Index = path
+				nestedFields = append(nestedFields, field)
+			}
+			for _, option := range strings.Split(field.Tag.Get("nnut"), ",") {
+				switch {
+				case option == "key" && len(parentPath) == 0:
+					if field.Type.Kind() != reflect.String {
+						return KeyFieldNotStringError{FieldName: field.Name}
+					}
+					keyFieldIndex = fieldIndex
+				case option == "index":
+					indexFields[fieldName] = path
+				case option == "unique":
+					uniqueFields[fieldName] = true
+				case option == "fold":
+					foldFields[fieldName] = true
+				case option == "fulltext":
+					fulltextFields[fieldName] = true
+				case strings.HasPrefix(option, "index:"):
+					indexName := strings.TrimPrefix(option, "index:")
+					compositeIndexes[indexName] = append(compositeIndexes[indexName], fieldName)
+				case option == "version" && len(parentPath) == 0:
+					if !isIntegerKind(field.Type.Kind()) {
+						return VersionFieldNotIntegerError{FieldName: field.Name, Type: field.Type.String()}
+					}
+					versionFieldIndex = fieldIndex
+				}
 			}
-			keyFieldIndex = fieldIndex
-		} else if tagValue == "index" {
-			indexFields[field.Name] = fieldIndex
 		}
+
+		// Nested fields are named after their parent, while fields of embedded structs are promoted
+		for _, field := range nestedFields {
+			nestedPrefix := prefix + field.Name + "."
+			if field.Anonymous {
+				nestedPrefix = prefix
+			}
+			if err := walkFields(nestedStructType(field.Type), nestedPrefix, field.Index, visiting); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walkFields(typeOfStruct, "", nil, make(map[reflect.Type]bool)); err != nil {
+		return nil, err
 	}
 	if keyFieldIndex == -1 {
 		return nil, KeyFieldNotFoundError{}
 	}
 
-	// Validate index fields are strings or comparable (int)
-	for fieldName, fieldIndex := range indexFields {
-		field := typeOfStruct.Field(fieldIndex)
-		kind := field.Type.Kind()
-		if kind != reflect.String && kind != reflect.Int {
-			return nil, IndexFieldTypeError{FieldName: field.Name, Type: field.Type.String()}
+	// Validate index fields have an encoder to order their values
+	for fieldName, path := range indexFields {
+		if _, exists := encoders[fieldName]; !exists {
+			return nil, IndexFieldTypeError{FieldName: fieldName, Type: typeOfStruct.FieldByIndex(path).Type.String()}
+		}
+	}
+	for fieldName := range uniqueFields {
+		if _, indexed := indexFields[fieldName]; !indexed {
+			return nil, IndexDefinitionError{IndexName: fieldName, Reason: "unique requires the index option"}
+		}
+		if multiValueFields[fieldName] {
+			return nil, IndexDefinitionError{IndexName: fieldName, Reason: "unique is not supported on slice fields"}
+		}
+	}
+	for fieldName := range foldFields {
+		_, indexed := indexFields[fieldName]
+		for _, compositeFields := range compositeIndexes {
+			indexed = indexed || containsString(compositeFields, fieldName)
+		}
+		if !indexed {
+			return nil, IndexDefinitionError{IndexName: fieldName, Reason: "fold requires the index option"}
+		}
+		fieldType := typeOfStruct.FieldByIndex(fieldMap[fieldName]).Type
+		if multiValueFields[fieldName] {
+			fieldType = fieldType.Elem()
+		}
+		if fieldType.Kind() != reflect.String {
+			return nil, IndexDefinitionError{IndexName: fieldName, Reason: "fold requires a string field"}
+		}
+		encoders[fieldName] = foldEncoder(encoders[fieldName])
+	}
+	for fieldName := range fulltextFields {
+		if typeOfStruct.FieldByIndex(fieldMap[fieldName]).Type.Kind() != reflect.String {
+			return nil, IndexDefinitionError{IndexName: fieldName, Reason: "fulltext requires a string field"}
+		}
+	}
+	for indexName, fieldNames := range compositeIndexes {
+		if indexName == "" || strings.HasPrefix(indexName, "__") {
+			return nil, IndexDefinitionError{IndexName: indexName, Reason: "name cannot be empty or start with __"}
+		}
+		if _, exists := fieldMap[indexName]; exists {
+			return nil, IndexDefinitionError{IndexName: indexName, Reason: "name is already used by a field"}
+		}
+		for _, fieldName := range fieldNames {
+			if _, exists := encoders[fieldName]; !exists || multiValueFields[fieldName] {
+				return nil, IndexFieldTypeError{FieldName: fieldName, Type: typeOfStruct.FieldByIndex(fieldMap[fieldName]).Type.String()}
+			}
 		}
-		_ = fieldName // avoid unused variable
 	}
 
 	btreeIndexes := make(map[string]*bTree)
 	for fieldName := range indexFields {
 		btreeIndexes[fieldName] = newBTree(32) // default branching factor
 	}
+	for indexName := range compositeIndexes {
+		btreeIndexes[indexName] = newBTree(32)
+	}
+	for fieldName := range fulltextFields {
+		btreeIndexes[fulltextIndexName(fieldName)] = newBTree(32)
+	}
 	btreeIndexes[primaryKeyIndexName] = newBTree(32) // primary key index
 
-	store := &Store[T]{
-		database:    database,
-		bucket:      []byte(bucketName),
-		keyField:    keyFieldIndex,
-		indexFields: indexFields,
-		fieldMap:    fieldMap,
-		indexes:     btreeIndexes,
+	var settings storeOptions
+	for _, option := range options {
+		option(&settings)
 	}
 
-	// Register indexes with DB for serialization on flush
-	bucketPrefix := bucketName + ":"
-	for indexName, btree := range btreeIndexes {
-		indexKey := buildBTreeKey(bucketPrefix, indexName)
-		database.indexesMutex.Lock()
-		database.indexes[indexKey] = btree
-		database.indexesMutex.Unlock()
+	store := &Store[T]{
+		database:         database,
+		bucket:           []byte(bucketName),
+		keyField:         keyFieldIndex,
+		versionField:     versionFieldIndex,
+		indexFields:      indexFields,
+		compositeIndexes: compositeIndexes,
+		uniqueFields:     uniqueFields,
+		foldFields:       foldFields,
+		fulltextFields:   fulltextFields,
+		partialIndexes:   make(map[string]PartialIndex),
+		fieldMap:         fieldMap,
+		encoders:         encoders,
+		multiValueFields: multiValueFields,
+		indexes:          btreeIndexes,
+	}
+	for _, partial := range settings.partialIndexes {
+		if err := store.addPartialIndex(partial); err != nil {
+			return nil, err
+		}
 	}
 
 	// Load persisted B-tree indexes
+	bucketPrefix := bucketName + ":"
 	if err := store.loadBTreeIndexes(); err != nil {
 		return nil, fmt.Errorf("failed to load B-tree indexes: %w", err)
 	}
@@ -153,6 +303,16 @@ func NewStore[T any](database *DB, bucketName string) (*Store[T], error) {
 		}
 	}
 
+	// Register indexes with DB for serialization on flush, after loading replaced them
+	database.indexesMutex.Lock()
+	for indexName, btree := range store.indexes {
+		if indexName != primaryKeyIndexName {
+			btree.signature = store.indexSignature(indexName)
+		}
+		database.indexes[buildBTreeKey(bucketPrefix, indexName)] = btree
+	}
+	database.indexesMutex.Unlock()
+
 	return store, nil
 }
 
@@ -185,24 +345,28 @@ func (s *Store[T]) loadBTreeIndexes() error {
 		}
 
 		// Load secondary key indexes
-		for fieldName := range s.indexFields {
+		for _, indexName := range s.secondaryIndexNames() {
 			var secondaryData []byte
 			if bucket != nil {
-				secondaryKey := buildBTreeKey(bucketPrefix, fieldName)
+				secondaryKey := buildBTreeKey(bucketPrefix, indexName)
 				secondaryData = bucket.Get([]byte(secondaryKey))
 			}
 			if secondaryData == nil {
 				// No persisted index, rebuild from database
-				s.rebuildSecondaryIndex(fieldName, transaction)
+				s.rebuildSecondaryIndex(indexName, transaction)
 			} else {
 				btree, err := deserializeBTree(secondaryData)
-				if err == nil {
-					s.indexes[fieldName] = btree
+				if err == nil && btree.signature != s.indexSignature(indexName) {
+					// The index was written for another definition or encoding of its values
+					s.database.Logger().Infof("Rebuilding B-tree for index %s, its definition changed", indexName)
+					s.rebuildSecondaryIndex(indexName, transaction)
+				} else if err == nil {
+					s.indexes[indexName] = btree
 				} else {
 					// Log error but continue
-					s.database.Logger().Warningf("Failed to load persisted B-tree for field %s: %v", fieldName, err)
+					s.database.Logger().Warningf("Failed to load persisted B-tree for index %s: %v", indexName, err)
 					// Rebuild index from database
-					s.rebuildSecondaryIndex(fieldName, transaction)
+					s.rebuildSecondaryIndex(indexName, transaction)
 				}
 			}
 		}
@@ -210,19 +374,377 @@ func (s *Store[T]) loadBTreeIndexes() error {
 	})
 }
 
+// keyLock is the lock of a single key, removed once no writer holds or waits for it
+type keyLock struct {
+	mutex sync.Mutex
+	users int // writers holding or waiting for the lock, guarded by keyLocksMutex
+}
+
+// lockKey locks key and returns the function that unlocks it.
+// Only writes to the same key wait for each other.
+func (s *Store[T]) lockKey(key string) func() {
+	s.keyLocksMutex.Lock()
+	if s.keyLocks == nil {
+		s.keyLocks = make(map[string]*keyLock)
+	}
+	lock, exists := s.keyLocks[key]
+	if !exists {
+		lock = &keyLock{}
+		s.keyLocks[key] = lock
+	}
+	lock.users++
+	s.keyLocksMutex.Unlock()
+
+	lock.mutex.Lock()
+	return func() {
+		lock.mutex.Unlock()
+		s.keyLocksMutex.Lock()
+		lock.users--
+		if lock.users == 0 {
+			delete(s.keyLocks, key)
+		}
+		s.keyLocksMutex.Unlock()
+	}
+}
+
+// lockKeys locks all keys in sorted order and returns the function that unlocks them
+func (s *Store[T]) lockKeys(keys []string) func() {
+	sorted := append([]string(nil), keys...)
+	sort.Strings(sorted)
+	unlocks := make([]func(), 0, len(sorted))
+	for i, key := range sorted {
+		if i > 0 && key == sorted[i-1] {
+			continue
+		}
+		unlocks = append(unlocks, s.lockKey(key))
+	}
+	return func() {
+		for i := len(unlocks) - 1; i >= 0; i-- {
+			unlocks[i]()
+		}
+	}
+}
+
+// exists returns true if a record is stored under key, taking pending writes into account
+func (s *Store[T]) exists(key string) bool {
+	if operation, buffered := s.database.getLatestBufferedOperation(s.bucket, key); buffered {
+		return operation.Type == OperationPut
+	}
+	return s.indexes[primaryKeyIndexName].search(key) != nil
+}
+
+// isIntegerKind returns true for the signed and unsigned integer kinds
+func isIntegerKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// version returns the value of the version field, or 0 if the store is not versioned
+func (s *Store[T]) version(value T) uint64 {
+	if s.versionField < 0 {
+		return 0
+	}
+	field := reflect.ValueOf(value).Field(s.versionField)
+	if field.CanInt() {
+		return uint64(field.Int())
+	}
+	return field.Uint()
+}
+
+// setVersion sets the version field of value
+func (s *Store[T]) setVersion(value *T, version uint64) {
+	field := reflect.ValueOf(value).Elem().Field(s.versionField)
+	if field.CanInt() {
+		field.SetInt(int64(version))
+	} else {
+		field.SetUint(version)
+	}
+}
+
+// indexChange is a pending insert or delete of a single B-tree index entry
+type indexChange struct {
+	index  *bTree
+	value  string // indexed value
+	key    string // record key
+	delete bool
+	unique *uniqueField // set for changes to a unique index
+}
+
+// apply makes the change to the index
+func (c indexChange) apply() {
+	if c.delete {
+		c.index.delete(c.value, c.key)
+	} else {
+		c.index.insert(c.value, c.key)
+	}
+}
+
+// revert undoes an applied change
+func (c indexChange) revert() {
+	if c.delete {
+		c.index.insert(c.value, c.key)
+	} else {
+		c.index.delete(c.value, c.key)
+	}
+}
+
+// planPut returns the operation and index changes that store value under key, replacing oldValue if it exists
+func (s *Store[T]) planPut(key string, value T, oldValue T, oldExists bool) (operation, []indexChange, []string, error) {
+	// Every put moves the record to the version after the stored one
+	if s.versionField >= 0 {
+		storedVersion := uint64(0)
+		if oldExists {
+			storedVersion = s.version(oldValue)
+		}
+		s.setVersion(&value, storedVersion+1)
+	}
+
+	data, err := msgpack.Marshal(value)
+	if err != nil {
+		s.database.Logger().Errorf("Failed to marshal value for key %s in bucket %s: %v", key, s.bucket, err)
+		return operation{}, nil, nil, WrappedError{Operation: "marshal", Bucket: string(s.bucket), Key: key, Err: err}
+	}
+
+	var oldIndexValues map[string][]string
+	if oldExists {
+		oldIndexValues = s.extractIndexValues(oldValue)
+	} else {
+		oldIndexValues = make(map[string][]string)
+	}
+	newIndexValues := s.extractIndexValues(value)
+
+	// Primary key is always marked modified, but only a new record adds an entry
+	var changes []indexChange
+	modifiedIndexes := []string{s.indexKey(primaryKeyIndexName)}
+	if !oldExists {
+		changes = append(changes, indexChange{index: s.indexes[primaryKeyIndexName], value: key, key: key})
+	}
+	for name, newValues := range newIndexValues {
+		removed, added := diffIndexValues(oldIndexValues[name], newValues)
+		if len(removed) == 0 && len(added) == 0 {
+			continue
+		}
+		for _, oldIndexValue := range removed {
+			changes = append(changes, indexChange{index: s.indexes[name], value: oldIndexValue, key: key, delete: true, unique: s.uniqueField(name, oldValue)})
+		}
+		for _, newIndexValue := range added {
+			changes = append(changes, indexChange{index: s.indexes[name], value: newIndexValue, key: key, unique: s.uniqueField(name, value)})
+		}
+		modifiedIndexes = append(modifiedIndexes, s.indexKey(name))
+	}
+
+	return operation{Bucket: s.bucket, Key: key, Value: data, Type: OperationPut}, changes, modifiedIndexes, nil
+}
+
+// planDelete returns the operation and index changes that remove the record oldValue stored under key
+func (s *Store[T]) planDelete(key string, oldValue T, oldExists bool) (operation, []indexChange, []string) {
+	changes := []indexChange{{index: s.indexes[primaryKeyIndexName], value: key, key: key, delete: true}}
+	modifiedIndexes := []string{s.indexKey(primaryKeyIndexName)}
+	if oldExists {
+		for name, oldValues := range s.extractIndexValues(oldValue) {
+			for _, oldIndexValue := range oldValues {
+				changes = append(changes, indexChange{index: s.indexes[name], value: oldIndexValue, key: key, delete: true, unique: s.uniqueField(name, oldValue)})
+			}
+			if len(oldValues) > 0 {
+				modifiedIndexes = append(modifiedIndexes, s.indexKey(name))
+			}
+		}
+	}
+	return operation{Bucket: s.bucket, Key: key, Value: nil, Type: OperationDelete}, changes, modifiedIndexes
+}
+
+// indexKey returns the key the named index of this store is serialized under
+func (s *Store[T]) indexKey(name string) string {
+	return buildBTreeKey(string(s.bucket)+":", name)
+}
+
+// indexMarkers returns the operations that mark the given indexes for serialization on flush
+func indexMarkers(indexKeys []string) []operation {
+	markers := make([]operation, len(indexKeys))
+	for i, indexKey := range indexKeys {
+		markers[i] = operation{
+			Bucket: []byte(btreeBucketName),
+			Key:    indexKey,
+			Value:  nil, // Serialized on flush
+			Type:   OperationIndex,
+		}
+	}
+	return markers
+}
+
 // Gather index field values to maintain secondary index consistency
-func (s *Store[T]) extractIndexValues(value T) map[string]string {
+func (s *Store[T]) extractIndexValues(value T) map[string][]string {
 	structValue := reflect.ValueOf(value)
-	result := make(map[string]string)
-	for fieldName, fieldIndex := range s.indexFields {
-		fieldValue := structValue.Field(fieldIndex)
-		if fieldValue.Kind() == reflect.String {
-			result[fieldName] = fieldValue.String()
-		}
+	result := make(map[string][]string, len(s.indexFields)+len(s.compositeIndexes)+len(s.partialIndexes)+len(s.fulltextFields))
+	for fieldName := range s.indexFields {
+		result[fieldName] = s.indexValues(fieldName, s.fieldValue(structValue, fieldName))
+	}
+	for indexName := range s.compositeIndexes {
+		result[indexName] = []string{s.compositeIndexValue(indexName, structValue)}
+	}
+	for indexName := range s.partialIndexes {
+		result[indexName] = s.partialIndexValues(indexName, value)
+	}
+	for fieldName := range s.fulltextFields {
+		result[fulltextIndexName(fieldName)] = s.fulltextIndexValues(fieldName, value)
 	}
 	return result
 }
 
+// diffIndexValues returns the values only in oldValues and the values only in newValues
+func diffIndexValues(oldValues, newValues []string) (removed, added []string) {
+	for _, oldValue := range oldValues {
+		if !containsString(newValues, oldValue) {
+			removed = append(removed, oldValue)
+		}
+	}
+	for _, newValue := range newValues {
+		if !containsString(oldValues, newValue) {
+			added = append(added, newValue)
+		}
+	}
+	return removed, added
+}
+
+// containsString reports whether values holds value
+func containsString(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
+
+// secondaryIndexNames returns the names of the field, composite and partial indexes
+func (s *Store[T]) secondaryIndexNames() []string {
+	names := make([]string, 0, len(s.indexFields)+len(s.compositeIndexes)+len(s.partialIndexes)+len(s.fulltextFields))
+	for fieldName := range s.indexFields {
+		names = append(names, fieldName)
+	}
+	for indexName := range s.compositeIndexes {
+		names = append(names, indexName)
+	}
+	for indexName := range s.partialIndexes {
+		names = append(names, indexName)
+	}
+	for fieldName := range s.fulltextFields {
+		names = append(names, fulltextIndexName(fieldName))
+	}
+	return names
+}
+
+// secondaryIndexValues returns the values a record is stored under in the named field, composite or partial index
+func (s *Store[T]) secondaryIndexValues(indexName string, structValue reflect.Value) []string {
+	if _, composite := s.compositeIndexes[indexName]; composite {
+		return []string{s.compositeIndexValue(indexName, structValue)}
+	}
+	if _, partial := s.partialIndexes[indexName]; partial {
+		return s.partialIndexValues(indexName, structValue.Interface().(T))
+	}
+	if fieldName, fulltext := strings.CutPrefix(indexName, fulltextIndexPrefix); fulltext {
+		return s.fulltextIndexValues(fieldName, structValue.Interface().(T))
+	}
+	return s.indexValues(indexName, s.fieldValue(structValue, indexName))
+}
+
+// fieldValue returns the named field of a struct value, following nested and embedded structs.
+// The returned value is invalid if a nil pointer is on the field's path.
+func (s *Store[T]) fieldValue(structValue reflect.Value, fieldName string) reflect.Value {
+	field, err := structValue.FieldByIndexErr(s.fieldMap[fieldName])
+	if err != nil {
+		return reflect.Value{}
+	}
+	return field
+}
+
+// encodeField encodes the value of the named field, rejecting values missing behind a nil pointer
+func (s *Store[T]) encodeField(fieldName string, fieldValue reflect.Value) (string, bool) {
+	if !fieldValue.IsValid() {
+		return "", false
+	}
+	return s.encoders[fieldName](fieldValue)
+}
+
+// fieldType returns the type of the named field
+func (s *Store[T]) fieldType(fieldName string) reflect.Type {
+	var zero T
+	return reflect.TypeOf(zero).FieldByIndex(s.fieldMap[fieldName]).Type
+}
+
+// nestedStructType returns the struct type a field of type typ holds or points to,
+// or nil if it holds none or the struct is indexed as a whole, like time.Time
+func nestedStructType(typ reflect.Type) reflect.Type {
+	if typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		return nil
+	}
+	if _, exists := lookupIndexEncoder(typ); exists {
+		return nil
+	}
+	return typ
+}
+
+// indexSignatureVersion changes whenever the encoding of index values changes, so persisted indexes are rebuilt
+const indexSignatureVersion = "2"
+
+// indexSignature describes the definition of the named secondary index and how its values are encoded.
+// A persisted index with another signature is rebuilt when the store is opened.
+func (s *Store[T]) indexSignature(indexName string) string {
+	signature := "v" + indexSignatureVersion
+	if fieldNames, composite := s.compositeIndexes[indexName]; composite {
+		signature += " composite"
+		for _, fieldName := range fieldNames {
+			signature += " " + s.fieldSignature(fieldName)
+		}
+		return signature
+	}
+	if partial, exists := s.partialIndexes[indexName]; exists {
+		return signature + " partial " + s.fieldSignature(partial.Field) + fmt.Sprintf(" where %v", partial.Where)
+	}
+	if fieldName, fulltext := strings.CutPrefix(indexName, fulltextIndexPrefix); fulltext {
+		return signature + " fulltext " + s.fieldSignature(fieldName)
+	}
+	return signature + " field " + s.fieldSignature(indexName)
+}
+
+// fieldSignature describes the type and collation of an indexed field
+func (s *Store[T]) fieldSignature(fieldName string) string {
+	signature := fieldName + ":" + s.fieldType(fieldName).String()
+	if s.foldFields[fieldName] {
+		signature += ":fold"
+	}
+	return signature
+}
+
+// indexValues returns the encoded values a field is indexed under, one per distinct element of a slice field.
+// Empty strings are not indexed.
+func (s *Store[T]) indexValues(fieldName string, fieldValue reflect.Value) []string {
+	encoder := s.encoders[fieldName]
+	if !fieldValue.IsValid() {
+		return nil
+	}
+	if !s.multiValueFields[fieldName] {
+		if encoded, _ := encoder(fieldValue); encoded != "" {
+			return []string{encoded}
+		}
+		return nil
+	}
+	var values []string
+	for i := 0; i < fieldValue.Len(); i++ {
+		if encoded, _ := encoder(fieldValue.Index(i)); encoded != "" && !containsString(values, encoded) {
+			values = append(values, encoded)
+		}
+	}
+	return values
+}
+
 // rebuildPrimaryKeyIndex rebuilds the primary key index from the database bucket
 func (s *Store[T]) rebuildPrimaryKeyIndex(transaction *bolt.Tx) {
 	bucket := transaction.Bucket(s.bucket)
@@ -274,14 +796,9 @@ func (s *Store[T]) rebuildIndexes() error {
 			s.indexes[primaryKeyIndexName].insert(key, key)
 
 			// Rebuild secondary indexes
-			structValue := reflect.ValueOf(item)
-			for fieldName, fieldIndex := range s.indexFields {
-				fieldValue := structValue.Field(fieldIndex)
-				if fieldValue.Kind() == reflect.String {
-					indexValue := fieldValue.String()
-					if indexValue != "" {
-						s.indexes[fieldName].insert(indexValue, key)
-					}
+			for indexName, indexValues := range s.extractIndexValues(item) {
+				for _, indexValue := range indexValues {
+					s.indexes[indexName].insert(indexValue, key)
 				}
 			}
 		}
@@ -289,14 +806,13 @@ func (s *Store[T]) rebuildIndexes() error {
 	})
 }
 
-// rebuildSecondaryIndex rebuilds a secondary index for the given field from the database bucket
-func (s *Store[T]) rebuildSecondaryIndex(fieldName string, transaction *bolt.Tx) {
+// rebuildSecondaryIndex rebuilds the named field, composite or partial index from the database bucket
+func (s *Store[T]) rebuildSecondaryIndex(indexName string, transaction *bolt.Tx) {
 	bucket := transaction.Bucket(s.bucket)
 	if bucket == nil {
 		return
 	}
-	fieldIndex, exists := s.indexFields[fieldName]
-	if !exists {
+	if _, exists := s.indexes[indexName]; !exists {
 		return
 	}
 	cursor := bucket.Cursor()
@@ -314,14 +830,9 @@ func (s *Store[T]) rebuildSecondaryIndex(fieldName string, transaction *bolt.Tx)
 			continue
 		}
 		// Extract index value
-		structValue := reflect.ValueOf(item)
-		fieldValue := structValue.Field(fieldIndex)
-		if fieldValue.Kind() == reflect.String {
-			indexValue := fieldValue.String()
-			if indexValue != "" {
-				key := string(k)
-				s.indexes[fieldName].insert(indexValue, key)
-			}
+		key := string(k)
+		for _, indexValue := range s.secondaryIndexValues(indexName, reflect.ValueOf(item)) {
+			s.indexes[indexName].insert(indexValue, key)
 		}
 	}
 }
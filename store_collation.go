@@ -0,0 +1,34 @@
+package nnut
+
+import (
+	"reflect"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// foldString case folds a string and normalizes it to NFKC, so strings that only differ
+// in case or in the Unicode representation of their characters collate equal
+func foldString(value string) string {
+	// Casers keep state between calls and cannot be shared between goroutines
+	return norm.NFKC.String(cases.Fold().String(value))
+}
+
+// foldEncoder wraps the encoder of a string field tagged with fold, folding strings before they are encoded
+func foldEncoder(encoder IndexEncoder) IndexEncoder {
+	return func(value reflect.Value) (string, bool) {
+		if value.Kind() != reflect.String {
+			return encoder(value)
+		}
+		return encoder(reflect.ValueOf(foldString(value.String())).Convert(value.Type()))
+	}
+}
+
+// collate returns the form of a string value of the named field that is compared and indexed,
+// folded if the field is tagged with fold
+func (s *Store[T]) collate(fieldName string, value string) string {
+	if s.foldFields[fieldName] {
+		return foldString(value)
+	}
+	return value
+}
@@ -0,0 +1,202 @@
+package nnut
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// TestContact for testing folded indexes
+type TestContact struct {
+	ID    string   `nnut:"key"`
+	Email string   `nnut:"index,unique,fold"`
+	Name  string   `nnut:"index,fold"`
+	Tags  []string `nnut:"index,fold"`
+	City  string   `nnut:"index:city_name,fold"`
+}
+
+func TestFoldIndexQuery(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	store, err := NewStore[TestContact](db, "contacts")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	ctx := context.Background()
+	contacts := []TestContact{
+		{ID: "a", Email: "Alice@X.com", Name: "adam", Tags: []string{"Go"}, City: "Oslo"},
+		{ID: "b", Email: "bob@x.com", Name: "Zoë", Tags: []string{"go", "DB"}, City: "OSLO"},
+		// Decomposed ë and a fullwidth letter
+		{ID: "c", Email: "cid@x.com", Name: "Zoe\u0308y", Tags: []string{"Ｒust"}, City: "Bergen"},
+		{ID: "d", Email: "dan@x.com", Name: "Beth", City: "bergen"},
+	}
+	if err := store.PutBatch(ctx, contacts); err != nil {
+		t.Fatalf("Failed to put batch: %v", err)
+	}
+	db.Flush()
+
+	tests := []struct {
+		name     string
+		query    *Query
+		expected []string
+	}{
+		{"equals", &Query{Conditions: []Condition{{Field: "Email", Value: "alice@x.COM"}}}, []string{"a"}},
+		{"normalized", &Query{Conditions: []Condition{{Field: "Name", Value: "ZOË"}}}, []string{"b"}},
+		{"in", &Query{Conditions: []Condition{{Field: "Name", Value: []string{"ADAM", "beth"}, Operator: In}}}, []string{"a", "d"}},
+		{"prefix", &Query{Conditions: []Condition{{Field: "Name", Value: "zoë", Operator: HasPrefix}}}, []string{"b", "c"}},
+		{"wildcard", &Query{Conditions: []Condition{{Field: "Email", Value: "ALICE*", Operator: Wildcard}}}, []string{"a"}},
+		{"range", &Query{Conditions: []Condition{{Field: "Name", Value: "C", Operator: GreaterThan}}}, []string{"b", "c"}},
+		{"contains", &Query{Conditions: []Condition{{Field: "Tags", Value: "GO", Operator: Contains}}}, []string{"a", "b"}},
+		{"contains compatibility", &Query{Conditions: []Condition{{Field: "Tags", Value: "rust", Operator: Contains}}}, []string{"c"}},
+		{"composite", &Query{Conditions: []Condition{{Field: "City", Value: "oslo"}}}, []string{"a", "b"}},
+		{"composite prefix", &Query{Conditions: []Condition{{Field: "City", Value: "BERG", Operator: HasPrefix}}}, []string{"c", "d"}},
+		{"not equals", &Query{Filter: Not(Match(Condition{Field: "City", Value: "BERGEN"}))}, []string{"a", "b"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			results, err := store.GetQuery(ctx, test.query)
+			if err != nil {
+				t.Fatalf("Failed to query: %v", err)
+			}
+			keys := make([]string, len(results))
+			for i, result := range results {
+				keys[i] = result.ID
+			}
+			sort.Strings(keys)
+			if fmt.Sprint(keys) != fmt.Sprint(test.expected) {
+				t.Fatalf("Expected %v, got %v", test.expected, keys)
+			}
+		})
+	}
+
+	// Sorting ignores case, and records keep their original values
+	if keys := store.indexes["Name"].getAllKeys(); fmt.Sprint(keys) != fmt.Sprint([]string{"a", "d", "b", "c"}) {
+		t.Fatalf("Expected the index ordered ignoring case, got %v", keys)
+	}
+	results, err := store.GetQuery(ctx, &Query{Index: "Name", Sort: Ascending, Conditions: []Condition{{Field: "ID", Value: "", Operator: NotEquals}}})
+	if err != nil {
+		t.Fatalf("Failed to query: %v", err)
+	}
+	var names []string
+	for _, result := range results {
+		names = append(names, result.Name)
+	}
+	if fmt.Sprint(names) != fmt.Sprint([]string{"adam", "Beth", "Zoë", "Zoe\u0308y"}) {
+		t.Fatalf("Expected names sorted ignoring case, got %q", names)
+	}
+
+	// Unique values are compared folded
+	err = store.Put(ctx, TestContact{ID: "e", Email: "BOB@x.com"})
+	var uniqueErr UniqueConstraintError
+	if !errors.As(err, &uniqueErr) || uniqueErr.Key != "b" || uniqueErr.Value != "BOB@x.com" {
+		t.Fatalf("Expected UniqueConstraintError on b, got %v", err)
+	}
+}
+
+func TestFoldIndexDefinition(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	type foldWithoutIndex struct {
+		ID   string `nnut:"key"`
+		Name string `nnut:"fold"`
+	}
+	if _, err := NewStore[foldWithoutIndex](db, "contacts"); !errors.As(err, &IndexDefinitionError{}) {
+		t.Errorf("Expected IndexDefinitionError for fold without an index, got %v", err)
+	}
+
+	type foldNumber struct {
+		ID  string `nnut:"key"`
+		Age int    `nnut:"index,fold"`
+	}
+	if _, err := NewStore[foldNumber](db, "contacts"); !errors.As(err, &IndexDefinitionError{}) {
+		t.Errorf("Expected IndexDefinitionError for fold on a number field, got %v", err)
+	}
+}
+
+func TestFoldIndexRebuiltOnReopen(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	type plainPerson struct {
+		ID   string `nnut:"key"`
+		Name string `nnut:"index"`
+	}
+	type foldedPerson struct {
+		ID   string `nnut:"key"`
+		Name string `nnut:"index,fold"`
+	}
+	ctx := context.Background()
+
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	plain, err := NewStore[plainPerson](db, "people")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	if err := plain.Put(ctx, plainPerson{ID: "a", Name: "Alice"}); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Failed to close DB: %v", err)
+	}
+
+	count := func(store interface {
+		CountQuery(context.Context, *Query) (int, error)
+	}, name string) int {
+		t.Helper()
+		count, err := store.CountQuery(ctx, &Query{Conditions: []Condition{{Field: "Name", Value: name}}})
+		if err != nil {
+			t.Fatalf("Failed to count: %v", err)
+		}
+		return count
+	}
+
+	// Adding fold to the index rebuilds it with folded values
+	db, err = Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to reopen DB: %v", err)
+	}
+	folded, err := NewStore[foldedPerson](db, "people")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	if count(folded, "alice") != 1 || count(folded, "Alice") != 1 {
+		t.Fatal("Expected the folded index to match regardless of case")
+	}
+	if err := folded.Put(ctx, foldedPerson{ID: "b", Name: "Bob"}); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Failed to close DB: %v", err)
+	}
+
+	// Removing it again restores the raw values
+	db, err = Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to reopen DB: %v", err)
+	}
+	defer db.Close()
+	plain, err = NewStore[plainPerson](db, "people")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	if count(plain, "Alice") != 1 || count(plain, "alice") != 0 || count(plain, "Bob") != 1 {
+		t.Fatal("Expected the index to hold the original values")
+	}
+}
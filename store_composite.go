@@ -0,0 +1,184 @@
+package nnut
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const (
+	compositeEscape    = "\x00\xff" // replaces zero bytes inside a component
+	compositeSeparator = "\x00\x01" // ends every component
+	compositeGroupEnd  = "\x00\x02" // sorts after every entry sharing the components before it
+)
+
+// compositeComponent escapes an encoded value and terminates it, so concatenated components
+// sort by the first component, then the second and so on
+func compositeComponent(encoded string) string {
+	return strings.ReplaceAll(encoded, "\x00", compositeEscape) + compositeSeparator
+}
+
+// compositeIndexValue returns the value a record is stored under in the named composite index.
+// Unlike field indexes every record is indexed, empty strings included.
+func (s *Store[T]) compositeIndexValue(indexName string, structValue reflect.Value) string {
+	var builder strings.Builder
+	for _, fieldName := range s.compositeIndexes[indexName] {
+		encoded, _ := s.encodeField(fieldName, s.fieldValue(structValue, fieldName))
+		builder.WriteString(compositeComponent(encoded))
+	}
+	return builder.String()
+}
+
+// compositePlan is a range of a composite index that answers some conditions of a query
+type compositePlan struct {
+	index   string
+	covered []int // positions of the answered conditions
+	min     string
+	max     string // exclusive, empty means unbounded
+}
+
+// planCompositeIndex picks the composite index answering the most conditions with a single range search.
+// A composite index answers equality conditions on a prefix of its fields followed by at most one range,
+// prefix or equality condition on the next field. It is only used over the field indexes
+// if it answers more than one condition or a condition on a field without its own index.
+func (s *Store[T]) planCompositeIndex(conditions []Condition) (compositePlan, bool) {
+	indexNames := make([]string, 0, len(s.compositeIndexes))
+	for indexName := range s.compositeIndexes {
+		indexNames = append(indexNames, indexName)
+	}
+	sort.Strings(indexNames)
+
+	var best compositePlan
+	for _, indexName := range indexNames {
+		plan := s.planComposite(indexName, conditions)
+		if len(plan.covered) <= len(best.covered) {
+			continue
+		}
+		if len(plan.covered) == 1 {
+			if _, indexed := s.indexFields[conditions[plan.covered[0]].Field]; indexed {
+				continue
+			}
+		}
+		best = plan
+	}
+	return best, len(best.covered) > 0
+}
+
+// planComposite returns the range of the composite index matching the conditions it can answer
+func (s *Store[T]) planComposite(indexName string, conditions []Condition) compositePlan {
+	plan := compositePlan{index: indexName}
+	used := make(map[int]bool)
+	prefix := ""
+	for _, fieldName := range s.compositeIndexes[indexName] {
+		if position, encoded, found := s.findCompositeEquality(fieldName, conditions, used); found {
+			prefix += compositeComponent(encoded)
+			plan.covered = append(plan.covered, position)
+			used[position] = true
+			continue
+		}
+		for position, condition := range conditions {
+			if used[position] || condition.Field != fieldName {
+				continue
+			}
+			if min, max, ok := s.compositeRange(prefix, condition); ok {
+				plan.covered = append(plan.covered, position)
+				plan.min, plan.max = min, max
+				return plan
+			}
+		}
+		break
+	}
+	plan.min, plan.max = prefix, prefixEnd(prefix)
+	return plan
+}
+
+// findCompositeEquality finds an unused condition requiring a single value of the field
+func (s *Store[T]) findCompositeEquality(fieldName string, conditions []Condition, used map[int]bool) (int, string, bool) {
+	for position, condition := range conditions {
+		if used[position] || condition.Field != fieldName {
+			continue
+		}
+		isEquality := condition.Operator == Equals
+		if condition.Operator == Wildcard {
+			pattern, _ := condition.Value.(string)
+			_, isPrefix := wildcardPrefix(pattern)
+			isEquality = !isPrefix
+		}
+		if !isEquality {
+			continue
+		}
+		if encoded, ok := s.conditionIndexValue(fieldName, condition.Value); ok {
+			return position, encoded, true
+		}
+	}
+	return 0, "", false
+}
+
+// compositeRange returns the bounds of the entries starting with prefix whose next component satisfies the condition
+func (s *Store[T]) compositeRange(prefix string, condition Condition) (min, max string, ok bool) {
+	// Entries with the component equal to a value lie in [prefix+start(value), prefix+end(value))
+	start := func(encoded string) string { return prefix + compositeComponent(encoded) }
+	end := func(encoded string) string {
+		return prefix + strings.ReplaceAll(encoded, "\x00", compositeEscape) + compositeGroupEnd
+	}
+
+	switch condition.Operator {
+	case HasPrefix, Wildcard:
+		pattern, _ := condition.Value.(string)
+		if condition.Operator == Wildcard {
+			var isPrefix bool
+			if pattern, isPrefix = wildcardPrefix(pattern); !isPrefix {
+				return "", "", false
+			}
+		}
+		min = prefix + strings.ReplaceAll(s.collate(condition.Field, pattern), "\x00", compositeEscape)
+		return min, prefixEnd(min), true
+	case Between:
+		values, _ := conditionValues(condition.Value)
+		if len(values) != 2 {
+			return "", "", false
+		}
+		lower, lowerOk := s.conditionIndexValue(condition.Field, values[0])
+		upper, upperOk := s.conditionIndexValue(condition.Field, values[1])
+		return start(lower), end(upper), lowerOk && upperOk
+	}
+
+	encoded, ok := s.conditionIndexValue(condition.Field, condition.Value)
+	if !ok {
+		return "", "", false
+	}
+	switch condition.Operator {
+	case GreaterThan:
+		return end(encoded), prefixEnd(prefix), true
+	case GreaterThanOrEqual:
+		return start(encoded), prefixEnd(prefix), true
+	case LessThan:
+		return prefix, start(encoded), true
+	case LessThanOrEqual:
+		return prefix, end(encoded), true
+	}
+	return "", "", false
+}
+
+// getKeysForCompositePlan returns the keys in the planned range of the composite index
+func (s *Store[T]) getKeysForCompositePlan(plan compositePlan, maxKeys int) []string {
+	if plan.min != "" && plan.max != "" && plan.min >= plan.max {
+		return nil
+	}
+	return s.indexes[plan.index].rangeSearchLimit(plan.min, plan.max, true, false, maxKeys)
+}
+
+// uncoveredPositions returns the positions from 0 to count that the plan does not answer
+func (p compositePlan) uncoveredPositions(count int) []int {
+	covered := make(map[int]bool, len(p.covered))
+	for _, position := range p.covered {
+		covered[position] = true
+	}
+	var positions []int
+	for position := 0; position < count; position++ {
+		if !covered[position] {
+			positions = append(positions, position)
+		}
+	}
+	return positions
+}
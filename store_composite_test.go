@@ -0,0 +1,232 @@
+package nnut
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// TestEvent for testing composite indexes
+type TestEvent struct {
+	ID      string `nnut:"key"`
+	Tenant  string `nnut:"index:tenant_created"`
+	Created int64  `nnut:"index:tenant_created"`
+	Kind    string `nnut:"index"`
+	Title   string
+}
+
+func TestCompositeIndexQuery(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	store, err := NewStore[TestEvent](db, "events")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	// Tenants that are prefixes of each other and contain zero bytes must not mix
+	var events []TestEvent
+	for i, tenant := range []string{"acme", "acme2", "ac", "acme\x00", ""} {
+		for created := int64(-2); created <= 2; created++ {
+			events = append(events, TestEvent{
+				ID:      fmt.Sprintf("e%d_%d", i, created+2),
+				Tenant:  tenant,
+				Created: created,
+				Kind:    []string{"click", "view"}[created&1],
+				Title:   fmt.Sprintf("title %d", created+2),
+			})
+		}
+	}
+	if err := store.PutBatch(context.Background(), events); err != nil {
+		t.Fatalf("Failed to put batch: %v", err)
+	}
+	db.Flush()
+
+	tests := []struct {
+		name       string
+		conditions []Condition
+		covered    int
+	}{
+		{"equality prefix", []Condition{{Field: "Tenant", Value: "acme"}}, 1},
+		{"empty tenant", []Condition{{Field: "Tenant", Value: ""}}, 1},
+		{"both equal", []Condition{{Field: "Tenant", Value: "acme"}, {Field: "Created", Value: 1}}, 2},
+		{"greater than", []Condition{{Field: "Created", Value: 0, Operator: GreaterThan}, {Field: "Tenant", Value: "acme"}}, 2},
+		{"greater than or equal", []Condition{{Field: "Tenant", Value: "acme"}, {Field: "Created", Value: 0, Operator: GreaterThanOrEqual}}, 2},
+		{"less than", []Condition{{Field: "Tenant", Value: "ac"}, {Field: "Created", Value: -1, Operator: LessThan}}, 2},
+		{"less than or equal", []Condition{{Field: "Tenant", Value: "acme\x00"}, {Field: "Created", Value: -1, Operator: LessThanOrEqual}}, 2},
+		{"between", []Condition{{Field: "Tenant", Value: "acme2"}, {Field: "Created", Value: []int{-1, 1}, Operator: Between}}, 2},
+		{"empty between", []Condition{{Field: "Tenant", Value: "acme2"}, {Field: "Created", Value: []int{1, -1}, Operator: Between}}, 2},
+		{"tenant prefix", []Condition{{Field: "Tenant", Value: "acme", Operator: HasPrefix}}, 1},
+		{"tenant range", []Condition{{Field: "Tenant", Value: "acme", Operator: LessThan}}, 1},
+		{"with field index", []Condition{{Field: "Tenant", Value: "acme"}, {Field: "Created", Value: -2, Operator: GreaterThan}, {Field: "Kind", Value: "view"}}, 2},
+		{"with scan", []Condition{{Field: "Tenant", Value: "acme"}, {Field: "Created", Value: 2, Operator: LessThan}, {Field: "Title", Value: "title 1"}}, 2},
+		{"range not first", []Condition{{Field: "Created", Value: 0}}, 0},
+		{"field index only", []Condition{{Field: "Kind", Value: "view"}}, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			plan, planned := store.planCompositeIndex(test.conditions)
+			if len(plan.covered) != test.covered || planned != (test.covered > 0) {
+				t.Fatalf("Expected composite index to answer %d conditions, got %+v", test.covered, plan)
+			}
+
+			var expected []string
+			for _, event := range events {
+				matches := true
+				for _, condition := range test.conditions {
+					matches = matches && store.matchesCondition(event, condition)
+				}
+				if matches {
+					expected = append(expected, event.ID)
+				}
+			}
+
+			results, err := store.GetQuery(context.Background(), &Query{Conditions: test.conditions})
+			if err != nil {
+				t.Fatalf("Failed to query: %v", err)
+			}
+			expectEventKeys(t, results, expected)
+
+			// The same conditions ANDed in a filter expression
+			var expressions []Expression
+			for _, condition := range test.conditions {
+				expressions = append(expressions, Match(condition))
+			}
+			results, err = store.GetQuery(context.Background(), &Query{Filter: And(expressions...)})
+			if err != nil {
+				t.Fatalf("Failed to query: %v", err)
+			}
+			expectEventKeys(t, results, expected)
+		})
+	}
+}
+
+func TestCompositeIndexMaintenance(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+
+	store, err := NewStore[TestEvent](db, "events")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if err := store.Put(ctx, TestEvent{ID: fmt.Sprintf("e%d", i), Tenant: "acme", Created: int64(i)}); err != nil {
+			t.Fatalf("Failed to put: %v", err)
+		}
+	}
+	if err := store.Put(ctx, TestEvent{ID: "e1", Tenant: "acme", Created: 10}); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if err := store.Delete(ctx, "e0"); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+
+	query := &Query{Conditions: []Condition{{Field: "Tenant", Value: "acme"}, {Field: "Created", Value: 5, Operator: GreaterThan}}}
+	check := func(store *Store[TestEvent]) {
+		t.Helper()
+		if count := store.indexes["tenant_created"].countKeys(); count != 2 {
+			t.Fatalf("Expected 2 composite index entries, got %d", count)
+		}
+		results, err := store.GetQuery(ctx, query)
+		if err != nil {
+			t.Fatalf("Failed to query: %v", err)
+		}
+		expectEventKeys(t, results, []string{"e1"})
+	}
+	check(store)
+
+	// The composite index is persisted and loaded on reopen
+	if err := db.Close(); err != nil {
+		t.Fatalf("Failed to close DB: %v", err)
+	}
+	db, err = Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to reopen DB: %v", err)
+	}
+	defer db.Close()
+	store, err = NewStore[TestEvent](db, "events")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	check(store)
+}
+
+func TestCompositeIndexDefinition(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	// A field can be indexed on its own and in composite indexes
+	type multiIndexed struct {
+		ID     string `nnut:"key"`
+		Tenant string `nnut:"index,index:by_tenant"`
+		Name   string `nnut:"index:by_tenant"`
+	}
+	store, err := NewStore[multiIndexed](db, "multi")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	if fields := store.compositeIndexes["by_tenant"]; len(fields) != 2 || fields[0] != "Tenant" || fields[1] != "Name" {
+		t.Fatalf("Expected composite index over Tenant and Name, got %v", fields)
+	}
+	if _, indexed := store.indexFields["Tenant"]; !indexed {
+		t.Fatal("Expected Tenant to keep its own index")
+	}
+
+	type fieldName struct {
+		ID   string `nnut:"key"`
+		Name string `nnut:"index:Name"`
+	}
+	if _, err := NewStore[fieldName](db, "field_name"); !errors.As(err, &IndexDefinitionError{}) {
+		t.Errorf("Expected IndexDefinitionError for a composite index named like a field, got %v", err)
+	}
+
+	type emptyName struct {
+		ID   string `nnut:"key"`
+		Name string `nnut:"index:"`
+	}
+	if _, err := NewStore[emptyName](db, "empty_name"); !errors.As(err, &IndexDefinitionError{}) {
+		t.Errorf("Expected IndexDefinitionError for an empty composite index name, got %v", err)
+	}
+
+	type unsupportedType struct {
+		ID   string   `nnut:"key"`
+		Tags []string `nnut:"index:by_tags"`
+	}
+	if _, err := NewStore[unsupportedType](db, "unsupported"); !errors.As(err, &IndexFieldTypeError{}) {
+		t.Errorf("Expected IndexFieldTypeError, got %v", err)
+	}
+}
+
+func expectEventKeys(t *testing.T, results []TestEvent, expected []string) {
+	t.Helper()
+	keys := make([]string, len(results))
+	for i, result := range results {
+		keys[i] = result.ID
+	}
+	sort.Strings(keys)
+	sort.Strings(expected)
+	if fmt.Sprint(keys) != fmt.Sprint(expected) {
+		t.Fatalf("Expected %v, got %v", expected, keys)
+	}
+}
@@ -15,12 +15,7 @@ func (s *Store[T]) Count(ctx context.Context) (int, error) {
 		return 0, ctx.Err()
 	default:
 	}
-	err := s.database.View(func(transaction *bbolt.Tx) error {
-		bucket := transaction.Bucket(s.bucket)
-		if bucket == nil {
-			count = 0
-			return nil
-		}
+	err := s.view(func(transaction *bbolt.Tx) error {
 		// Primary key index is always up to date with buffered operations
 		count = s.indexes[primaryKeyIndexName].countKeys()
 		return nil
@@ -30,7 +25,7 @@ func (s *Store[T]) Count(ctx context.Context) (int, error) {
 
 // CountQuery returns the number of records matching the query conditions.
 // More efficient than GetQuery when only the count is needed.
-// Supports the same query options as GetQuery.
+// Counts the records GetQuery returns for the query, without Offset and Limit.
 func (s *Store[T]) CountQuery(ctx context.Context, query *Query) (int, error) {
 	if err := s.validateQuery(query); err != nil {
 		return 0, err
@@ -42,57 +37,15 @@ func (s *Store[T]) CountQuery(ctx context.Context, query *Query) (int, error) {
 		return 0, ctx.Err()
 	default:
 	}
-	err := s.database.View(func(transaction *bbolt.Tx) error {
-		bucket := transaction.Bucket(s.bucket)
-		if bucket == nil {
-			count = 0
-			return nil
-		}
-
-		// Collect candidate keys from conditions
-		if len(query.Conditions) > 0 {
-			candidateKeys := s.getCandidateKeysTx(transaction, query.Conditions, 0)
-			count = len(candidateKeys)
-
-			// Apply buffered operations to get accurate count
-			// Note: Put operations are already reflected in candidateKeys via index updates
-			// We only need to handle Delete operations that remove keys from results
-			bufferedOperations := s.database.getBufferedOperationsForBucket(s.bucket)
-			for _, operation := range bufferedOperations {
-				if operation.Type == OperationDelete {
-					// For Delete operations, check if the key was in our candidates
-					for _, candidateKey := range candidateKeys {
-						if operation.Key == candidateKey {
-							count-- // Existing key being deleted that matched conditions
-							break
-						}
-					}
-				}
-			}
-			return nil
-		} else if query.Index != "" {
-			// No conditions, but index, count from index
-			// Note: B-tree indexes are updated immediately for buffered operations,
-			// so CountKeys() already reflects buffered Puts
-			count = s.indexes[query.Index].countKeys()
-
-			// Apply buffered operations to get accurate count
-			// We only need to handle Delete operations that remove keys from the index
-			bufferedOperations := s.database.getBufferedOperationsForBucket(s.bucket)
-			for _, operation := range bufferedOperations {
-				if operation.Type == OperationDelete {
-					// For Delete operations, check if the key exists in the index
-					if s.indexes[query.Index].search(operation.Key) != nil {
-						count-- // Existing key being deleted from index
-					}
-				}
-			}
+	err := s.view(func(transaction *bbolt.Tx) error {
+		if !query.filtered() {
+			// Every record matches, and the primary key index is up to date with buffered operations
+			count = s.indexes[primaryKeyIndexName].countKeys()
 			return nil
 		}
 
-		// No conditions, no index, count all keys
-		// Primary key index is always up to date with buffered operations
-		count = s.indexes[primaryKeyIndexName].countKeys()
+		// Count the records GetQuery returns, ignoring Offset and Limit
+		count = len(s.matchingKeysTx(transaction, query, 0, s.bufferedOperationsForBucket()))
 		return nil
 	})
 	return count, err
@@ -8,75 +8,81 @@ import (
 
 // Delete removes a single record by its key.
 func (s *Store[T]) Delete(ctx context.Context, key string) error {
+	if err := s.checkWritable(); err != nil {
+		return err
+	}
+
 	// Check primary key index first for fast rejection
 	if s.indexes[primaryKeyIndexName].search(key) == nil {
 		return nil
 	}
 
 	s.database.Logger().Debugf("Deleting record with key %s from bucket %s", key, s.bucket)
+	unlock := s.lockKey(key)
+	defer unlock()
+
 	// Retrieve existing value to update indexes correctly
-	var oldIndexValues map[string]string
 	oldValue, err := s.Get(ctx, key)
-	if err == nil {
-		oldIndexValues = s.extractIndexValues(oldValue)
-	} else {
-		oldIndexValues = make(map[string]string)
-	}
+	dataOperation, indexChanges, modifiedIndexes := s.planDelete(key, oldValue, err == nil)
 
-	// Update primary key index
-	s.indexes[primaryKeyIndexName].delete(key, key)
+	// Create operations: data operation + index operations
+	ops := append([]operation{dataOperation}, indexMarkers(modifiedIndexes)...)
+	return s.database.writeWithIndexChanges(ctx, ops, indexChanges)
+}
 
-	// Update B-tree indexes
-	for name := range s.indexFields {
-		oldValue := oldIndexValues[name]
-		if oldValue != "" {
-			s.indexes[name].delete(oldValue, key)
-		}
+// DeleteTx removes a single record by its key as part of a transaction.
+// The record is only removed when the transaction commits, with the index entries of the record stored at that time.
+func (s *Store[T]) DeleteTx(tx *Tx, key string) error {
+	if err := s.checkWritable(); err != nil {
+		return err
 	}
 
-	// Collect modified indexes for buffering
-	modifiedIndexes := []string{primaryKeyIndexName} // Primary key is always modified
-	for name := range s.indexFields {
-		if oldIndexValues[name] != "" {
-			modifiedIndexes = append(modifiedIndexes, name)
+	oldValue, err := s.GetTx(tx, key)
+	if err != nil {
+		if _, notFound := err.(KeyNotFoundError); notFound {
+			return nil
 		}
+		return err
 	}
 
-	// Create operations: data operation + index operations
-	ops := make([]operation, 1+len(modifiedIndexes))
-	ops[0] = operation{
-		Bucket: s.bucket,
-		Key:    key,
-		Value:  nil,
-		Type:   OperationDelete,
-	}
-
-	for i, indexName := range modifiedIndexes {
-		ops[i+1] = operation{
-			Bucket: []byte(btreeBucketName),
-			Key:    buildBTreeKey(string(s.bucket)+":", indexName),
-			Value:  nil, // Serialized on flush
-			Type:   OperationIndex,
+	s.database.Logger().Debugf("Deleting record with key %s from bucket %s in transaction", key, s.bucket)
+	plan := func() (operation, []indexChange, []string, error) {
+		oldValue, err := s.GetTx(tx, key)
+		if err != nil {
+			if _, notFound := err.(KeyNotFoundError); notFound {
+				// Deleted outside the transaction in the meantime, there are no index entries to remove
+				return operation{Bucket: s.bucket, Key: key, Type: OperationDelete}, nil, nil, nil
+			}
+			return operation{}, nil, nil, err
 		}
+		dataOperation, changes, modified := s.planDelete(key, oldValue, true)
+		return dataOperation, changes, modified, nil
 	}
-
-	return s.database.writeOperations(ctx, ops)
+	dataOperation, _, _ := s.planDelete(key, oldValue, true)
+	return tx.add(dataOperation, txPlan{store: s, bucket: string(s.bucket), key: key, plan: plan})
 }
 
 // DeleteBatch removes multiple records by their keys.
 // More efficient than calling Delete multiple times.
 func (s *Store[T]) DeleteBatch(ctx context.Context, keys []string) error {
+	if err := s.checkWritable(); err != nil {
+		return err
+	}
+
 	s.database.Logger().Debugf("Deleting batch of %d records from bucket %s", len(keys), s.bucket)
 
-	// Collect all index operations for batching
-	indexDeletes := make(map[string][]bTreeItem)
+	// Hold the keys so index entries are removed against the values they were read with
+	unlock := s.lockKeys(keys)
+	defer unlock()
 
 	// Collect keys that exist in primary index
 	var candidateKeys []string
+	seen := make(map[string]bool, len(keys))
 	for _, key := range keys {
-		if s.indexes[primaryKeyIndexName].search(key) != nil {
+		if !seen[key] && s.indexes[primaryKeyIndexName].search(key) != nil {
 			candidateKeys = append(candidateKeys, key)
 		}
+		seen[key] = true
 	}
 
 	// Get old values for all candidate keys (handles buffer and DB)
@@ -85,61 +91,39 @@ func (s *Store[T]) DeleteBatch(ctx context.Context, keys []string) error {
 		return err
 	}
 
-	// Build operations and update indexes
+	// Build operations and index changes for each record
 	var operations []operation
+	var indexChanges []indexChange
+	modifiedIndexes := make(map[string]bool)
 	for _, key := range candidateKeys {
-		if oldVal, exists := oldValuesMap[key]; exists {
-			oldIndexValues := s.extractIndexValues(oldVal)
-
-			// Update primary key index
-			s.indexes[primaryKeyIndexName].delete(key, key)
-
-			// Collect B-tree index operations for batching
-			for name := range s.indexFields {
-				oldIdxVal := oldIndexValues[name]
-				if oldIdxVal != "" {
-					indexDeletes[name] = append(indexDeletes[name], bTreeItem{Key: oldIdxVal, Value: key})
-				}
-			}
+		oldValue, exists := oldValuesMap[key]
+		dataOperation, changes, modified := s.planDelete(key, oldValue, exists)
+		operations = append(operations, dataOperation)
+		indexChanges = append(indexChanges, changes...)
+		for _, indexKey := range modified {
+			modifiedIndexes[indexKey] = true
 		}
-
-		operations = append(operations, operation{
-			Bucket: s.bucket,
-			Key:    key,
-			Value:  nil,
-			Type:   OperationDelete,
-		})
-	}
-
-	// Apply batched index operations
-	for name, items := range indexDeletes {
-		s.indexes[name].bulkDelete(items)
 	}
-
-	// Collect modified indexes for buffering
-	modifiedIndexes := make(map[string]bool)
-	modifiedIndexes[primaryKeyIndexName] = true // Primary key is always modified
-	for name := range indexDeletes {
-		modifiedIndexes[name] = true
+	if len(operations) == 0 {
+		return nil
 	}
 
-	// Create index operations
-	for indexName := range modifiedIndexes {
-		operations = append(operations, operation{
-			Bucket: []byte(btreeBucketName),
-			Key:    buildBTreeKey(string(s.bucket)+":", indexName),
-			Value:  nil, // Serialized on flush
-			Type:   OperationIndex,
-		})
+	indexKeys := make([]string, 0, len(modifiedIndexes))
+	for indexKey := range modifiedIndexes {
+		indexKeys = append(indexKeys, indexKey)
 	}
-
-	return s.database.writeOperations(ctx, operations)
+	operations = append(operations, indexMarkers(indexKeys)...)
+	return s.database.writeWithIndexChanges(ctx, operations, indexChanges)
 }
 
 // DeleteQuery deletes records matching the query conditions.
 // Returns the number of records deleted.
 // Supports the same query options as GetQuery for filtering and pagination.
 func (s *Store[T]) DeleteQuery(ctx context.Context, query *Query) (int, error) {
+	if err := s.checkWritable(); err != nil {
+		return 0, err
+	}
+
 	if err := s.validateQuery(query); err != nil {
 		return 0, err
 	}
@@ -150,101 +134,17 @@ func (s *Store[T]) DeleteQuery(ctx context.Context, query *Query) (int, error) {
 		return 0, ctx.Err()
 	default:
 	}
-	err := s.database.View(func(transaction *bbolt.Tx) error {
-		// Determine the maximum number of keys needed based on limit and offset
-		maxKeys := 0
-		if query.Limit > 0 {
-			maxKeys = query.Offset + query.Limit
-		}
-
-		// Gather keys that potentially match the query conditions
-		var candidateKeys []string
-		if len(query.Conditions) > 0 {
-			candidateKeys = s.getCandidateKeysTx(transaction, query.Conditions, maxKeys)
-		} else if query.Index != "" {
-			// When no conditions but sorting is required, use the index directly
-			candidateKeys = s.getKeysFromIndexTx(transaction, query.Index, query.Sort, maxKeys)
-		} else {
-			// Fallback to scanning all keys when no optimizations apply
-			candidateKeys = s.getAllKeysTx(transaction, maxKeys)
-		}
-
-		// Skip offset and take only limit number of keys
-		start := query.Offset
-		if start > len(candidateKeys) {
-			start = len(candidateKeys)
-		}
-		end := len(candidateKeys)
-		if query.Limit > 0 && start+query.Limit < end {
-			end = start + query.Limit
-		}
-		keysToDelete = candidateKeys[start:end]
-
+	err := s.view(func(transaction *bbolt.Tx) error {
+		// Select the keys of the page like GetQuery does
+		keysToDelete = s.queryPageTx(transaction, query, s.bufferedOperationsForBucket())
 		return nil
 	})
 	if err != nil {
 		return 0, err
 	}
 
-	// Get old values for all keys to delete (handles buffer and DB)
-	oldValuesMap, err := s.GetBatch(ctx, keysToDelete)
-	if err != nil {
-		return 0, err
-	}
-
-	// Collect all index operations for batching
-	indexDeletes := make(map[string][]bTreeItem)
-
-	// Build operations and update indexes
-	var operations []operation
-	for _, key := range keysToDelete {
-		if oldVal, exists := oldValuesMap[key]; exists {
-			oldIndexValues := s.extractIndexValues(oldVal)
-
-			// Update primary key index
-			s.indexes[primaryKeyIndexName].delete(key, key)
-
-			// Collect B-tree index operations for batching
-			for name := range s.indexFields {
-				oldIdxVal := oldIndexValues[name]
-				if oldIdxVal != "" {
-					indexDeletes[name] = append(indexDeletes[name], bTreeItem{Key: oldIdxVal, Value: key})
-				}
-			}
-		}
-
-		operations = append(operations, operation{
-			Bucket: s.bucket,
-			Key:    key,
-			Value:  nil,
-			Type:   OperationDelete,
-		})
-	}
-
-	// Apply batched index operations
-	for name, items := range indexDeletes {
-		s.indexes[name].bulkDelete(items)
-	}
-
-	// Collect modified indexes for buffering
-	modifiedIndexes := make(map[string]bool)
-	modifiedIndexes[primaryKeyIndexName] = true // Primary key is always modified
-	for name := range indexDeletes {
-		modifiedIndexes[name] = true
-	}
-
-	// Create index operations
-	for indexName := range modifiedIndexes {
-		operations = append(operations, operation{
-			Bucket: []byte(btreeBucketName),
-			Key:    buildBTreeKey(string(s.bucket)+":", indexName),
-			Value:  nil, // Serialized on flush
-			Type:   OperationIndex,
-		})
-	}
-
-	err = s.database.writeOperations(ctx, operations)
-	if err != nil {
+	// DeleteBatch locks the selected keys before reading the values whose index entries it removes
+	if err := s.DeleteBatch(ctx, keysToDelete); err != nil {
 		return 0, err
 	}
 
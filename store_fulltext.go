@@ -0,0 +1,154 @@
+package nnut
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// fulltextIndexPrefix prefixes the names of full-text indexes, so they do not clash with a field index on the same field
+const fulltextIndexPrefix = "__fulltext:"
+
+// fulltextIndexName returns the name of the full-text index of a field
+func fulltextIndexName(fieldName string) string {
+	return fulltextIndexPrefix + fieldName
+}
+
+// isTextOperator reports whether the operator searches the terms of a full-text field
+func isTextOperator(operator Operator) bool {
+	return operator == MatchAll || operator == MatchAny
+}
+
+// textTokens splits text into terms at every character that is not a letter or digit.
+// Terms are folded like the values of fields tagged with fold, and returned in order of appearance.
+func textTokens(text string) []string {
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.Is(unicode.Mn, r)
+	})
+	for i, word := range words {
+		words[i] = foldString(word)
+	}
+	return words
+}
+
+// textTerms returns the terms of text once each in order of appearance
+func textTerms(text string) []string {
+	var terms []string
+	seen := make(map[string]bool)
+	for _, term := range textTokens(text) {
+		if !seen[term] {
+			seen[term] = true
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+// fulltextIndexValues returns the terms a record is stored under in the full-text index of a field
+func (s *Store[T]) fulltextIndexValues(fieldName string, value T) []string {
+	field := s.fieldValue(reflect.ValueOf(value), fieldName)
+	if !field.IsValid() {
+		return nil
+	}
+	return textTerms(field.String())
+}
+
+// matchesText reports whether text holds all or, for MatchAny, any of the terms of the condition
+func matchesText(text string, condition Condition) bool {
+	terms := make(map[string]bool)
+	for _, term := range textTerms(text) {
+		terms[term] = true
+	}
+	for _, term := range textTerms(condition.Value.(string)) {
+		if terms[term] && condition.Operator == MatchAny {
+			return true
+		}
+		if !terms[term] && condition.Operator == MatchAll {
+			return false
+		}
+	}
+	return condition.Operator == MatchAll
+}
+
+// getKeysForTextCondition returns the sorted keys of the records holding all or any of the terms of the condition
+func (s *Store[T]) getKeysForTextCondition(condition Condition, maxKeys int) []string {
+	index := s.indexes[fulltextIndexName(condition.Field)]
+	var keys []string
+	for position, term := range textTerms(condition.Value.(string)) {
+		termKeys := append([]string(nil), index.search(term)...)
+		switch {
+		case position == 0:
+			keys = termKeys
+		case condition.Operator == MatchAll:
+			keys = intersectSlices(keys, termKeys)
+		default:
+			keys = unionSlices(keys, termKeys)
+		}
+	}
+	sort.Strings(keys)
+	if maxKeys > 0 && len(keys) > maxKeys {
+		keys = keys[:maxKeys]
+	}
+	return keys
+}
+
+// textConditions returns the full-text conditions of the query that are not negated
+func textConditions(query *Query) []Condition {
+	var conditions []Condition
+	for _, condition := range query.Conditions {
+		if isTextOperator(condition.Operator) {
+			conditions = append(conditions, condition)
+		}
+	}
+	var walk func(expression Expression)
+	walk = func(expression Expression) {
+		if expression.Condition != nil && isTextOperator(expression.Condition.Operator) {
+			conditions = append(conditions, *expression.Condition)
+		}
+		for _, child := range expression.children() {
+			walk(child)
+		}
+	}
+	walk(query.Filter)
+	return conditions
+}
+
+// relevanceScores returns for each record how often the terms of the full-text conditions occur in the fields they search
+func (s *Store[T]) relevanceScores(conditions []Condition, records map[string]T) map[string]int {
+	scores := make(map[string]int, len(records))
+	for key, record := range records {
+		structValue := reflect.ValueOf(record)
+		for _, condition := range conditions {
+			field := s.fieldValue(structValue, condition.Field)
+			if !field.IsValid() {
+				continue
+			}
+			terms := make(map[string]bool)
+			for _, term := range textTerms(condition.Value.(string)) {
+				terms[term] = true
+			}
+			for _, token := range textTokens(field.String()) {
+				if terms[token] {
+					scores[key]++
+				}
+			}
+		}
+	}
+	return scores
+}
+
+// sortByRelevance orders keys by descending score, then by key
+func sortByRelevance(keys []string, scores map[string]int) {
+	sort.Slice(keys, func(i, j int) bool {
+		return moreRelevant(keys[i], keys[j], scores)
+	})
+}
+
+// moreRelevant reports whether key a ranks before key b
+func moreRelevant(a, b string, scores map[string]int) bool {
+	if scores[a] != scores[b] {
+		return scores[a] > scores[b]
+	}
+	return a < b
+}
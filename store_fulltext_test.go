@@ -0,0 +1,305 @@
+package nnut
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// TestListing for testing full-text indexes
+type TestListing struct {
+	ID          string `nnut:"key"`
+	Title       string `nnut:"index,fulltext"`
+	Description string `nnut:"fulltext"`
+	Category    string `nnut:"index"`
+}
+
+func TestFulltextQuery(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	store, err := NewStore[TestListing](db, "listings")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	ctx := context.Background()
+	listings := []TestListing{
+		{ID: "a", Title: "Red running shoes", Description: "Light shoes for road running.", Category: "sport"},
+		{ID: "b", Title: "Blue shoes", Description: "Leather shoes, hand-made in Porto.", Category: "fashion"},
+		{ID: "c", Title: "Red dress", Description: "A RED summer dress; café ready", Category: "fashion"},
+		{ID: "d", Title: "Trail running pack", Description: "", Category: "sport"},
+	}
+	if err := store.PutBatch(ctx, listings); err != nil {
+		t.Fatalf("Failed to put batch: %v", err)
+	}
+	db.Flush()
+
+	tests := []struct {
+		name     string
+		query    *Query
+		expected []string
+	}{
+		{"all terms", &Query{Conditions: []Condition{{Field: "Title", Value: "red shoes", Operator: MatchAll}}}, []string{"a"}},
+		{"any term", &Query{Conditions: []Condition{{Field: "Title", Value: "red shoes", Operator: MatchAny}}}, []string{"a", "b", "c"}},
+		{"case and punctuation", &Query{Conditions: []Condition{{Field: "Description", Value: "HAND made", Operator: MatchAll}}}, []string{"b"}},
+		{"normalized", &Query{Conditions: []Condition{{Field: "Description", Value: "CAFÉ", Operator: MatchAll}}}, []string{"c"}},
+		{"no match", &Query{Conditions: []Condition{{Field: "Title", Value: "green", Operator: MatchAny}}}, nil},
+		{"with field index", &Query{Conditions: []Condition{{Field: "Title", Value: "running", Operator: MatchAll}, {Field: "Category", Value: "sport"}}}, []string{"a", "d"}},
+		{"filter", &Query{Filter: Or(Match(Condition{Field: "Title", Value: "dress", Operator: MatchAll}), Match(Condition{Field: "Description", Value: "leather", Operator: MatchAll}))}, []string{"b", "c"}},
+		{"not", &Query{Filter: Not(Match(Condition{Field: "Description", Value: "shoes", Operator: MatchAny}))}, []string{"c", "d"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			results, err := store.GetQuery(ctx, test.query)
+			if err != nil {
+				t.Fatalf("Failed to query: %v", err)
+			}
+			keys := make([]string, len(results))
+			for i, result := range results {
+				keys[i] = result.ID
+			}
+			sort.Strings(keys)
+			if fmt.Sprint(keys) != fmt.Sprint(test.expected) {
+				t.Fatalf("Expected %v, got %v", test.expected, keys)
+			}
+
+			// Scanning the records gives the same result as the index
+			var scanned []string
+			for _, listing := range listings {
+				matches := test.query.Filter.isZero() || store.matchesExpression(listing, test.query.Filter)
+				for _, condition := range test.query.Conditions {
+					matches = matches && store.matchesCondition(listing, condition)
+				}
+				if matches {
+					scanned = append(scanned, listing.ID)
+				}
+			}
+			if fmt.Sprint(scanned) != fmt.Sprint(test.expected) {
+				t.Fatalf("Expected scan to match %v, got %v", test.expected, scanned)
+			}
+		})
+	}
+
+	// Records mentioning the terms more often rank first, ties are ordered by key
+	query := &Query{Conditions: []Condition{{Field: "Description", Value: "red running shoes", Operator: MatchAny}}}
+	results, err := store.GetQuery(ctx, query)
+	if err != nil {
+		t.Fatalf("Failed to query: %v", err)
+	}
+	var keys []string
+	for _, result := range results {
+		keys = append(keys, result.ID)
+	}
+	if fmt.Sprint(keys) != fmt.Sprint([]string{"a", "b", "c"}) {
+		t.Fatalf("Expected results ranked by relevance, got %v", keys)
+	}
+	query.Limit = 1
+	query.Offset = 1
+	if results, err := store.GetQuery(ctx, query); err != nil || len(results) != 1 || results[0].ID != "b" {
+		t.Fatalf("Expected the second most relevant record, got %v (%v)", results, err)
+	}
+
+	invalid := []*Query{
+		{Conditions: []Condition{{Field: "Category", Value: "sport", Operator: MatchAll}}},
+		{Conditions: []Condition{{Field: "Title", Value: 1, Operator: MatchAll}}},
+		{Conditions: []Condition{{Field: "Title", Value: " - ", Operator: MatchAny}}},
+	}
+	for _, query := range invalid {
+		if _, err := store.GetQuery(ctx, query); !errors.As(err, &InvalidQueryError{}) {
+			t.Errorf("Expected InvalidQueryError for %+v, got %v", query, err)
+		}
+	}
+}
+
+func TestFulltextRelevance(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	store, err := NewStore[TestListing](db, "listings")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	ctx := context.Background()
+	listings := []TestListing{
+		{ID: "x", Title: "Boots", Description: "Boots"},
+		{ID: "y", Title: "Boots", Description: "Boots, boots and more BOOTS"},
+		{ID: "z", Title: "Rain boots", Description: "Rain boots: boots for the rain"},
+	}
+	if err := store.PutBatch(ctx, listings); err != nil {
+		t.Fatalf("Failed to put batch: %v", err)
+	}
+	db.Flush()
+
+	tests := []struct {
+		name     string
+		query    *Query
+		expected []string
+	}{
+		{"all terms by frequency", &Query{Conditions: []Condition{{Field: "Description", Value: "boots", Operator: MatchAll}}}, []string{"y", "z", "x"}},
+		{"any term by frequency", &Query{Conditions: []Condition{{Field: "Description", Value: "rain boots", Operator: MatchAny}}}, []string{"z", "y", "x"}},
+		{"several conditions", &Query{Conditions: []Condition{{Field: "Title", Value: "rain", Operator: MatchAny}, {Field: "Description", Value: "boots", Operator: MatchAll}}}, []string{"z"}},
+		{"page", &Query{Conditions: []Condition{{Field: "Description", Value: "boots", Operator: MatchAll}}, Offset: 1, Limit: 1}, []string{"z"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			results, err := store.GetQuery(ctx, test.query)
+			if err != nil {
+				t.Fatalf("Failed to query: %v", err)
+			}
+			keys := make([]string, len(results))
+			for i, result := range results {
+				keys[i] = result.ID
+			}
+			if fmt.Sprint(keys) != fmt.Sprint(test.expected) {
+				t.Fatalf("Expected %v, got %v", test.expected, keys)
+			}
+		})
+	}
+}
+
+func TestFulltextIndexMaintenance(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+
+	store, err := NewStore[TestListing](db, "listings")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	ctx := context.Background()
+	for i, description := range []string{"old boots", "new boots", "old hat"} {
+		if err := store.Put(ctx, TestListing{ID: fmt.Sprintf("l%d", i), Description: description}); err != nil {
+			t.Fatalf("Failed to put: %v", err)
+		}
+	}
+	if err := store.Put(ctx, TestListing{ID: "l0", Description: "mended boots"}); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if err := store.Delete(ctx, "l2"); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+
+	check := func(store *Store[TestListing]) {
+		t.Helper()
+		if keys := store.indexes[fulltextIndexName("Description")].search("old"); len(keys) != 0 {
+			t.Fatalf("Expected replaced and deleted terms to leave the index, got %v", keys)
+		}
+		results, err := store.GetQuery(ctx, &Query{Conditions: []Condition{{Field: "Description", Value: "boots", Operator: MatchAll}}})
+		if err != nil {
+			t.Fatalf("Failed to query: %v", err)
+		}
+		if len(results) != 2 || results[0].ID != "l0" || results[1].ID != "l1" {
+			t.Fatalf("Expected l0 and l1, got %v", results)
+		}
+	}
+	check(store)
+
+	// The full-text index is persisted and loaded on reopen
+	if err := db.Close(); err != nil {
+		t.Fatalf("Failed to close DB: %v", err)
+	}
+	db, err = Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to reopen DB: %v", err)
+	}
+	defer db.Close()
+	store, err = NewStore[TestListing](db, "listings")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	check(store)
+
+	// Without a persisted index it is rebuilt from the records
+	store.indexes[fulltextIndexName("Description")] = newBTree(32)
+	if err := store.rebuildIndexes(); err != nil {
+		t.Fatalf("Failed to rebuild indexes: %v", err)
+	}
+	check(store)
+}
+
+func TestFulltextIndexDefinition(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	type fulltextNumber struct {
+		ID    string `nnut:"key"`
+		Count int    `nnut:"fulltext"`
+	}
+	if _, err := NewStore[fulltextNumber](db, "listings"); !errors.As(err, &IndexDefinitionError{}) {
+		t.Errorf("Expected IndexDefinitionError for fulltext on a number field, got %v", err)
+	}
+}
+
+func TestFulltextQueryLeavesIndexUnchanged(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	store, err := NewStore[TestListing](db, "listings")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	ctx := context.Background()
+	var listings []TestListing
+	for i := 0; i < 5; i++ {
+		listings = append(listings, TestListing{ID: fmt.Sprintf("r%d", i), Description: "red"})
+	}
+	for i := 0; i < 3; i++ {
+		listings = append(listings, TestListing{ID: fmt.Sprintf("g%d", i), Description: "green"})
+	}
+	if err := store.PutBatch(ctx, listings); err != nil {
+		t.Fatalf("Failed to put batch: %v", err)
+	}
+	db.Flush()
+
+	results, err := store.GetQuery(ctx, &Query{Conditions: []Condition{{Field: "Description", Value: "red green", Operator: MatchAny}}})
+	if err != nil || len(results) != 8 {
+		t.Fatalf("Expected 8 results, got %v (%v)", results, err)
+	}
+
+	// The query must not reorder or extend the postings of the index
+	postings := store.indexes[fulltextIndexName("Description")].search("red")
+	sort.Strings(postings)
+	if fmt.Sprint(postings) != "[r0 r1 r2 r3 r4]" {
+		t.Fatalf("Expected the postings of red to be unchanged, got %v", postings)
+	}
+	results, err = store.GetQuery(ctx, &Query{Conditions: []Condition{{Field: "Description", Value: "red", Operator: MatchAll}}})
+	if err != nil {
+		t.Fatalf("Failed to query: %v", err)
+	}
+	keys := make([]string, len(results))
+	for i, result := range results {
+		keys[i] = result.ID
+	}
+	if fmt.Sprint(keys) != "[r0 r1 r2 r3 r4]" {
+		t.Fatalf("Expected the red records, got %v", keys)
+	}
+}
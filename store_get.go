@@ -25,7 +25,7 @@ func (s *Store[T]) Get(ctx context.Context, key string) (T, error) {
 	}
 
 	// Check buffer for pending changes first
-	if operation, exists := s.database.getLatestBufferedOperation(s.bucket, key); exists {
+	if operation, exists := s.bufferedOperation(key); exists {
 		if operation.Type == OperationPut {
 			// Apply buffered put operation
 			decoder := msgpack.GetDecoder()
@@ -50,7 +50,7 @@ func (s *Store[T]) Get(ctx context.Context, key string) (T, error) {
 		return zero, ctx.Err()
 	default:
 	}
-	err := s.database.View(func(transaction *bbolt.Tx) error {
+	err := s.view(func(transaction *bbolt.Tx) error {
 		bucket := transaction.Bucket(s.bucket)
 		if bucket == nil {
 			return BucketNotFoundError{Bucket: string(s.bucket)}
@@ -72,6 +72,33 @@ func (s *Store[T]) Get(ctx context.Context, key string) (T, error) {
 	return result, err
 }
 
+// GetTx retrieves a single record by its key as seen by a transaction.
+// Writes made earlier in the transaction are visible, other writes behave as with Get.
+func (s *Store[T]) GetTx(tx *Tx, key string) (T, error) {
+	var result T
+	if tx.closed {
+		return result, TxClosedError{}
+	}
+	if err := validateKey(key); err != nil {
+		return result, err
+	}
+
+	operation, exists := tx.bufferedOperation(s.bucket, key)
+	if !exists {
+		return s.Get(tx.ctx, key)
+	}
+	if operation.Type != OperationPut {
+		return result, KeyNotFoundError{Bucket: string(s.bucket), Key: key}
+	}
+	decoder := msgpack.GetDecoder()
+	defer msgpack.PutDecoder(decoder)
+	decoder.Reset(bytes.NewReader(operation.Value))
+	if err := decoder.Decode(&result); err != nil {
+		return result, WrappedError{Operation: "decode transaction", Bucket: string(s.bucket), Key: key, Err: err}
+	}
+	return result, nil
+}
+
 // GetBatch retrieves multiple records by their keys.
 // Returns a map of found records. Missing keys are not included in the map.
 // If some keys fail to decode, returns a PartialBatchError.
@@ -98,7 +125,7 @@ func (s *Store[T]) GetBatch(ctx context.Context, keys []string) (map[string]T, e
 	bufferDecoder := msgpack.GetDecoder()
 	defer msgpack.PutDecoder(bufferDecoder)
 	for _, key := range existingKeys {
-		if operation, exists := s.database.getLatestBufferedOperation(s.bucket, key); exists {
+		if operation, exists := s.bufferedOperation(key); exists {
 			if operation.Type == OperationPut {
 				var item T
 				bufferDecoder.Reset(bytes.NewReader(operation.Value))
@@ -121,7 +148,7 @@ func (s *Store[T]) GetBatch(ctx context.Context, keys []string) (map[string]T, e
 		return nil, ctx.Err()
 	default:
 	}
-	err := s.database.View(func(transaction *bbolt.Tx) error {
+	err := s.view(func(transaction *bbolt.Tx) error {
 		bucket := transaction.Bucket(s.bucket)
 		if bucket == nil {
 			// Missing bucket indicates no data exists - return empty results
@@ -168,103 +195,35 @@ func (s *Store[T]) GetBatch(ctx context.Context, keys []string) (map[string]T, e
 
 // GetQuery retrieves records matching the given query conditions.
 // Supports filtering, sorting, pagination, and indexing for efficient queries.
+// Results are in the order of the query's Index or OrderBy, ranked by relevance for full-text conditions,
+// and otherwise ordered by key. A query whose only condition selects a range of an indexed field
+// is ordered by that field. Buffered writes are included at their place in that order.
 func (s *Store[T]) GetQuery(ctx context.Context, query *Query) ([]T, error) {
 	if err := s.validateQuery(query); err != nil {
 		return nil, err
 	}
 
-	// TODO: Turn into slice.
-	var results map[string]T = make(map[string]T)
 	select {
 	case <-ctx.Done():
 		return nil, ctx.Err()
 	default:
 	}
-	err := s.database.View(func(transaction *bbolt.Tx) error {
-		// Determine the maximum number of keys needed based on limit and offset
-		maxKeys := 0
-		if query.Limit > 0 {
-			maxKeys = query.Offset + query.Limit
-		}
-
-		// Gather keys that potentially match the query conditions
-		var candidateKeys []string
-		if len(query.Conditions) > 0 {
-			candidateKeys = s.getCandidateKeysTx(transaction, query.Conditions, maxKeys)
-		} else if query.Index != "" {
-			// When no conditions but sorting is required, use the index directly
-			candidateKeys = s.getKeysFromIndexTx(transaction, query.Index, query.Sort, maxKeys)
-		} else {
-			// Fallback to scanning all keys when no optimizations apply
-			candidateKeys = s.getAllKeysTx(transaction, maxKeys)
-		}
-
-		// Skip offset and take only limit number of keys
-		start := query.Offset
-		if start > len(candidateKeys) {
-			start = len(candidateKeys)
-		}
-		end := len(candidateKeys)
-		if query.Limit > 0 && start+query.Limit < end {
-			end = start + query.Limit
-		}
-		keysToFetch := candidateKeys[start:end]
-
-		// Retrieve the actual data for the selected keys
-		bucket := transaction.Bucket(s.bucket)
-		if bucket == nil {
-			return BucketNotFoundError{Bucket: string(s.bucket)}
-		}
-		decoder := msgpack.GetDecoder()
-		defer msgpack.PutDecoder(decoder)
-		for _, key := range keysToFetch {
-			data := bucket.Get([]byte(key))
-			if data == nil {
-				continue
+	var results []T
+	err := s.view(func(transaction *bbolt.Tx) error {
+		// Select the keys of the page in result order, then retrieve their records
+		operations := s.bufferedOperationsForBucket()
+		keys := s.queryPageTx(transaction, query, operations)
+		records := s.loadRecordsTx(transaction, keys, operations)
+		results = make([]T, 0, len(keys))
+		for _, key := range keys {
+			if record, exists := records[key]; exists {
+				results = append(results, record)
 			}
-			var item T
-			decoder.Reset(bytes.NewReader(data))
-			err := decoder.Decode(&item)
-			if err != nil {
-				continue
-			}
-			results[key] = item
-			// TODO: Look for puts in the buffer here.
 		}
 		return nil
 	})
 	if err != nil {
 		return nil, err
 	}
-
-	// TODO: Only insert new items from the buffer to the slice at the right location based on the sort.
-	// Apply buffered operations
-	bufferedOperations := s.database.getBufferedOperationsForBucket(s.bucket)
-	for _, operation := range bufferedOperations {
-		if operation.Type == OperationPut {
-			var item T
-			decoder := msgpack.GetDecoder()
-			decoder.Reset(bytes.NewReader(operation.Value))
-			err := decoder.Decode(&item)
-			msgpack.PutDecoder(decoder)
-			if err == nil {
-				results[operation.Key] = item
-			}
-		} else if operation.Type == OperationDelete {
-			delete(results, operation.Key)
-		}
-	}
-
-	// Convert to slice
-	var finalResults []T
-	for _, item := range results {
-		finalResults = append(finalResults, item)
-	}
-
-	// Apply sorting if the index wasn't used for ordering
-	if query.Index != "" && len(query.Conditions) > 0 {
-		s.sortResults(finalResults, query.Index, query.Sort)
-	}
-
-	return finalResults, nil
+	return results, nil
 }
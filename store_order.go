@@ -0,0 +1,334 @@
+package nnut
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"go.etcd.io/bbolt"
+)
+
+// SortField orders query results by a field.
+// Sort is Descending or Ascending, Unsorted sorts ascending.
+type SortField struct {
+	Field string
+	Sort  Sorting
+}
+
+// sortFields returns the fields the query orders results by, OrderBy or else the Index
+func (q *Query) sortFields() []SortField {
+	if len(q.OrderBy) > 0 {
+		return q.OrderBy
+	}
+	if q.Index != "" {
+		return []SortField{{Field: q.Index, Sort: q.Sort}}
+	}
+	return nil
+}
+
+// validateOrderBy validates the sort fields of a query
+func (s *Store[T]) validateOrderBy(query *Query) error {
+	if len(query.OrderBy) > 0 && query.Index != "" {
+		return InvalidQueryError{Field: "OrderBy", Value: query.OrderBy, Reason: "cannot be combined with Index"}
+	}
+	for _, field := range query.OrderBy {
+		if _, exists := s.fieldMap[field.Field]; !exists {
+			return InvalidQueryError{Field: "OrderBy", Value: field.Field, Reason: "field does not exist"}
+		}
+		if s.multiValueFields[field.Field] {
+			return InvalidQueryError{Field: "OrderBy", Value: field.Field, Reason: "cannot sort by a slice field"}
+		}
+		if _, orderable := s.encoders[field.Field]; !orderable {
+			return InvalidQueryError{Field: "OrderBy", Value: field.Field, Reason: "field type cannot be sorted"}
+		}
+	}
+	return nil
+}
+
+// compareRecords compares two records by the sort fields, then by key.
+// Values are compared by their index encoding, missing values sort before all others.
+func (s *Store[T]) compareRecords(a, b T, orderBy []SortField) int {
+	valueA, valueB := reflect.ValueOf(a), reflect.ValueOf(b)
+	for _, field := range orderBy {
+		encodedA, _ := s.encodeField(field.Field, s.fieldValue(valueA, field.Field))
+		encodedB, _ := s.encodeField(field.Field, s.fieldValue(valueB, field.Field))
+		if comparison := strings.Compare(encodedA, encodedB); comparison != 0 {
+			if field.Sort == Descending {
+				return -comparison
+			}
+			return comparison
+		}
+	}
+	return strings.Compare(valueA.Field(s.keyField).String(), valueB.Field(s.keyField).String())
+}
+
+// queryPageTx returns the keys of the records on the page the query selects, in the order of the results.
+// Buffered operations are taken into account, so buffered records are placed where they belong.
+func (s *Store[T]) queryPageTx(transaction *bbolt.Tx, query *Query, operations []operation) []string {
+	maxKeys := 0
+	if query.Limit > 0 {
+		maxKeys = query.Offset + query.Limit
+	}
+
+	var keys []string
+	switch {
+	case len(query.OrderBy) > 0:
+		records := s.loadRecordsTx(transaction, s.matchingKeysTx(transaction, query, 0, operations), operations)
+		keys = make([]string, 0, len(records))
+		for key := range records {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return s.compareRecords(records[keys[i]], records[keys[j]], query.OrderBy) < 0
+		})
+	case query.Index != "" && !query.filtered():
+		// The index already holds the buffered writes
+		keys = s.getKeysFromIndexTx(transaction, query.Index, query.Sort, maxKeys)
+	case query.Index != "":
+		if field, bounds, ok := s.indexRange(query); ok && field == query.Index {
+			// The range of the index is walked in the order of the results
+			keys = s.rangeKeys(field, bounds, query.Sort == Descending, maxKeys)
+			break
+		}
+		keys = s.orderKeysByIndex(s.matchingKeysTx(transaction, query, 0, operations), query.Index, query.Sort, maxKeys)
+	case len(textConditions(query)) > 0:
+		keys = s.matchingKeysTx(transaction, query, 0, operations)
+		sortByRelevance(keys, s.relevanceScores(textConditions(query), s.loadRecordsTx(transaction, keys, operations)))
+	case query.filtered():
+		if field, bounds, ok := s.indexRange(query); ok {
+			keys = s.rangeKeys(field, bounds, false, maxKeys)
+			break
+		}
+		if !s.keyOrderedCandidates(query) {
+			// Candidate keys are only complete and in order without a limit
+			keys = s.matchingKeysTx(transaction, query, 0, operations)
+			break
+		}
+		fallthrough
+	default:
+		// The candidates are in key order, and each buffered operation removes at most one key from them
+		if maxKeys > 0 {
+			maxKeys += len(operations)
+		}
+		keys = s.matchingKeysTx(transaction, query, maxKeys, operations)
+	}
+	return pageKeys(keys, query.Offset, query.Limit)
+}
+
+// matchingKeysTx returns the sorted keys of the records matching the query, up to maxKeys if >0,
+// with the buffered operations applied. Scans only see the records in the bucket,
+// so buffered records are matched against the query again.
+func (s *Store[T]) matchingKeysTx(transaction *bbolt.Tx, query *Query, maxKeys int, operations []operation) []string {
+	keys := s.getQueryKeysTx(transaction, query, maxKeys)
+	if len(operations) > 0 {
+		matches := make(map[string]bool, len(keys)+len(operations))
+		for _, key := range keys {
+			matches[key] = true
+		}
+		decoder := msgpack.GetDecoder()
+		defer msgpack.PutDecoder(decoder)
+		for _, operation := range operations {
+			delete(matches, operation.Key)
+			if operation.Type != OperationPut {
+				continue
+			}
+			var item T
+			decoder.Reset(bytes.NewReader(operation.Value))
+			if err := decoder.Decode(&item); err == nil && s.matchesQuery(item, query) {
+				matches[operation.Key] = true
+			}
+		}
+		keys = make([]string, 0, len(matches))
+		for key := range matches {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// indexRange returns the field index and the range of its values holding exactly the records matching
+// the query, when its only condition compares an indexed field with a value, checks a prefix or is Between.
+// The index holds the buffered writes, so the range is complete.
+func (s *Store[T]) indexRange(query *Query) (string, valueBounds, bool) {
+	if !query.Filter.isZero() || len(query.Conditions) != 1 || s.partialIndexView(query) != nil {
+		return "", valueBounds{}, false
+	}
+	condition := query.Conditions[0]
+	if s.multiValueFields[condition.Field] || isTextOperator(condition.Operator) || !s.isIndexedCondition(condition) {
+		return "", valueBounds{}, false
+	}
+	var bounds valueBounds
+	switch condition.Operator {
+	case HasPrefix, Wildcard:
+		prefix, isPrefix := condition.Value.(string), true
+		if condition.Operator == Wildcard {
+			prefix, isPrefix = wildcardPrefix(prefix)
+		}
+		if !isPrefix {
+			return "", valueBounds{}, false
+		}
+		prefix = s.collate(condition.Field, prefix)
+		bounds = valueBounds{min: prefix, max: prefixEnd(prefix), includeMin: true}
+	case Between:
+		values, _ := conditionValues(condition.Value)
+		min, _ := s.conditionIndexValue(condition.Field, values[0])
+		max, _ := s.conditionIndexValue(condition.Field, values[1])
+		if max == "" {
+			// An empty bound means unbounded, and empty values are not indexed
+			return "", valueBounds{}, false
+		}
+		bounds = valueBounds{min: min, max: max, includeMin: true, includeMax: true}
+	case Equals, GreaterThan, GreaterThanOrEqual, LessThan, LessThanOrEqual:
+		value, _ := s.conditionIndexValue(condition.Field, condition.Value)
+		if value == "" {
+			return "", valueBounds{}, false
+		}
+		switch condition.Operator {
+		case Equals:
+			bounds = valueBounds{min: value, max: value, includeMin: true, includeMax: true}
+		case GreaterThan, GreaterThanOrEqual:
+			bounds = valueBounds{min: value, includeMin: condition.Operator == GreaterThanOrEqual}
+		default:
+			bounds = valueBounds{max: value, includeMax: condition.Operator == LessThanOrEqual}
+		}
+	default:
+		return "", valueBounds{}, false
+	}
+	return condition.Field, bounds, true
+}
+
+// rangeKeys returns the keys in the range of the field index in the order of the values,
+// or in reverse order if descending, up to maxKeys if >0. Keys with equal values are ordered by key.
+func (s *Store[T]) rangeKeys(field string, bounds valueBounds, descending bool, maxKeys int) []string {
+	var keys []string
+	s.indexes[field].walkRange(bounds.min, bounds.max, bounds.includeMin, bounds.includeMax, descending, func(recordKeys []string) bool {
+		start := len(keys)
+		keys = append(keys, recordKeys...)
+		sort.Strings(keys[start:])
+		return maxKeys <= 0 || len(keys) < maxKeys
+	})
+	if maxKeys > 0 && len(keys) > maxKeys {
+		keys = keys[:maxKeys]
+	}
+	return keys
+}
+
+// keyOrderedCandidates reports whether getQueryKeysTx finds the keys matching the query in key order,
+// so that its first keys are the first matches. Scans read the bucket in key order and filter expressions
+// sort their keys, while index searches return keys in the order of the index.
+func (s *Store[T]) keyOrderedCandidates(query *Query) bool {
+	if !query.Filter.isZero() {
+		return true
+	}
+	if s.partialIndexView(query) != nil {
+		return false
+	}
+	if _, planned := s.planCompositeIndex(query.Conditions); planned {
+		return false
+	}
+	for _, condition := range query.Conditions {
+		if s.isIndexedCondition(condition) {
+			return false
+		}
+	}
+	return true
+}
+
+// orderKeysByIndex returns the sorted keys in the order of the index, up to maxKeys if >0.
+// Keys with equal values stay ordered by key. Keys missing from the index have no value,
+// which sorts before all others.
+func (s *Store[T]) orderKeysByIndex(keys []string, index string, sorting Sorting, maxKeys int) []string {
+	remaining := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		remaining[key] = true
+	}
+	ordered := make([]string, 0, len(keys))
+	s.indexes[index].walkValues(sorting == Descending, func(recordKeys []string) bool {
+		start := len(ordered)
+		for _, key := range recordKeys {
+			if remaining[key] {
+				ordered = append(ordered, key)
+				delete(remaining, key)
+			}
+		}
+		sort.Strings(ordered[start:])
+		return len(remaining) > 0
+	})
+	var missing []string
+	for _, key := range keys {
+		if remaining[key] {
+			missing = append(missing, key)
+		}
+	}
+	if sorting == Descending {
+		ordered = append(ordered, missing...)
+	} else {
+		ordered = append(missing, ordered...)
+	}
+	if maxKeys > 0 && len(ordered) > maxKeys {
+		ordered = ordered[:maxKeys]
+	}
+	return ordered
+}
+
+// pageKeys returns the keys left after skipping offset keys, at most limit if >0
+func pageKeys(keys []string, offset int, limit int) []string {
+	if offset > len(keys) {
+		offset = len(keys)
+	}
+	end := len(keys)
+	if limit > 0 && offset+limit < end {
+		end = offset + limit
+	}
+	return keys[offset:end]
+}
+
+// loadRecordsTx returns the records stored under the keys, with the buffered operations applied
+func (s *Store[T]) loadRecordsTx(transaction *bbolt.Tx, keys []string, operations []operation) map[string]T {
+	wanted := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		wanted[key] = true
+	}
+	records := make(map[string]T, len(keys))
+	decoder := msgpack.GetDecoder()
+	defer msgpack.PutDecoder(decoder)
+
+	buffered := make(map[string]bool)
+	for _, operation := range operations {
+		if !wanted[operation.Key] {
+			continue
+		}
+		buffered[operation.Key] = true
+		if operation.Type != OperationPut {
+			continue
+		}
+		var item T
+		decoder.Reset(bytes.NewReader(operation.Value))
+		if err := decoder.Decode(&item); err == nil {
+			records[operation.Key] = item
+		}
+	}
+
+	bucket := transaction.Bucket(s.bucket)
+	if bucket == nil {
+		return records
+	}
+	for _, key := range keys {
+		if buffered[key] {
+			continue
+		}
+		data := bucket.Get([]byte(key))
+		if data == nil {
+			continue
+		}
+		var item T
+		decoder.Reset(bytes.NewReader(data))
+		if err := decoder.Decode(&item); err == nil {
+			records[key] = item
+		}
+	}
+	return records
+}
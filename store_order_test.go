@@ -0,0 +1,260 @@
+package nnut
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestEmployee for testing multi-field sorting
+type TestEmployee struct {
+	ID         string `nnut:"key"`
+	Department string `nnut:"index"`
+	Level      int
+	Name       string
+	Skills     []string
+	Address    TestAddress
+}
+
+func TestQueryOrderBy(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	store, err := NewStore[TestEmployee](db, "employees")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	ctx := context.Background()
+	employees := []TestEmployee{
+		{ID: "e1", Department: "sales", Level: 2, Name: "Cleo", Address: TestAddress{City: "Oslo"}},
+		{ID: "e2", Department: "dev", Level: 3, Name: "Ann", Address: TestAddress{City: "Bergen"}},
+		{ID: "e3", Department: "sales", Level: 3, Name: "Bob", Address: TestAddress{City: "Oslo"}},
+		{ID: "e4", Department: "dev", Level: 3, Name: "Ann", Address: TestAddress{City: "Oslo"}},
+		{ID: "e5", Department: "dev", Level: -1, Name: "Dan", Address: TestAddress{City: "Bergen"}},
+	}
+	if err := store.PutBatch(ctx, employees); err != nil {
+		t.Fatalf("Failed to put batch: %v", err)
+	}
+	db.Flush()
+
+	tests := []struct {
+		name     string
+		query    *Query
+		expected []string
+	}{
+		{"indexed then non-indexed", &Query{OrderBy: []SortField{{Field: "Department", Sort: Ascending}, {Field: "Level", Sort: Descending}}}, []string{"e2", "e4", "e5", "e3", "e1"}},
+		{"key tiebreaker", &Query{OrderBy: []SortField{{Field: "Name", Sort: Ascending}}}, []string{"e2", "e4", "e3", "e1", "e5"}},
+		{"key tiebreaker descending", &Query{OrderBy: []SortField{{Field: "Level", Sort: Descending}}}, []string{"e2", "e3", "e4", "e1", "e5"}},
+		{"nested field", &Query{OrderBy: []SortField{{Field: "Address.City", Sort: Descending}, {Field: "Name"}}}, []string{"e4", "e3", "e1", "e2", "e5"}},
+		{"with conditions", &Query{Conditions: []Condition{{Field: "Department", Value: "dev"}}, OrderBy: []SortField{{Field: "Level"}}}, []string{"e5", "e2", "e4"}},
+		{"offset and limit", &Query{OrderBy: []SortField{{Field: "Name", Sort: Descending}}, Offset: 1, Limit: 2}, []string{"e1", "e3"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			results, err := store.GetQuery(ctx, test.query)
+			if err != nil {
+				t.Fatalf("Failed to query: %v", err)
+			}
+			keys := make([]string, len(results))
+			for i, result := range results {
+				keys[i] = result.ID
+			}
+			if fmt.Sprint(keys) != fmt.Sprint(test.expected) {
+				t.Fatalf("Expected %v, got %v", test.expected, keys)
+			}
+		})
+	}
+
+	// Buffered writes are ordered with the stored records
+	if err := store.Put(ctx, TestEmployee{ID: "e0", Department: "dev", Level: 9, Name: "Eve"}); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if err := store.Delete(ctx, "e2"); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	results, err := store.GetQuery(ctx, &Query{OrderBy: []SortField{{Field: "Level", Sort: Descending}}, Limit: 2})
+	if err != nil {
+		t.Fatalf("Failed to query: %v", err)
+	}
+	if len(results) != 2 || results[0].ID != "e0" || results[1].ID != "e3" {
+		t.Fatalf("Expected e0 and e3, got %v", results)
+	}
+
+	// DeleteQuery removes the first records in the order
+	deleted, err := store.DeleteQuery(ctx, &Query{OrderBy: []SortField{{Field: "Name", Sort: Descending}}, Limit: 1})
+	if err != nil || deleted != 1 {
+		t.Fatalf("Expected one record deleted, got %d (%v)", deleted, err)
+	}
+	if has, _ := store.Has(ctx, "e0"); has {
+		t.Fatal("Expected the record with the last name to be deleted")
+	}
+
+	invalid := []*Query{
+		{Index: "Department", OrderBy: []SortField{{Field: "Level"}}},
+		{OrderBy: []SortField{{Field: "Missing"}}},
+		{OrderBy: []SortField{{Field: "Skills"}}},
+		{OrderBy: []SortField{{Field: "Address"}}},
+	}
+	for _, query := range invalid {
+		if _, err := store.GetQuery(ctx, query); !errors.As(err, &InvalidQueryError{}) {
+			t.Errorf("Expected InvalidQueryError for %+v, got %v", query, err)
+		}
+	}
+}
+
+func TestQueryResultOrder(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	store, err := NewStore[TestEmployee](db, "employees")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	ctx := context.Background()
+	var employees []TestEmployee
+	for i := 0; i < 20; i++ {
+		employees = append(employees, TestEmployee{
+			ID:         fmt.Sprintf("e%02d", i),
+			Department: []string{"dev", "ops", "sales", ""}[i%4],
+			Level:      i % 3,
+		})
+	}
+	if err := store.PutBatch(ctx, employees); err != nil {
+		t.Fatalf("Failed to put batch: %v", err)
+	}
+	db.Flush()
+
+	// Buffered writes are merged at their place in the order
+	if err := store.Put(ctx, TestEmployee{ID: "e05a", Department: "dev", Level: 1}); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if err := store.Put(ctx, TestEmployee{ID: "e03", Department: "dev", Level: 2}); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if err := store.Put(ctx, TestEmployee{ID: "e04", Department: "ops", Level: 1}); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if err := store.Delete(ctx, "e01"); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		query    *Query
+		expected []string
+	}{
+		{"key order", &Query{Limit: 5}, []string{"e00", "e02", "e03", "e04", "e05"}},
+		{"key order page", &Query{Offset: 4, Limit: 3}, []string{"e05", "e05a", "e06"}},
+		{"index order", &Query{Index: "Department", Limit: 7}, []string{"e07", "e11", "e15", "e19", "e00", "e03", "e05a"}},
+		{"index descending", &Query{Index: "Department", Sort: Descending, Offset: 3, Limit: 3}, []string{"e14", "e18", "e04"}},
+		{"filtered key order", &Query{Conditions: []Condition{{Field: "Level", Value: 1}}, Offset: 1, Limit: 3}, []string{"e05a", "e07", "e10"}},
+		{"buffered update leaving scan", &Query{Conditions: []Condition{{Field: "Level", Value: 0}}, Limit: 3}, []string{"e00", "e06", "e09"}},
+		{"index range", &Query{Index: "Department", Conditions: []Condition{{Field: "Department", Value: "o", Operator: HasPrefix}}, Limit: 3}, []string{"e04", "e05", "e09"}},
+		{"index range descending", &Query{Index: "Department", Sort: Descending, Conditions: []Condition{{Field: "Department", Value: "ops", Operator: LessThanOrEqual}}, Offset: 4, Limit: 3}, []string{"e17", "e00", "e03"}},
+		{"range in index order", &Query{Conditions: []Condition{{Field: "Department", Value: "dev", Operator: GreaterThan}}, Limit: 6}, []string{"e04", "e05", "e09", "e13", "e17", "e02"}},
+		{"filtered index order", &Query{Index: "Department", Conditions: []Condition{{Field: "Level", Value: 2}}, Limit: 4}, []string{"e11", "e03", "e08", "e05"}},
+		{"filtered index descending", &Query{Index: "Department", Sort: Descending, Conditions: []Condition{{Field: "Level", Value: 2}}, Offset: 3}, []string{"e17", "e03", "e08", "e11"}},
+		{"buffered no longer matching", &Query{Conditions: []Condition{{Field: "Department", Value: "dev"}}}, []string{"e00", "e03", "e05a", "e08", "e12", "e16"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			results, err := store.GetQuery(ctx, test.query)
+			if err != nil {
+				t.Fatalf("Failed to query: %v", err)
+			}
+			keys := make([]string, len(results))
+			for i, result := range results {
+				keys[i] = result.ID
+			}
+			if fmt.Sprint(keys) != fmt.Sprint(test.expected) {
+				t.Fatalf("Expected %v, got %v", test.expected, keys)
+			}
+
+			// CountQuery counts every record GetQuery returns without paging
+			unpaged := *test.query
+			unpaged.Offset, unpaged.Limit = 0, 0
+			all, err := store.GetQuery(ctx, &unpaged)
+			if err != nil {
+				t.Fatalf("Failed to query: %v", err)
+			}
+			if count, err := store.CountQuery(ctx, &unpaged); err != nil || count != len(all) {
+				t.Fatalf("Expected a count of %d, got %d (%v)", len(all), count, err)
+			}
+		})
+	}
+
+	// DeleteQuery selects the same page as GetQuery
+	query := &Query{Index: "Department", Sort: Descending, Limit: 2}
+	expected, err := store.GetQuery(ctx, query)
+	if err != nil {
+		t.Fatalf("Failed to query: %v", err)
+	}
+	if deleted, err := store.DeleteQuery(ctx, query); err != nil || deleted != 2 {
+		t.Fatalf("Expected two records deleted, got %d (%v)", deleted, err)
+	}
+	for _, employee := range expected {
+		if has, _ := store.Has(ctx, employee.ID); has {
+			t.Fatalf("Expected %s to be deleted", employee.ID)
+		}
+	}
+}
+
+func TestQueryBeforeFirstFlush(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	db, err := OpenWithConfig(dbPath, &Config{FlushInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	store, err := NewStore[TestEmployee](db, "employees")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	ctx := context.Background()
+
+	// The bucket is only created by the first flush, buffered writes are found before it
+	if err := store.Put(ctx, TestEmployee{ID: "e1", Department: "dev", Level: 1}); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if err := store.Put(ctx, TestEmployee{ID: "e2", Department: "ops", Level: 2}); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if err := store.Delete(ctx, "e2"); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	if count, err := store.Count(ctx); err != nil || count != 1 {
+		t.Fatalf("Expected 1 record, got %d (%v)", count, err)
+	}
+	queries := []*Query{
+		{},
+		{Index: "Department"},
+		{Conditions: []Condition{{Field: "Department", Value: "dev"}}},
+		{Conditions: []Condition{{Field: "Level", Value: 1}}},
+		{Filter: Or(Match(Condition{Field: "Level", Value: 1}), Match(Condition{Field: "Level", Value: 2}))},
+		{OrderBy: []SortField{{Field: "Level"}}},
+	}
+	for _, query := range queries {
+		results, err := store.GetQuery(ctx, query)
+		if err != nil || len(results) != 1 || results[0].ID != "e1" {
+			t.Fatalf("Expected e1 for %+v, got %v (%v)", query, results, err)
+		}
+		if count, err := store.CountQuery(ctx, query); err != nil || count != 1 {
+			t.Fatalf("Expected a count of 1 for %+v, got %d (%v)", query, count, err)
+		}
+	}
+}
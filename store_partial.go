@@ -0,0 +1,187 @@
+package nnut
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// PartialIndex is an index on Field that only holds the records matching all Where conditions.
+// It keeps the index small when queries only ever look at a fraction of the records.
+// A query uses it in place of the field's own index when its conditions include every Where condition,
+// either in Conditions or as a condition directly inside an And of Filter.
+// The Where conditions are part of the index, changing them rebuilds the index when the store is opened.
+type PartialIndex struct {
+	Name  string
+	Field string
+	Where []Condition
+}
+
+// WithPartialIndex adds a partial index to the store.
+func WithPartialIndex(index PartialIndex) StoreOption {
+	return func(options *storeOptions) {
+		options.partialIndexes = append(options.partialIndexes, index)
+	}
+}
+
+// addPartialIndex validates a partial index definition and creates its B-tree
+func (s *Store[T]) addPartialIndex(partial PartialIndex) error {
+	if partial.Name == "" || strings.HasPrefix(partial.Name, "__") {
+		return IndexDefinitionError{IndexName: partial.Name, Reason: "name cannot be empty or start with __"}
+	}
+	if _, exists := s.fieldMap[partial.Name]; exists {
+		return IndexDefinitionError{IndexName: partial.Name, Reason: "name is already used by a field"}
+	}
+	if _, exists := s.indexes[partial.Name]; exists {
+		return IndexDefinitionError{IndexName: partial.Name, Reason: "name is already used by another index"}
+	}
+	if _, exists := s.fieldMap[partial.Field]; !exists {
+		return IndexDefinitionError{IndexName: partial.Name, Reason: "field '" + partial.Field + "' does not exist"}
+	}
+	if _, orderable := s.encoders[partial.Field]; !orderable {
+		return IndexFieldTypeError{FieldName: partial.Field, Type: s.fieldType(partial.Field).String()}
+	}
+	if len(partial.Where) == 0 {
+		return IndexDefinitionError{IndexName: partial.Name, Reason: "needs at least one Where condition"}
+	}
+	for _, condition := range partial.Where {
+		if err := s.validateCondition(condition); err != nil {
+			return IndexDefinitionError{IndexName: partial.Name, Reason: err.Error()}
+		}
+	}
+	s.partialIndexes[partial.Name] = partial
+	s.indexes[partial.Name] = newBTree(32)
+	return nil
+}
+
+// partialIndexValues returns the values a record is stored under in the named partial index,
+// none if the record does not match the index's conditions
+func (s *Store[T]) partialIndexValues(indexName string, value T) []string {
+	partial := s.partialIndexes[indexName]
+	for _, condition := range partial.Where {
+		if !s.matchesCondition(value, condition) {
+			return nil
+		}
+	}
+	return s.indexValues(partial.Field, s.fieldValue(reflect.ValueOf(value), partial.Field))
+}
+
+// partialIndexView returns a copy of the store whose field indexes are replaced by the partial indexes
+// the query implies, or nil if the query implies none.
+// The query keeps the conditions of the partial indexes, so the records missing from them are never selected.
+func (s *Store[T]) partialIndexView(query *Query) *Store[T] {
+	if len(s.partialIndexes) == 0 {
+		return nil
+	}
+	indexNames := make([]string, 0, len(s.partialIndexes))
+	for indexName := range s.partialIndexes {
+		indexNames = append(indexNames, indexName)
+	}
+	sort.Strings(indexNames)
+
+	conjuncts := queryConjuncts(query)
+	var view *Store[T]
+	for _, indexName := range indexNames {
+		partial := s.partialIndexes[indexName]
+		if !s.impliesConditions(conjuncts, partial.Where) {
+			continue
+		}
+		if view == nil {
+			view = s.withIndexes()
+		} else if view.indexes[partial.Field] != s.indexes[partial.Field] {
+			// Another partial index already stands in for the field
+			continue
+		}
+		view.indexes[partial.Field] = s.indexes[indexName]
+		view.indexFields[partial.Field] = s.fieldMap[partial.Field]
+	}
+	return view
+}
+
+// withIndexes returns a copy of the store with its own index maps and without partial indexes
+func (s *Store[T]) withIndexes() *Store[T] {
+	indexes := make(map[string]*bTree, len(s.indexes))
+	for name, index := range s.indexes {
+		indexes[name] = index
+	}
+	indexFields := make(map[string][]int, len(s.indexFields))
+	for name, path := range s.indexFields {
+		indexFields[name] = path
+	}
+	return &Store[T]{
+		database:         s.database,
+		bucket:           s.bucket,
+		keyField:         s.keyField,
+		versionField:     s.versionField,
+		indexFields:      indexFields,
+		compositeIndexes: s.compositeIndexes,
+		uniqueFields:     s.uniqueFields,
+		foldFields:       s.foldFields,
+		fulltextFields:   s.fulltextFields,
+		fieldMap:         s.fieldMap,
+		encoders:         s.encoders,
+		multiValueFields: s.multiValueFields,
+		indexes:          indexes,
+		snapshot:         s.snapshot,
+	}
+}
+
+// queryConjuncts returns the conditions every record selected by the query satisfies
+func queryConjuncts(query *Query) []Condition {
+	conjuncts := append([]Condition(nil), query.Conditions...)
+	switch {
+	case query.Filter.Condition != nil:
+		conjuncts = append(conjuncts, *query.Filter.Condition)
+	case len(query.Filter.And) > 0:
+		for _, operand := range query.Filter.And {
+			if operand.Condition != nil {
+				conjuncts = append(conjuncts, *operand.Condition)
+			}
+		}
+	}
+	return conjuncts
+}
+
+// impliesConditions reports whether every required condition is among the conjuncts
+func (s *Store[T]) impliesConditions(conjuncts []Condition, required []Condition) bool {
+	for _, condition := range required {
+		implied := false
+		for _, conjunct := range conjuncts {
+			if s.sameCondition(conjunct, condition) {
+				implied = true
+				break
+			}
+		}
+		if !implied {
+			return false
+		}
+	}
+	return true
+}
+
+// sameCondition reports whether two conditions select the same records,
+// comparing values by their encoding so 25 and int64(25) are the same on an int field
+func (s *Store[T]) sameCondition(a, b Condition) bool {
+	if a.Field != b.Field || a.Operator != b.Operator {
+		return false
+	}
+	if reflect.DeepEqual(a.Value, b.Value) {
+		return true
+	}
+	valuesA, sliceA := conditionValues(a.Value)
+	valuesB, sliceB := conditionValues(b.Value)
+	if !sliceA || !sliceB {
+		valuesA, valuesB = []interface{}{a.Value}, []interface{}{b.Value}
+	}
+	if len(valuesA) != len(valuesB) {
+		return false
+	}
+	for i := range valuesA {
+		encodedA, okA := s.conditionIndexValue(a.Field, valuesA[i])
+		encodedB, okB := s.conditionIndexValue(b.Field, valuesB[i])
+		if !okA || !okB || encodedA != encodedB {
+			return false
+		}
+	}
+	return true
+}
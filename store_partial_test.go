@@ -0,0 +1,237 @@
+package nnut
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// TestTicket for testing partial indexes
+type TestTicket struct {
+	ID       string `nnut:"key"`
+	Status   string
+	Assignee string
+	Priority int `nnut:"index"`
+}
+
+var openByAssignee = PartialIndex{
+	Name:  "open_by_assignee",
+	Field: "Assignee",
+	Where: []Condition{{Field: "Status", Value: "open"}},
+}
+
+func TestPartialIndexQuery(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	store, err := NewStore[TestTicket](db, "tickets", WithPartialIndex(openByAssignee))
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	ctx := context.Background()
+
+	var tickets []TestTicket
+	for i := 0; i < 50; i++ {
+		tickets = append(tickets, TestTicket{ID: fmt.Sprintf("archived%02d", i), Status: "archived", Assignee: "bob", Priority: i % 3})
+	}
+	tickets = append(tickets,
+		TestTicket{ID: "open1", Status: "open", Assignee: "bob", Priority: 1},
+		TestTicket{ID: "open2", Status: "open", Assignee: "bob", Priority: 2},
+		TestTicket{ID: "open3", Status: "open", Assignee: "ann", Priority: 1},
+	)
+	if err := store.PutBatch(ctx, tickets); err != nil {
+		t.Fatalf("Failed to put batch: %v", err)
+	}
+	db.Flush()
+
+	if count := store.indexes["open_by_assignee"].countKeys(); count != 3 {
+		t.Fatalf("Expected only the open tickets in the partial index, got %d", count)
+	}
+
+	openBob := []Condition{{Field: "Status", Value: "open"}, {Field: "Assignee", Value: "bob"}}
+	tests := []struct {
+		name     string
+		query    *Query
+		partial  bool
+		expected []string
+	}{
+		{"conditions", &Query{Conditions: openBob}, true, []string{"open1", "open2"}},
+		{"filter", &Query{Filter: And(Match(openBob[0]), Match(openBob[1]))}, true, []string{"open1", "open2"}},
+		{"with field index", &Query{Conditions: append(openBob, Condition{Field: "Priority", Value: 1})}, true, []string{"open1"}},
+		{"not equals", &Query{Conditions: []Condition{openBob[0], {Field: "Assignee", Value: "bob", Operator: NotEquals}}}, true, []string{"open3"}},
+		{"predicate not implied", &Query{Conditions: openBob[1:]}, false, nil},
+		{"predicate in or", &Query{Filter: Or(Match(openBob[0]), Match(openBob[1]))}, false, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if view := store.partialIndexView(test.query); (view != nil) != test.partial {
+				t.Fatalf("Expected partial index use to be %v", test.partial)
+			}
+			expected := test.expected
+			if expected == nil {
+				// Queries not implying the predicate see every record
+				for _, ticket := range tickets {
+					if (ticket.Assignee == "bob") || (test.name == "predicate in or" && ticket.Status == "open") {
+						expected = append(expected, ticket.ID)
+					}
+				}
+			}
+			results, err := store.GetQuery(ctx, test.query)
+			if err != nil {
+				t.Fatalf("Failed to query: %v", err)
+			}
+			expectTicketKeys(t, results, expected)
+			if count, err := store.CountQuery(ctx, test.query); err != nil || count != len(expected) {
+				t.Fatalf("Expected count %d, got %d (%v)", len(expected), count, err)
+			}
+		})
+	}
+}
+
+func TestPartialIndexMaintenance(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+
+	store, err := NewStore[TestTicket](db, "tickets", WithPartialIndex(openByAssignee))
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	ctx := context.Background()
+	for i := 1; i <= 3; i++ {
+		if err := store.Put(ctx, TestTicket{ID: fmt.Sprintf("t%d", i), Status: "open", Assignee: "bob"}); err != nil {
+			t.Fatalf("Failed to put: %v", err)
+		}
+	}
+
+	// Records leave the partial index when they stop matching or are deleted
+	err = store.Update(ctx, "t1", func(ticket *TestTicket) error {
+		ticket.Status = "archived"
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to update: %v", err)
+	}
+	if err := store.Delete(ctx, "t2"); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+
+	query := &Query{Conditions: []Condition{{Field: "Assignee", Value: "bob"}, {Field: "Status", Value: "open"}}}
+	check := func(store *Store[TestTicket]) {
+		t.Helper()
+		if keys := store.indexes["open_by_assignee"].search("bob"); len(keys) != 1 || keys[0] != "t3" {
+			t.Fatalf("Expected only t3 in the partial index, got %v", keys)
+		}
+		results, err := store.GetQuery(ctx, query)
+		if err != nil {
+			t.Fatalf("Failed to query: %v", err)
+		}
+		expectTicketKeys(t, results, []string{"t3"})
+	}
+	check(store)
+
+	// The partial index is persisted and loaded on reopen
+	if err := db.Close(); err != nil {
+		t.Fatalf("Failed to close DB: %v", err)
+	}
+	db, err = Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to reopen DB: %v", err)
+	}
+	defer db.Close()
+	store, err = NewStore[TestTicket](db, "tickets", WithPartialIndex(openByAssignee))
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	check(store)
+}
+
+func TestPartialIndexImplication(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	urgent := PartialIndex{
+		Name:  "urgent_by_assignee",
+		Field: "Assignee",
+		Where: []Condition{{Field: "Priority", Value: []int{3, 5}, Operator: Between}},
+	}
+	store, err := NewStore[TestTicket](db, "tickets", WithPartialIndex(urgent))
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	implied := []Condition{{Field: "Priority", Value: []int64{3, 5}, Operator: Between}}
+	if !store.impliesConditions(implied, urgent.Where) {
+		t.Error("Expected bounds of another integer type to imply the condition")
+	}
+	notImplied := [][]Condition{
+		{{Field: "Priority", Value: []int{3, 6}, Operator: Between}},
+		{{Field: "Priority", Value: 3}},
+		{{Field: "Assignee", Value: []string{"3", "5"}, Operator: Between}},
+	}
+	for _, conjuncts := range notImplied {
+		if store.impliesConditions(conjuncts, urgent.Where) {
+			t.Errorf("Expected %+v not to imply the condition", conjuncts)
+		}
+	}
+}
+
+func TestPartialIndexDefinition(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	invalid := []PartialIndex{
+		{Name: "", Field: "Assignee", Where: openByAssignee.Where},
+		{Name: "Status", Field: "Assignee", Where: openByAssignee.Where},
+		{Name: "by_missing", Field: "Missing", Where: openByAssignee.Where},
+		{Name: "no_where", Field: "Assignee"},
+		{Name: "bad_where", Field: "Assignee", Where: []Condition{{Field: "Priority", Value: "high"}}},
+	}
+	for _, partial := range invalid {
+		if _, err := NewStore[TestTicket](db, "tickets", WithPartialIndex(partial)); !errors.As(err, &IndexDefinitionError{}) {
+			t.Errorf("Expected IndexDefinitionError for %+v, got %v", partial, err)
+		}
+	}
+	duplicate := []StoreOption{WithPartialIndex(openByAssignee), WithPartialIndex(openByAssignee)}
+	if _, err := NewStore[TestTicket](db, "tickets", duplicate...); !errors.As(err, &IndexDefinitionError{}) {
+		t.Errorf("Expected IndexDefinitionError for a duplicate partial index, got %v", err)
+	}
+}
+
+func expectTicketKeys(t *testing.T, results []TestTicket, expected []string) {
+	t.Helper()
+	keys := make([]string, len(results))
+	for i, result := range results {
+		keys[i] = result.ID
+	}
+	sort.Strings(keys)
+	expected = append([]string(nil), expected...)
+	sort.Strings(expected)
+	if fmt.Sprint(keys) != fmt.Sprint(expected) {
+		t.Fatalf("Expected %v, got %v", expected, keys)
+	}
+}
@@ -1,17 +1,18 @@
 package nnut
 
 import (
-	"bytes"
 	"context"
 	"reflect"
-
-	"github.com/vmihailenco/msgpack/v5"
 )
 
 // Put stores a single record in the database.
 // It automatically updates any indexes associated with the record.
 // The record's key field must be set and valid.
 func (s *Store[T]) Put(ctx context.Context, value T) error {
+	if err := s.checkWritable(); err != nil {
+		return err
+	}
+
 	// Retrieve the primary key via runtime type inspection
 	valueReflection := reflect.ValueOf(value)
 	key := valueReflection.Field(s.keyField).String()
@@ -21,191 +22,254 @@ func (s *Store[T]) Put(ctx context.Context, value T) error {
 
 	s.database.Logger().Debugf("Putting record with key %s in bucket %s", key, s.bucket)
 
+	// Hold the key until the write is buffered so concurrent writes cannot interleave
+	unlock := s.lockKey(key)
+	defer unlock()
+
 	// Fetch existing record to handle index changes
-	var oldIndexValues map[string]string
 	oldValue, err := s.Get(ctx, key)
-	if err == nil {
-		oldIndexValues = s.extractIndexValues(oldValue)
-	} else {
-		oldIndexValues = make(map[string]string)
+	dataOperation, indexChanges, modifiedIndexes, err := s.planPut(key, value, oldValue, err == nil)
+	if err != nil {
+		return err
 	}
 
-	newIndexValues := s.extractIndexValues(value)
+	// Create operations: data operation + index operations
+	ops := append([]operation{dataOperation}, indexMarkers(modifiedIndexes)...)
+	return s.database.writeWithIndexChanges(ctx, ops, indexChanges)
+}
 
-	// Update primary key index
-	if oldValue, err := s.Get(ctx, key); err == nil {
-		oldKey := reflect.ValueOf(oldValue).Field(s.keyField).String()
-		if oldKey != key {
-			s.indexes[primaryKeyIndexName].delete(oldKey, oldKey)
-		}
+// Insert stores a single record only if its key does not exist yet.
+// Returns an AlreadyExistsError without writing if the key exists, including as a pending write.
+func (s *Store[T]) Insert(ctx context.Context, value T) error {
+	return s.putIf(ctx, value, false)
+}
+
+// Replace stores a single record only if its key already exists.
+// Returns a KeyNotFoundError without writing if the key does not exist.
+func (s *Store[T]) Replace(ctx context.Context, value T) error {
+	return s.putIf(ctx, value, true)
+}
+
+// putIf stores a single record if the existence of its key matches exists
+func (s *Store[T]) putIf(ctx context.Context, value T, exists bool) error {
+	if err := s.checkWritable(); err != nil {
+		return err
 	}
-	s.indexes[primaryKeyIndexName].insert(key, key)
-
-	// Update B-tree indexes
-	for name := range s.indexFields {
-		oldValue := oldIndexValues[name]
-		newValue := newIndexValues[name]
-		if oldValue != newValue {
-			if oldValue != "" {
-				s.indexes[name].delete(oldValue, key)
-			}
-			if newValue != "" {
-				s.indexes[name].insert(newValue, key)
-			}
-		}
+
+	key := reflect.ValueOf(value).Field(s.keyField).String()
+	if err := validateKey(key); err != nil {
+		return err
+	}
+
+	unlock := s.lockKey(key)
+	defer unlock()
+	if err := s.checkExists(key, exists); err != nil {
+		return err
 	}
 
-	data, err := msgpack.Marshal(value)
+	s.database.Logger().Debugf("Putting record with key %s in bucket %s", key, s.bucket)
+	oldValue, err := s.Get(ctx, key)
+	dataOperation, indexChanges, modifiedIndexes, err := s.planPut(key, value, oldValue, err == nil)
 	if err != nil {
-		s.database.Logger().Errorf("Failed to marshal value for key %s in bucket %s: %v", key, s.bucket, err)
-		return WrappedError{Operation: "marshal", Bucket: string(s.bucket), Key: key, Err: err}
+		return err
 	}
+	ops := append([]operation{dataOperation}, indexMarkers(modifiedIndexes)...)
+	return s.database.writeWithIndexChanges(ctx, ops, indexChanges)
+}
+
+// InsertBatch stores multiple records only if none of their keys exist yet.
+// If any key exists, or appears more than once in values, an AlreadyExistsError is returned and nothing is written.
+func (s *Store[T]) InsertBatch(ctx context.Context, values []T) error {
+	return s.putBatchIf(ctx, values, false)
+}
 
-	// Collect modified indexes for buffering
-	modifiedIndexes := []string{primaryKeyIndexName} // Primary key is always modified
-	for name := range s.indexFields {
-		oldValue := oldIndexValues[name]
-		newValue := newIndexValues[name]
-		if oldValue != newValue {
-			modifiedIndexes = append(modifiedIndexes, name)
+// ReplaceBatch stores multiple records only if all of their keys already exist.
+// If any key does not exist a KeyNotFoundError is returned and nothing is written.
+func (s *Store[T]) ReplaceBatch(ctx context.Context, values []T) error {
+	return s.putBatchIf(ctx, values, true)
+}
+
+// putBatchIf stores multiple records if the existence of every key matches exists
+func (s *Store[T]) putBatchIf(ctx context.Context, values []T, exists bool) error {
+	if err := s.checkWritable(); err != nil {
+		return err
+	}
+
+	keys := make([]string, len(values))
+	for index, value := range values {
+		keys[index] = reflect.ValueOf(value).Field(s.keyField).String()
+		if err := validateKey(keys[index]); err != nil {
+			return err
 		}
 	}
 
-	// Create operations: data operation + index operations
-	ops := make([]operation, 1+len(modifiedIndexes))
-	ops[0] = operation{
-		Bucket: s.bucket,
-		Key:    key,
-		Value:  data,
-		Type:   OperationPut,
-	}
-
-	for i, indexName := range modifiedIndexes {
-		ops[i+1] = operation{
-			Bucket: []byte(btreeBucketName),
-			Key:    buildBTreeKey(string(s.bucket)+":", indexName),
-			Value:  nil, // Serialized on flush
-			Type:   OperationIndex,
+	unlock := s.lockKeys(keys)
+	defer unlock()
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if !exists && seen[key] {
+			return AlreadyExistsError{Bucket: string(s.bucket), Key: key}
+		}
+		seen[key] = true
+		if err := s.checkExists(key, exists); err != nil {
+			return err
 		}
 	}
 
-	return s.database.writeOperations(ctx, ops)
+	return s.putBatchLocked(ctx, values, keys)
+}
+
+// checkExists returns the error for a key whose existence does not match exists
+func (s *Store[T]) checkExists(key string, exists bool) error {
+	found := s.exists(key)
+	if found && !exists {
+		return AlreadyExistsError{Bucket: string(s.bucket), Key: key}
+	}
+	if !found && exists {
+		return KeyNotFoundError{Bucket: string(s.bucket), Key: key}
+	}
+	return nil
+}
+
+// PutIfVersion stores a single record only if the stored record still has the version of value.
+// A record that does not exist yet has version 0. On success the stored record gets the next version,
+// otherwise a VersionConflictError is returned and nothing is written.
+// The type must have a field tagged with `nnut:"version"`.
+func (s *Store[T]) PutIfVersion(ctx context.Context, value T) error {
+	if err := s.checkWritable(); err != nil {
+		return err
+	}
+
+	if s.versionField < 0 {
+		return VersionFieldNotFoundError{}
+	}
+	key := reflect.ValueOf(value).Field(s.keyField).String()
+	if err := validateKey(key); err != nil {
+		return err
+	}
+
+	s.database.Logger().Debugf("Putting record with key %s in bucket %s if version is %d", key, s.bucket, s.version(value))
+
+	unlock := s.lockKey(key)
+	defer unlock()
+
+	// The stored version includes pending writes in the buffer
+	oldValue, err := s.Get(ctx, key)
+	oldExists := err == nil
+	if err != nil {
+		if _, notFound := err.(KeyNotFoundError); !notFound {
+			return err
+		}
+	}
+	storedVersion := uint64(0)
+	if oldExists {
+		storedVersion = s.version(oldValue)
+	}
+	if expected := s.version(value); expected != storedVersion {
+		return VersionConflictError{Bucket: string(s.bucket), Key: key, Expected: expected, Actual: storedVersion}
+	}
+
+	dataOperation, indexChanges, modifiedIndexes, err := s.planPut(key, value, oldValue, oldExists)
+	if err != nil {
+		return err
+	}
+	ops := append([]operation{dataOperation}, indexMarkers(modifiedIndexes)...)
+	return s.database.writeWithIndexChanges(ctx, ops, indexChanges)
+}
+
+// PutTx stores a single record as part of a transaction.
+// The record and its index changes are only written when the transaction commits,
+// against the record stored under the key at that time.
+func (s *Store[T]) PutTx(tx *Tx, value T) error {
+	if err := s.checkWritable(); err != nil {
+		return err
+	}
+
+	key := reflect.ValueOf(value).Field(s.keyField).String()
+	if err := validateKey(key); err != nil {
+		return err
+	}
+
+	s.database.Logger().Debugf("Putting record with key %s in bucket %s in transaction", key, s.bucket)
+
+	// Earlier writes in the transaction take precedence over the stored record
+	plan := func() (operation, []indexChange, []string, error) {
+		oldValue, err := s.GetTx(tx, key)
+		return s.planPut(key, value, oldValue, err == nil)
+	}
+	dataOperation, _, _, err := plan()
+	if err != nil {
+		return err
+	}
+	return tx.add(dataOperation, txPlan{store: s, bucket: string(s.bucket), key: key, plan: plan})
 }
 
 // PutBatch stores multiple records in a single batch operation.
 // This is more efficient than calling Put multiple times.
 // All records must have valid keys set.
 func (s *Store[T]) PutBatch(ctx context.Context, values []T) error {
-	s.database.Logger().Debugf("Putting batch of %d records in bucket %s", len(values), s.bucket)
+	if err := s.checkWritable(); err != nil {
+		return err
+	}
+
 	// Collect primary keys from all values
 	keys := make([]string, len(values))
-	keyToValue := make(map[string]T)
 	for index, value := range values {
-		valueReflection := reflect.ValueOf(value)
-		key := valueReflection.Field(s.keyField).String()
-		if err := validateKey(key); err != nil {
+		keys[index] = reflect.ValueOf(value).Field(s.keyField).String()
+		if err := validateKey(keys[index]); err != nil {
 			return err
 		}
-		keys[index] = key
-		keyToValue[key] = value
+	}
+
+	// Hold the keys until the batch is buffered so concurrent writes cannot interleave
+	unlock := s.lockKeys(keys)
+	defer unlock()
+	return s.putBatchLocked(ctx, values, keys)
+}
+
+// putBatchLocked stores values under their keys, the caller must hold the locks of all keys
+func (s *Store[T]) putBatchLocked(ctx context.Context, values []T, keys []string) error {
+	s.database.Logger().Debugf("Putting batch of %d records in bucket %s", len(values), s.bucket)
+
+	// The last value of a key that appears more than once is stored
+	keyToValue := make(map[string]T, len(values))
+	var uniqueKeys []string
+	for index, key := range keys {
+		if _, seen := keyToValue[key]; !seen {
+			uniqueKeys = append(uniqueKeys, key)
+		}
+		keyToValue[key] = values[index]
 	}
 
 	// Retrieve existing records for index updates
-	oldValues, err := s.GetBatch(ctx, keys)
+	oldValues, err := s.GetBatch(ctx, uniqueKeys)
 	if err != nil {
 		return WrappedError{Operation: "get_batch", Bucket: string(s.bucket), Err: err}
 	}
 
-	// Collect all index operations for batching
-	indexInserts := make(map[string][]bTreeItem)
-	indexDeletes := make(map[string][]bTreeItem)
-
-	// Build operations for each record
+	// Build operations and index changes for each record
 	var operations []operation
-	for _, key := range keys {
-		value := keyToValue[key]
+	var indexChanges []indexChange
+	modifiedIndexes := make(map[string]bool)
+	for _, key := range uniqueKeys {
 		oldValue, exists := oldValues[key]
-		var oldIndexValues map[string]string
-		if exists {
-			oldIndexValues = s.extractIndexValues(oldValue)
-		} else {
-			oldIndexValues = make(map[string]string)
-		}
-
-		newIndexValues := s.extractIndexValues(value)
-
-		// Update primary key index
-		if oldValue, exists := oldValues[key]; exists {
-			oldKey := reflect.ValueOf(oldValue).Field(s.keyField).String()
-			if oldKey != key {
-				s.indexes[primaryKeyIndexName].delete(oldKey, oldKey)
-			}
-		}
-		s.indexes[primaryKeyIndexName].insert(key, key)
-
-		// Collect B-tree index operations for batching
-		for name := range s.indexFields {
-			oldVal := oldIndexValues[name]
-			newVal := newIndexValues[name]
-			if oldVal != newVal {
-				if oldVal != "" {
-					indexDeletes[name] = append(indexDeletes[name], bTreeItem{Key: oldVal, Value: key})
-				}
-				if newVal != "" {
-					indexInserts[name] = append(indexInserts[name], bTreeItem{Key: newVal, Value: key})
-				}
-			}
-		}
-
-		buf := bufferPool.Get().(*bytes.Buffer)
-		buf.Reset()
-		encoder := msgpack.NewEncoder(buf)
-		err = encoder.Encode(value)
+		dataOperation, changes, modified, err := s.planPut(key, keyToValue[key], oldValue, exists)
 		if err != nil {
-			bufferPool.Put(buf)
-			s.database.Logger().Errorf("Failed to encode value for key %s in bucket %s: %v", key, s.bucket, err)
-			return WrappedError{Operation: "encode", Bucket: string(s.bucket), Key: key, Err: err}
+			return err
 		}
-		data := make([]byte, buf.Len())
-		copy(data, buf.Bytes())
-
-		operation := operation{
-			Bucket: s.bucket,
-			Key:    key,
-			Value:  data,
-			Type:   OperationPut,
+		operations = append(operations, dataOperation)
+		indexChanges = append(indexChanges, changes...)
+		for _, indexKey := range modified {
+			modifiedIndexes[indexKey] = true
 		}
-		operations = append(operations, operation)
-		bufferPool.Put(buf)
-	}
-
-	// Apply batched index operations
-	for name, items := range indexDeletes {
-		s.indexes[name].bulkDelete(items)
-	}
-	for name, items := range indexInserts {
-		s.indexes[name].bulkInsert(items)
-	}
-
-	// Collect modified indexes for buffering
-	modifiedIndexes := make(map[string]bool)
-	modifiedIndexes[primaryKeyIndexName] = true // Primary key is always modified
-	for name := range indexInserts {
-		modifiedIndexes[name] = true
-	}
-	for name := range indexDeletes {
-		modifiedIndexes[name] = true
 	}
 
-	// Create index operations
-	for indexName := range modifiedIndexes {
-		operations = append(operations, operation{
-			Bucket: []byte(btreeBucketName),
-			Key:    buildBTreeKey(string(s.bucket)+":", indexName),
-			Value:  nil, // Serialized on flush
-			Type:   OperationIndex,
-		})
+	indexKeys := make([]string, 0, len(modifiedIndexes))
+	for indexKey := range modifiedIndexes {
+		indexKeys = append(indexKeys, indexKey)
 	}
+	operations = append(operations, indexMarkers(indexKeys)...)
 
-	return s.database.writeOperations(ctx, operations)
+	// The whole batch is rejected before touching any index if it breaks a unique index
+	return s.database.writeWithIndexChanges(ctx, operations, indexChanges)
 }
@@ -4,18 +4,13 @@ import (
 	"bytes"
 	"reflect"
 	"sort"
+	"strings"
 	"sync"
 
 	"github.com/vmihailenco/msgpack/v5"
 	"go.etcd.io/bbolt"
 )
 
-var bufferPool = sync.Pool{
-	New: func() interface{} {
-		return &bytes.Buffer{}
-	},
-}
-
 var mapPool = sync.Pool{
 	New: func() interface{} {
 		return make(map[string]bool)
@@ -30,6 +25,14 @@ const (
 	LessThan
 	GreaterThanOrEqual
 	LessThanOrEqual
+	NotEquals
+	In      // Value is a []string, []int or []interface{} of accepted values
+	Between // Value is a slice of an inclusive lower and upper bound
+	HasPrefix
+	Wildcard // Value ending in * matches values starting with the rest, otherwise equal values
+	Contains // Value is an element of a slice field
+	MatchAll // Value is text whose terms all occur in a full-text field
+	MatchAny // Value is text of which any term occurs in a full-text field
 )
 
 type Sorting int
@@ -44,24 +47,77 @@ const (
 // Field is the name of the field to filter on.
 // Value is the value to compare against.
 // Operator specifies the comparison type (Equals, GreaterThan, etc.).
+// In and Between take a slice of values instead of a single value.
+// Slice fields are only queried with Contains, which takes a single element.
 type Condition struct {
 	Field    string
 	Value    interface{}
 	Operator Operator
 }
 
+// Expression is a boolean combination of conditions.
+// Exactly one of Condition, And, Or and Not is set, use Match, And, Or and Not to build expressions.
+type Expression struct {
+	Condition *Condition
+	And       []Expression
+	Or        []Expression
+	Not       *Expression
+}
+
+// Match returns an expression that matches records satisfying the condition.
+func Match(condition Condition) Expression {
+	return Expression{Condition: &condition}
+}
+
+// And returns an expression that matches records matching all of the expressions.
+func And(expressions ...Expression) Expression {
+	return Expression{And: expressions}
+}
+
+// Or returns an expression that matches records matching any of the expressions.
+func Or(expressions ...Expression) Expression {
+	return Expression{Or: expressions}
+}
+
+// Not returns an expression that matches records not matching the expression.
+func Not(expression Expression) Expression {
+	return Expression{Not: &expression}
+}
+
+// isZero reports whether no part of the expression is set
+func (e Expression) isZero() bool {
+	return e.Condition == nil && len(e.And) == 0 && len(e.Or) == 0 && e.Not == nil
+}
+
+// children returns the operands of an And or Or expression
+func (e Expression) children() []Expression {
+	if len(e.And) > 0 {
+		return e.And
+	}
+	return e.Or
+}
+
 // Query defines parameters for retrieving records from the store.
 // Index specifies which field to use for sorting (must be an indexed field).
 // Limit restricts the number of results (0 means no limit).
 // Offset skips the first N results.
 // Sort specifies ascending or descending order.
 // Conditions is a list of filters to apply.
+// Filter is an expression of conditions combined with And, Or and Not, ANDed with Conditions.
+// OrderBy sorts by several fields, indexed or not, and cannot be combined with Index.
 type Query struct {
 	Index      string
 	Limit      int
 	Offset     int
 	Sort       Sorting
 	Conditions []Condition
+	Filter     Expression
+	OrderBy    []SortField
+}
+
+// filtered reports whether the query has conditions or a filter
+func (q *Query) filtered() bool {
+	return len(q.Conditions) > 0 || !q.Filter.isZero()
 }
 
 type condWithSize struct {
@@ -84,25 +140,180 @@ func (s *Store[T]) validateQuery(query *Query) error {
 		if _, exists := s.indexFields[query.Index]; !exists {
 			return InvalidQueryError{Field: "Index", Value: query.Index, Reason: "index field does not exist"}
 		}
+		if s.multiValueFields[query.Index] {
+			return InvalidQueryError{Field: "Index", Value: query.Index, Reason: "cannot sort by a slice field"}
+		}
+	}
+	if err := s.validateOrderBy(query); err != nil {
+		return err
 	}
 	// Validate conditions
 	for _, cond := range query.Conditions {
-		if _, exists := s.fieldMap[cond.Field]; !exists {
-			return InvalidQueryError{Field: "Condition.Field", Value: cond.Field, Reason: "field does not exist"}
-		}
-		// Check if value is comparable (string or int)
-		if cond.Value != nil {
-			switch cond.Value.(type) {
-			case string, int:
-				// ok
-			default:
-				return InvalidQueryError{Field: "Condition.Value", Value: cond.Value, Reason: "must be string or int"}
+		if err := s.validateCondition(cond); err != nil {
+			return err
+		}
+	}
+	if !query.Filter.isZero() {
+		return s.validateExpression(query.Filter)
+	}
+	return nil
+}
+
+// validateCondition validates a single condition
+func (s *Store[T]) validateCondition(cond Condition) error {
+	if _, exists := s.fieldMap[cond.Field]; !exists {
+		return InvalidQueryError{Field: "Condition.Field", Value: cond.Field, Reason: "field does not exist"}
+	}
+	if isTextOperator(cond.Operator) {
+		if !s.fulltextFields[cond.Field] {
+			return InvalidQueryError{Field: "Condition.Field", Value: cond.Field, Reason: "MatchAll and MatchAny require a fulltext field"}
+		}
+		if value, isString := cond.Value.(string); !isString || len(textTerms(value)) == 0 {
+			return InvalidQueryError{Field: "Condition.Value", Value: cond.Value, Reason: "must be a string with at least one term"}
+		}
+		return nil
+	}
+	encoder, orderable := s.encoders[cond.Field]
+	if cond.Operator == Contains || s.multiValueFields[cond.Field] {
+		if !s.multiValueFields[cond.Field] {
+			return InvalidQueryError{Field: "Condition.Field", Value: cond.Field, Reason: "Contains requires a slice field"}
+		}
+		if cond.Operator != Contains {
+			return InvalidQueryError{Field: "Condition.Operator", Value: cond.Operator, Reason: "slice fields only support Contains"}
+		}
+		if _, ok := encodeValue(encoder, cond.Value); !ok {
+			return InvalidQueryError{Field: "Condition.Value", Value: cond.Value, Reason: "does not match the element type of field " + cond.Field}
+		}
+		return nil
+	}
+	if cond.Operator == In || cond.Operator == Between {
+		values, ok := conditionValues(cond.Value)
+		if !ok {
+			return InvalidQueryError{Field: "Condition.Value", Value: cond.Value, Reason: "must be a slice of values"}
+		}
+		if cond.Operator == Between && len(values) != 2 {
+			return InvalidQueryError{Field: "Condition.Value", Value: cond.Value, Reason: "must hold a lower and an upper bound"}
+		}
+		for _, value := range values {
+			if _, ok := encodeValue(encoder, value); !orderable || !ok {
+				return InvalidQueryError{Field: "Condition.Value", Value: value, Reason: "does not match the type of field " + cond.Field}
 			}
 		}
+		return nil
+	}
+	if cond.Operator == HasPrefix || cond.Operator == Wildcard {
+		value, isString := cond.Value.(string)
+		if !isString {
+			return InvalidQueryError{Field: "Condition.Value", Value: cond.Value, Reason: "must be a string"}
+		}
+		if s.fieldType(cond.Field).Kind() != reflect.String {
+			return InvalidQueryError{Field: "Condition.Field", Value: cond.Field, Reason: "must be a string field"}
+		}
+		if cond.Operator == Wildcard && strings.Contains(strings.TrimSuffix(value, "*"), "*") {
+			return InvalidQueryError{Field: "Condition.Value", Value: cond.Value, Reason: "only a trailing * wildcard is supported"}
+		}
+		return nil
+	}
+	// Check if value can be ordered together with the field's values
+	if cond.Value != nil {
+		if !orderable {
+			return InvalidQueryError{Field: "Condition.Field", Value: cond.Field, Reason: "field type cannot be queried"}
+		}
+		if _, ok := encodeValue(encoder, cond.Value); !ok {
+			return InvalidQueryError{Field: "Condition.Value", Value: cond.Value, Reason: "does not match the type of field " + cond.Field}
+		}
 	}
 	return nil
 }
 
+// wildcardPrefix returns the prefix of a trailing * wildcard and whether the pattern has one
+func wildcardPrefix(pattern string) (string, bool) {
+	if strings.HasSuffix(pattern, "*") {
+		return strings.TrimSuffix(pattern, "*"), true
+	}
+	return pattern, false
+}
+
+// conditionValues returns the values of an In or Between condition
+func conditionValues(value interface{}) ([]interface{}, bool) {
+	reflected := reflect.ValueOf(value)
+	if value == nil || (reflected.Kind() != reflect.Slice && reflected.Kind() != reflect.Array) {
+		return nil, false
+	}
+	values := make([]interface{}, reflected.Len())
+	for i := range values {
+		values[i] = reflected.Index(i).Interface()
+	}
+	return values, true
+}
+
+// validateExpression validates an expression and all conditions in it
+func (s *Store[T]) validateExpression(expression Expression) error {
+	parts := 0
+	if expression.Condition != nil {
+		parts++
+	}
+	if len(expression.And) > 0 {
+		parts++
+	}
+	if len(expression.Or) > 0 {
+		parts++
+	}
+	if expression.Not != nil {
+		parts++
+	}
+	if parts != 1 {
+		return InvalidQueryError{Field: "Filter", Value: parts, Reason: "expression must set exactly one of Condition, And, Or and Not"}
+	}
+
+	switch {
+	case expression.Condition != nil:
+		return s.validateCondition(*expression.Condition)
+	case expression.Not != nil:
+		return s.validateExpression(*expression.Not)
+	}
+	for _, child := range expression.children() {
+		if err := s.validateExpression(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getQueryKeysTx returns the keys selected by the query before offset and limit are applied
+func (s *Store[T]) getQueryKeysTx(transaction *bbolt.Tx, query *Query, maxKeys int) []string {
+	// Partial indexes implied by the query stand in for the indexes of their fields
+	if view := s.partialIndexView(query); view != nil {
+		return view.getQueryKeysTx(transaction, query, maxKeys)
+	}
+	if !query.Filter.isZero() {
+		expression := query.Filter
+		if len(query.Conditions) > 0 {
+			expressions := make([]Expression, 0, len(query.Conditions)+1)
+			for _, condition := range query.Conditions {
+				expressions = append(expressions, Match(condition))
+			}
+			expression = And(append(expressions, expression)...)
+		}
+		keys := s.getKeysForExpressionTx(transaction, expression)
+		// Set operations lose the key order, restore it so pagination is stable
+		sort.Strings(keys)
+		if maxKeys > 0 && len(keys) > maxKeys {
+			keys = keys[:maxKeys]
+		}
+		return keys
+	}
+	if len(query.Conditions) > 0 {
+		return s.getCandidateKeysTx(transaction, query.Conditions, maxKeys)
+	}
+	if query.Index != "" {
+		// When no conditions but sorting is required, use the index directly
+		return s.getKeysFromIndexTx(transaction, query.Index, query.Sort, maxKeys)
+	}
+	// Fallback to scanning all keys when no optimizations apply
+	return s.getAllKeysTx(transaction, maxKeys)
+}
+
 // // getCandidateKeys returns keys that match all conditions
 // func (s *Store[T]) getCandidateKeys(conditions []Condition, maxKeys int) []string {
 // 	var keys []string
@@ -139,16 +350,30 @@ func (s *Store[T]) getCandidateKeysTx(transaction *bbolt.Tx, conditions []Condit
 		return s.getAllKeysTx(transaction, maxKeys)
 	}
 
+	// A composite index answers the conditions it covers with a single range search
+	var compositeKeys []string
+	plan, planned := s.planCompositeIndex(conditions)
+	if planned {
+		var remaining []Condition
+		for _, position := range plan.uncoveredPositions(len(conditions)) {
+			remaining = append(remaining, conditions[position])
+		}
+		if len(remaining) == 0 {
+			return s.getKeysForCompositePlan(plan, maxKeys)
+		}
+		compositeKeys = s.getKeysForCompositePlan(plan, 0)
+		if len(compositeKeys) == 0 {
+			return nil
+		}
+		conditions = remaining
+	}
+
 	// Partition conditions to leverage indexes where possible
 	var indexedConditions []Condition
 	var nonIndexedConditions []Condition
 	for _, condition := range conditions {
-		if _, ok := s.indexFields[condition.Field]; ok && condition.Value != nil {
-			if _, isString := condition.Value.(string); isString {
-				indexedConditions = append(indexedConditions, condition)
-			} else {
-				nonIndexedConditions = append(nonIndexedConditions, condition)
-			}
+		if s.isIndexedCondition(condition) {
+			indexedConditions = append(indexedConditions, condition)
 		} else {
 			nonIndexedConditions = append(nonIndexedConditions, condition)
 		}
@@ -156,7 +381,12 @@ func (s *Store[T]) getCandidateKeysTx(transaction *bbolt.Tx, conditions []Condit
 
 	// Get key sets from indexed conditions, starting with the shortest
 	var indexedKeys []string
-	if len(indexedConditions) > 0 {
+	if planned {
+		indexedKeys = compositeKeys
+		for _, condition := range indexedConditions {
+			indexedKeys = intersectSlices(indexedKeys, s.getKeysForConditionTx(transaction, condition, 0))
+		}
+	} else if len(indexedConditions) > 0 {
 		var conditionSizes []condWithSize
 		for _, condition := range indexedConditions {
 			size := s.countKeysForConditionTx(transaction, condition, maxKeys)
@@ -185,7 +415,7 @@ func (s *Store[T]) getCandidateKeysTx(transaction *bbolt.Tx, conditions []Condit
 	if len(nonIndexedConditions) > 0 {
 		// If we have indexed keys, scan only those; otherwise scan all
 		var candidates []string
-		if len(indexedConditions) > 0 {
+		if planned || len(indexedConditions) > 0 {
 			candidates = indexedKeys
 		}
 		nonIndexedKeys = s.scanForConditionsTx(transaction, nonIndexedConditions, candidates, maxKeys)
@@ -195,7 +425,7 @@ func (s *Store[T]) getCandidateKeysTx(transaction *bbolt.Tx, conditions []Condit
 	if len(nonIndexedConditions) == 0 {
 		return indexedKeys
 	}
-	if len(indexedConditions) == 0 {
+	if !planned && len(indexedConditions) == 0 {
 		return nonIndexedKeys
 	}
 	// Intersect the two
@@ -215,18 +445,63 @@ func (s *Store[T]) getCandidateKeysTx(transaction *bbolt.Tx, conditions []Condit
 // getKeysForConditionTx returns keys that match the condition, sorted
 func (s *Store[T]) getKeysForConditionTx(transaction *bbolt.Tx, condition Condition, maxKeys int) []string {
 	var keys []string
-	_, indexed := s.indexFields[condition.Field]
-	valueString, isString := condition.Value.(string)
-	if !indexed || !isString {
+	if !s.isIndexedCondition(condition) {
 		// This should not happen, as we separate indexed and non-indexed
 		return keys
 	}
 
+	// Operators taking several values or excluding a value
+	switch condition.Operator {
+	case MatchAll, MatchAny:
+		return s.getKeysForTextCondition(condition, maxKeys)
+	case In:
+		values, _ := conditionValues(condition.Value)
+		for _, value := range values {
+			encoded, _ := s.conditionIndexValue(condition.Field, value)
+			keys = unionSlices(keys, s.indexes[condition.Field].search(encoded))
+		}
+		if maxKeys > 0 && len(keys) > maxKeys {
+			keys = keys[:maxKeys]
+		}
+		return keys
+	case Between:
+		values, _ := conditionValues(condition.Value)
+		min, _ := s.conditionIndexValue(condition.Field, values[0])
+		max, _ := s.conditionIndexValue(condition.Field, values[1])
+		if max == "" {
+			// An empty bound means unbounded to rangeSearch, and empty values are not indexed
+			return keys
+		}
+		btreeKeys := s.indexes[condition.Field].rangeSearch(min, max, true, true)
+		if maxKeys > 0 && len(btreeKeys) > maxKeys {
+			btreeKeys = btreeKeys[:maxKeys]
+		}
+		return append(keys, btreeKeys...)
+	case HasPrefix, Wildcard:
+		prefix, isPrefix := condition.Value.(string), true
+		if condition.Operator == Wildcard {
+			prefix, isPrefix = wildcardPrefix(prefix)
+		}
+		if isPrefix {
+			// Walk only the index range of the prefix and stop once enough keys are found
+			return s.indexes[condition.Field].prefixSearch(s.collate(condition.Field, prefix), maxKeys)
+		}
+	case NotEquals:
+		// Records with an empty value are not in the index but still differ from the value
+		encoded, _ := s.conditionIndexValue(condition.Field, condition.Value)
+		keys = subtractSlices(s.indexes[primaryKeyIndexName].getAllKeys(), s.indexes[condition.Field].search(encoded))
+		if maxKeys > 0 && len(keys) > maxKeys {
+			keys = keys[:maxKeys]
+		}
+		return keys
+	}
+
 	// Use B-tree index
+	valueString, _ := s.conditionIndexValue(condition.Field, condition.Value)
 	var min, max string
 	var includeMin, includeMax bool
 	switch condition.Operator {
-	case Equals:
+	case Equals, Wildcard, Contains:
 		btreeKeys := s.indexes[condition.Field].search(valueString)
 		for _, key := range btreeKeys {
 			if maxKeys > 0 && len(keys) >= maxKeys {
@@ -361,48 +636,83 @@ func (s *Store[T]) countKeysForConditionTx(transaction *bbolt.Tx, condition Cond
 
 // matchesCondition checks if the item matches the condition
 func (s *Store[T]) matchesCondition(item T, condition Condition) bool {
-	itemValue := reflect.ValueOf(item)
-	if fieldIndex, ok := s.fieldMap[condition.Field]; ok {
-		fieldValue := itemValue.Field(fieldIndex)
-		switch condition.Operator {
-		case Equals:
-			return reflect.DeepEqual(fieldValue.Interface(), condition.Value)
-		case GreaterThan:
-			return compare(fieldValue.Interface(), condition.Value) > 0
-		case LessThan:
-			return compare(fieldValue.Interface(), condition.Value) < 0
-		case GreaterThanOrEqual:
-			return compare(fieldValue.Interface(), condition.Value) >= 0
-		case LessThanOrEqual:
-			return compare(fieldValue.Interface(), condition.Value) <= 0
+	if _, ok := s.fieldMap[condition.Field]; !ok {
+		return false
+	}
+	fieldValue := s.fieldValue(reflect.ValueOf(item), condition.Field)
+	switch condition.Operator {
+	case MatchAll, MatchAny:
+		return fieldValue.Kind() == reflect.String && matchesText(fieldValue.String(), condition)
+	case Contains:
+		if fieldValue.Kind() != reflect.Slice {
+			return false
 		}
+		for i := 0; i < fieldValue.Len(); i++ {
+			if comparison, ok := s.compareField(condition.Field, fieldValue.Index(i), condition.Value); ok && comparison == 0 {
+				return true
+			}
+		}
+		return false
+	case HasPrefix:
+		return fieldValue.Kind() == reflect.String && strings.HasPrefix(s.collate(condition.Field, fieldValue.String()), s.collate(condition.Field, condition.Value.(string)))
+	case Wildcard:
+		if fieldValue.Kind() != reflect.String {
+			return false
+		}
+		value := s.collate(condition.Field, fieldValue.String())
+		if prefix, isPrefix := wildcardPrefix(condition.Value.(string)); isPrefix {
+			return strings.HasPrefix(value, s.collate(condition.Field, prefix))
+		}
+		return value == s.collate(condition.Field, condition.Value.(string))
+	case In:
+		values, _ := conditionValues(condition.Value)
+		for _, value := range values {
+			if comparison, ok := s.compareField(condition.Field, fieldValue, value); ok && comparison == 0 {
+				return true
+			}
+		}
+		return false
+	case Between:
+		values, ok := conditionValues(condition.Value)
+		if !ok || len(values) != 2 {
+			return false
+		}
+		lower, lowerOk := s.compareField(condition.Field, fieldValue, values[0])
+		upper, upperOk := s.compareField(condition.Field, fieldValue, values[1])
+		return lowerOk && upperOk && lower >= 0 && upper <= 0
+	}
+
+	comparison, ok := s.compareField(condition.Field, fieldValue, condition.Value)
+	switch condition.Operator {
+	case Equals:
+		return ok && comparison == 0
+	case NotEquals:
+		return !ok || comparison != 0
+	case GreaterThan:
+		return ok && comparison > 0
+	case LessThan:
+		return ok && comparison < 0
+	case GreaterThanOrEqual:
+		return ok && comparison >= 0
+	case LessThanOrEqual:
+		return ok && comparison <= 0
 	}
 	return false
 }
 
-// compare compares two values, assumes comparable types
-func compare(a, b interface{}) int {
-	switch va := a.(type) {
-	case string:
-		if vb, ok := b.(string); ok {
-			if va < vb {
-				return -1
-			} else if va > vb {
-				return 1
-			}
-			return 0
-		}
-	case int:
-		if vb, ok := b.(int); ok {
-			if va < vb {
-				return -1
-			} else if va > vb {
-				return 1
-			}
-			return 0
-		}
+// compareField compares a field value with a condition value using the field's encoder.
+// ok is false if the field type cannot be ordered or the value does not match it.
+func (s *Store[T]) compareField(field string, fieldValue reflect.Value, value interface{}) (comparison int, ok bool) {
+	encoder, orderable := s.encoders[field]
+	if !orderable {
+		return 0, false
 	}
-	return 0 // not comparable, treat as equal
+	encodedField, fieldOk := s.encodeField(field, fieldValue)
+	encodedValue, valueOk := encodeValue(encoder, value)
+	if !fieldOk || !valueOk {
+		return 0, false
+	}
+	return strings.Compare(encodedField, encodedValue), true
 }
 
 // getAllKeysTx returns all keys in the bucket, sorted, up to maxKeys if >0
@@ -424,14 +734,26 @@ func (s *Store[T]) getAllKeysTx(transaction *bbolt.Tx, maxKeys int) []string {
 	return keys
 }
 
-// getKeysFromIndexTx returns all keys sorted by the index
+// getKeysFromIndexTx returns all keys in the order of the index, up to maxKeys if >0.
+// Keys with equal values are ordered by key. Records with an empty value are not in the index,
+// they sort before all others as in orderKeysByIndex.
 func (s *Store[T]) getKeysFromIndexTx(transaction *bbolt.Tx, index string, sorting Sorting, maxKeys int) []string {
-	keys := s.indexes[index].getAllKeys()
-	if sorting == Descending {
-		// Reverse the slice
-		for i, j := 0, len(keys)-1; i < j; i, j = i+1, j-1 {
-			keys[i], keys[j] = keys[j], keys[i]
+	missing := s.keysMissingFromIndex(index)
+	var keys []string
+	if sorting != Descending {
+		keys = missing
+	}
+	s.indexes[index].walkValues(sorting == Descending, func(recordKeys []string) bool {
+		if maxKeys > 0 && len(keys) >= maxKeys {
+			return false
 		}
+		start := len(keys)
+		keys = append(keys, recordKeys...)
+		sort.Strings(keys[start:])
+		return true
+	})
+	if sorting == Descending {
+		keys = append(keys, missing...)
 	}
 	if maxKeys > 0 && len(keys) > maxKeys {
 		keys = keys[:maxKeys]
@@ -439,6 +761,27 @@ func (s *Store[T]) getKeysFromIndexTx(transaction *bbolt.Tx, index string, sorti
 	return keys
 }
 
+// keysMissingFromIndex returns the sorted keys of the records that are not in the field index
+func (s *Store[T]) keysMissingFromIndex(index string) []string {
+	if s.indexes[index].countKeys() >= s.indexes[primaryKeyIndexName].countKeys() {
+		return nil
+	}
+	indexed := make(map[string]bool)
+	s.indexes[index].walkValues(false, func(recordKeys []string) bool {
+		for _, key := range recordKeys {
+			indexed[key] = true
+		}
+		return true
+	})
+	var missing []string
+	for _, key := range s.indexes[primaryKeyIndexName].getAllKeys() {
+		if !indexed[key] {
+			missing = append(missing, key)
+		}
+	}
+	return missing
+}
+
 // scanForConditionsTx scans records and returns keys matching all conditions
 // If candidates is not nil, only scans those keys; otherwise scans all.
 // Limits to maxKeys if >0.
@@ -508,34 +851,255 @@ func (s *Store[T]) scanForConditionsTx(transaction *bbolt.Tx, conditions []Condi
 	return keys
 }
 
-// intersectSlices intersects two key slices, returning keys in base that are also in other
-func intersectSlices(base, other []string) []string {
+// isIndexedCondition reports whether the condition can be answered from its field's index
+func (s *Store[T]) isIndexedCondition(condition Condition) bool {
+	if isTextOperator(condition.Operator) {
+		return s.fulltextFields[condition.Field]
+	}
+	if _, indexed := s.indexFields[condition.Field]; !indexed {
+		return false
+	}
+	if condition.Operator == In || condition.Operator == Between {
+		values, ok := conditionValues(condition.Value)
+		if !ok {
+			return false
+		}
+		for _, value := range values {
+			if _, ok := s.conditionIndexValue(condition.Field, value); !ok {
+				return false
+			}
+		}
+		return true
+	}
+	_, ok := s.conditionIndexValue(condition.Field, condition.Value)
+	return ok
+}
+
+// conditionIndexValue returns the index representation of a condition value,
+// if the value can be ordered together with the indexed field's values
+func (s *Store[T]) conditionIndexValue(field string, value interface{}) (string, bool) {
+	encoder, indexed := s.encoders[field]
+	if !indexed {
+		return "", false
+	}
+	return encodeValue(encoder, value)
+}
+
+// isIndexedExpression reports whether every condition in the expression can be answered from an index
+func (s *Store[T]) isIndexedExpression(expression Expression) bool {
+	switch {
+	case expression.Condition != nil:
+		return s.isIndexedCondition(*expression.Condition)
+	case expression.Not != nil:
+		return s.isIndexedExpression(*expression.Not)
+	}
+	for _, child := range expression.children() {
+		if !s.isIndexedExpression(child) {
+			return false
+		}
+	}
+	return true
+}
+
+// getKeysForExpressionTx returns keys matching the expression.
+// Indexed parts are combined with set operations, the remaining parts are checked by scanning records.
+func (s *Store[T]) getKeysForExpressionTx(transaction *bbolt.Tx, expression Expression) []string {
+	switch {
+	case expression.Condition != nil:
+		if s.isIndexedCondition(*expression.Condition) {
+			return s.getKeysForConditionTx(transaction, *expression.Condition, 0)
+		}
+		return s.scanForExpressionTx(transaction, expression, nil)
+	case len(expression.And) > 0:
+		keys, children, planned := s.getKeysForCompositeExpressionsTx(expression.And)
+		if planned && len(keys) == 0 {
+			return nil
+		}
+		var indexed, scanned []Expression
+		for _, child := range children {
+			if s.isIndexedExpression(child) {
+				indexed = append(indexed, child)
+			} else {
+				scanned = append(scanned, child)
+			}
+		}
+		if !planned && len(indexed) == 0 {
+			return s.scanForExpressionTx(transaction, expression, nil)
+		}
+		if !planned {
+			keys = s.getKeysForExpressionTx(transaction, indexed[0])
+			indexed = indexed[1:]
+		}
+		for _, child := range indexed {
+			if len(keys) == 0 {
+				return nil
+			}
+			keys = intersectSlices(keys, s.getKeysForExpressionTx(transaction, child))
+		}
+		if len(scanned) == 0 || len(keys) == 0 {
+			return keys
+		}
+		// Only the records left by the indexed parts need to be scanned
+		return s.scanForExpressionTx(transaction, And(scanned...), keys)
+	case len(expression.Or) > 0:
+		if !s.isIndexedExpression(expression) {
+			// A single scan is cheaper than a scan per unindexed branch
+			return s.scanForExpressionTx(transaction, expression, nil)
+		}
+		var keys []string
+		for _, child := range expression.Or {
+			keys = unionSlices(keys, s.getKeysForExpressionTx(transaction, child))
+		}
+		return keys
+	case expression.Not != nil:
+		if !s.isIndexedExpression(*expression.Not) {
+			return s.scanForExpressionTx(transaction, expression, nil)
+		}
+		return subtractSlices(s.indexes[primaryKeyIndexName].getAllKeys(), s.getKeysForExpressionTx(transaction, *expression.Not))
+	}
+	return s.getAllKeysTx(transaction, 0)
+}
+
+// getKeysForCompositeExpressionsTx answers the condition operands of an And expression with a composite index if one covers them.
+// It returns the keys in the composite range and the operands left to evaluate.
+func (s *Store[T]) getKeysForCompositeExpressionsTx(operands []Expression) ([]string, []Expression, bool) {
+	var conditions []Condition
+	var conditionOperands []int
+	var remaining []Expression
+	for position, operand := range operands {
+		if operand.Condition != nil {
+			conditions = append(conditions, *operand.Condition)
+			conditionOperands = append(conditionOperands, position)
+		}
+	}
+	plan, planned := s.planCompositeIndex(conditions)
+	if !planned {
+		return nil, operands, false
+	}
+	covered := make(map[int]bool, len(plan.covered))
+	for _, position := range plan.covered {
+		covered[conditionOperands[position]] = true
+	}
+	for position, operand := range operands {
+		if !covered[position] {
+			remaining = append(remaining, operand)
+		}
+	}
+	return s.getKeysForCompositePlan(plan, 0), remaining, true
+}
+
+// matchesExpression checks if the item matches the expression
+func (s *Store[T]) matchesExpression(item T, expression Expression) bool {
+	switch {
+	case expression.Condition != nil:
+		return s.matchesCondition(item, *expression.Condition)
+	case len(expression.And) > 0:
+		for _, child := range expression.And {
+			if !s.matchesExpression(item, child) {
+				return false
+			}
+		}
+		return true
+	case len(expression.Or) > 0:
+		for _, child := range expression.Or {
+			if s.matchesExpression(item, child) {
+				return true
+			}
+		}
+		return false
+	case expression.Not != nil:
+		return !s.matchesExpression(item, *expression.Not)
+	}
+	return true
+}
+
+// matchesQuery reports whether the item satisfies the conditions and the filter of the query
+func (s *Store[T]) matchesQuery(item T, query *Query) bool {
+	for _, condition := range query.Conditions {
+		if !s.matchesCondition(item, condition) {
+			return false
+		}
+	}
+	return s.matchesExpression(item, query.Filter)
+}
+
+// scanForExpressionTx scans records and returns keys matching the expression
+// If candidates is not nil, only scans those keys; otherwise scans all.
+func (s *Store[T]) scanForExpressionTx(transaction *bbolt.Tx, expression Expression, candidates []string) []string {
+	var keys []string
+	bucket := transaction.Bucket(s.bucket)
+	if bucket == nil {
+		return keys
+	}
+	decoder := msgpack.GetDecoder()
+	defer msgpack.PutDecoder(decoder)
+	matches := func(key, data []byte) {
+		var item T
+		decoder.Reset(bytes.NewReader(data))
+		if err := decoder.Decode(&item); err != nil {
+			// Skip records that cannot be decoded
+			return
+		}
+		if s.matchesExpression(item, expression) {
+			keys = append(keys, string(key))
+		}
+	}
+	if candidates != nil {
+		for _, key := range candidates {
+			if data := bucket.Get([]byte(key)); data != nil {
+				matches([]byte(key), data)
+			}
+		}
+		return keys
+	}
+	cursor := bucket.Cursor()
+	for keyBytes, valueBytes := cursor.First(); keyBytes != nil; keyBytes, valueBytes = cursor.Next() {
+		matches(keyBytes, valueBytes)
+	}
+	return keys
+}
+
+// unionSlices returns the keys in base followed by the keys in other that are not in base
+func unionSlices(base, other []string) []string {
 	baseMap := make(map[string]bool, len(base))
 	for _, k := range base {
 		baseMap[k] = true
 	}
-	var result []string
 	for _, k := range other {
-		if baseMap[k] {
+		if !baseMap[k] {
+			base = append(base, k)
+			baseMap[k] = true
+		}
+	}
+	return base
+}
+
+// subtractSlices returns the keys in base that are not in other
+func subtractSlices(base, other []string) []string {
+	otherMap := make(map[string]bool, len(other))
+	for _, k := range other {
+		otherMap[k] = true
+	}
+	var result []string
+	for _, k := range base {
+		if !otherMap[k] {
 			result = append(result, k)
 		}
 	}
 	return result
 }
 
-// sortResults sorts the results by the index field
-func (s *Store[T]) sortResults(results []T, index string, sorting Sorting) {
-	fieldIndex, ok := s.indexFields[index]
-	if !ok {
-		return
+// intersectSlices intersects two key slices, returning keys in base that are also in other
+func intersectSlices(base, other []string) []string {
+	baseMap := make(map[string]bool, len(base))
+	for _, k := range base {
+		baseMap[k] = true
 	}
-	sort.Slice(results, func(i, j int) bool {
-		valueA := reflect.ValueOf(results[i]).Field(fieldIndex)
-		valueB := reflect.ValueOf(results[j]).Field(fieldIndex)
-		comparison := compare(valueA.Interface(), valueB.Interface())
-		if sorting == Descending {
-			return comparison > 0
+	var result []string
+	for _, k := range other {
+		if baseMap[k] {
+			result = append(result, k)
 		}
-		return comparison < 0
-	})
+	}
+	return result
 }
@@ -2,10 +2,16 @@ package nnut
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
+	"sort"
 	"testing"
+	"time"
+
+	"go.etcd.io/bbolt"
 )
 
 func TestQuery(t *testing.T) {
@@ -1391,3 +1397,892 @@ func TestCountQueryIndexWithBufferedOperations(t *testing.T) {
 		t.Fatalf("Expected count 3 by Name index (after delete), got %d", count)
 	}
 }
+
+func TestQueryFilter(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	store, err := NewStore[TestUser](db, "users")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	users := []TestUser{
+		{UUID: "1", Name: "Alice", Email: "alice@example.com", Age: 30},
+		{UUID: "2", Name: "Bob", Email: "bob@example.com", Age: 25},
+		{UUID: "3", Name: "Alice", Email: "alice2@example.com", Age: 35},
+		{UUID: "4", Name: "Charlie", Email: "charlie@example.com", Age: 40},
+	}
+	if err := store.PutBatch(context.Background(), users); err != nil {
+		t.Fatalf("Failed to put batch: %v", err)
+	}
+	db.Flush()
+
+	tests := []struct {
+		name     string
+		filter   Expression
+		expected []string
+	}{
+		{
+			name:     "or of indexed conditions",
+			filter:   Or(Match(Condition{Field: "Name", Value: "Bob"}), Match(Condition{Field: "Email", Value: "charlie@example.com"})),
+			expected: []string{"2", "4"},
+		},
+		{
+			name:     "not of indexed condition",
+			filter:   Not(Match(Condition{Field: "Name", Value: "Alice"})),
+			expected: []string{"2", "4"},
+		},
+		{
+			name:     "or with int condition",
+			filter:   Or(Match(Condition{Field: "Name", Value: "Bob"}), Match(Condition{Field: "Age", Value: 35, Operator: GreaterThanOrEqual})),
+			expected: []string{"2", "3", "4"},
+		},
+		{
+			name: "nested groups",
+			filter: And(
+				Or(Match(Condition{Field: "Name", Value: "Alice"}), Match(Condition{Field: "Name", Value: "Charlie"})),
+				Not(Match(Condition{Field: "Age", Value: 35})),
+			),
+			expected: []string{"1", "4"},
+		},
+		{
+			name:     "not of int condition",
+			filter:   Not(Match(Condition{Field: "Age", Value: 30, Operator: LessThanOrEqual})),
+			expected: []string{"3", "4"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			results, err := store.GetQuery(context.Background(), &Query{Filter: test.filter})
+			if err != nil {
+				t.Fatalf("Failed to query: %v", err)
+			}
+			expectUserKeys(t, results, test.expected)
+
+			count, err := store.CountQuery(context.Background(), &Query{Filter: test.filter})
+			if err != nil {
+				t.Fatalf("Failed to count: %v", err)
+			}
+			if count != len(test.expected) {
+				t.Fatalf("Expected count %d, got %d", len(test.expected), count)
+			}
+		})
+	}
+
+	// Conditions are ANDed with the filter
+	count, err := store.CountQuery(context.Background(), &Query{
+		Conditions: []Condition{{Field: "Name", Value: "Alice"}},
+		Filter:     Or(Match(Condition{Field: "Age", Value: 30}), Match(Condition{Field: "Name", Value: "Bob"})),
+	})
+	if err != nil {
+		t.Fatalf("Failed to count: %v", err)
+	}
+	if count != 1 {
+		t.Fatalf("Expected count 1, got %d", count)
+	}
+}
+
+func TestDeleteQueryFilter(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	store, err := NewStore[TestUser](db, "users")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	users := []TestUser{
+		{UUID: "1", Name: "Alice", Email: "alice@example.com", Age: 30},
+		{UUID: "2", Name: "Bob", Email: "bob@example.com", Age: 25},
+		{UUID: "3", Name: "Charlie", Email: "charlie@example.com", Age: 35},
+	}
+	if err := store.PutBatch(context.Background(), users); err != nil {
+		t.Fatalf("Failed to put batch: %v", err)
+	}
+	db.Flush()
+
+	deleted, err := store.DeleteQuery(context.Background(), &Query{
+		Filter: Or(Match(Condition{Field: "Name", Value: "Alice"}), Match(Condition{Field: "Age", Value: 35})),
+	})
+	if err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	if deleted != 2 {
+		t.Fatalf("Expected 2 deleted, got %d", deleted)
+	}
+	if _, err := store.Get(context.Background(), "2"); err != nil {
+		t.Fatalf("Expected Bob to remain: %v", err)
+	}
+	for _, key := range []string{"1", "3"} {
+		if _, err := store.Get(context.Background(), key); err == nil {
+			t.Fatalf("Expected %s to be deleted", key)
+		}
+	}
+}
+
+func TestQueryFilterValidation(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	store, err := NewStore[TestUser](db, "users")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	filters := []Expression{
+		Or(Match(Condition{Field: "Missing", Value: "x"})),
+		And(Match(Condition{Field: "Name", Value: "Alice"}), Expression{}),
+		Not(Match(Condition{Field: "Name", Value: 1.5})),
+		{Condition: &Condition{Field: "Name", Value: "Alice"}, Or: []Expression{Match(Condition{Field: "Name", Value: "Bob"})}},
+	}
+	for _, filter := range filters {
+		if _, err := store.GetQuery(context.Background(), &Query{Filter: filter}); !errors.As(err, &InvalidQueryError{}) {
+			t.Errorf("Expected InvalidQueryError for %+v, got %v", filter, err)
+		}
+	}
+}
+
+// expectUserKeys fails the test unless results hold exactly the expected keys
+func expectUserKeys(t *testing.T, results []TestUser, expected []string) {
+	t.Helper()
+	found := make(map[string]bool)
+	for _, result := range results {
+		found[result.UUID] = true
+	}
+	if len(found) != len(expected) || len(results) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, results)
+	}
+	for _, key := range expected {
+		if !found[key] {
+			t.Fatalf("Expected %v, got %v", expected, results)
+		}
+	}
+}
+
+func TestQuerySetOperators(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	store, err := NewStore[TestUser](db, "users")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	users := []TestUser{
+		{UUID: "1", Name: "Alice", Email: "alice@example.com", Age: 30},
+		{UUID: "2", Name: "Bob", Email: "bob@example.com", Age: 25},
+		{UUID: "3", Name: "Charlie", Email: "charlie@example.com", Age: 40},
+		{UUID: "4", Name: "David", Email: "david@example.com", Age: 35},
+		{UUID: "5", Email: "anonymous@example.com", Age: 20},
+	}
+	if err := store.PutBatch(context.Background(), users); err != nil {
+		t.Fatalf("Failed to put batch: %v", err)
+	}
+	db.Flush()
+
+	tests := []struct {
+		name      string
+		condition Condition
+		expected  []string
+	}{
+		{"in indexed", Condition{Field: "Name", Value: []string{"Alice", "David", "Eve"}, Operator: In}, []string{"1", "4"}},
+		{"in int", Condition{Field: "Age", Value: []int{25, 40}, Operator: In}, []string{"2", "3"}},
+		{"in mixed values", Condition{Field: "Age", Value: []interface{}{25, int64(40)}, Operator: In}, []string{"2", "3"}},
+		{"not equals indexed", Condition{Field: "Name", Value: "Alice", Operator: NotEquals}, []string{"2", "3", "4", "5"}},
+		{"not equals int", Condition{Field: "Age", Value: 30, Operator: NotEquals}, []string{"2", "3", "4", "5"}},
+		{"between indexed", Condition{Field: "Name", Value: []string{"Bob", "David"}, Operator: Between}, []string{"2", "3", "4"}},
+		{"between int", Condition{Field: "Age", Value: []int{25, 35}, Operator: Between}, []string{"1", "2", "4"}},
+		{"between reversed", Condition{Field: "Name", Value: []string{"David", "Bob"}, Operator: Between}, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			results, err := store.GetQuery(context.Background(), &Query{Conditions: []Condition{test.condition}})
+			if err != nil {
+				t.Fatalf("Failed to query: %v", err)
+			}
+			expectUserKeys(t, results, test.expected)
+
+			// The same condition evaluated on decoded records
+			results, err = store.GetQuery(context.Background(), &Query{Filter: Or(Match(test.condition), Match(Condition{Field: "UUID", Value: "none"}))})
+			if err != nil {
+				t.Fatalf("Failed to query: %v", err)
+			}
+			expectUserKeys(t, results, test.expected)
+		})
+	}
+
+	invalid := []Condition{
+		{Field: "Name", Value: "Alice", Operator: In},
+		{Field: "Name", Value: []float64{1.5}, Operator: In},
+		{Field: "Name", Value: []string{"Alice"}, Operator: Between},
+		{Field: "Name", Value: []string{"Alice"}, Operator: Equals},
+	}
+	for _, condition := range invalid {
+		if _, err := store.GetQuery(context.Background(), &Query{Conditions: []Condition{condition}}); !errors.As(err, &InvalidQueryError{}) {
+			t.Errorf("Expected InvalidQueryError for %+v, got %v", condition, err)
+		}
+	}
+}
+
+func TestQueryPrefix(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	store, err := NewStore[TestUser](db, "users")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	users := []TestUser{
+		{UUID: "1", Name: "John", Email: "john@example.com", Age: 30},
+		{UUID: "2", Name: "Joanna", Email: "joanna@example.org", Age: 25},
+		{UUID: "3", Name: "Jo", Email: "jo@example.com", Age: 40},
+		{UUID: "4", Name: "Bob", Email: "bob@example.org", Age: 35},
+	}
+	if err := store.PutBatch(context.Background(), users); err != nil {
+		t.Fatalf("Failed to put batch: %v", err)
+	}
+	db.Flush()
+
+	tests := []struct {
+		name      string
+		condition Condition
+		expected  []string
+	}{
+		{"prefix", Condition{Field: "Name", Value: "Jo", Operator: HasPrefix}, []string{"1", "2", "3"}},
+		{"longer prefix", Condition{Field: "Name", Value: "Joh", Operator: HasPrefix}, []string{"1"}},
+		{"no match", Condition{Field: "Name", Value: "Z", Operator: HasPrefix}, nil},
+		{"wildcard", Condition{Field: "Name", Value: "Joa*", Operator: Wildcard}, []string{"2"}},
+		{"wildcard without star", Condition{Field: "Name", Value: "Jo", Operator: Wildcard}, []string{"3"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			results, err := store.GetQuery(context.Background(), &Query{Conditions: []Condition{test.condition}})
+			if err != nil {
+				t.Fatalf("Failed to query: %v", err)
+			}
+			expectUserKeys(t, results, test.expected)
+
+			// The same condition evaluated on decoded records
+			results, err = store.GetQuery(context.Background(), &Query{Filter: Or(Match(test.condition), Match(Condition{Field: "UUID", Value: "none"}))})
+			if err != nil {
+				t.Fatalf("Failed to query: %v", err)
+			}
+			expectUserKeys(t, results, test.expected)
+		})
+	}
+
+	// Limit stops the index walk early
+	results, err := store.GetQuery(context.Background(), &Query{
+		Conditions: []Condition{{Field: "Name", Value: "Jo", Operator: HasPrefix}},
+		Limit:      2,
+	})
+	if err != nil {
+		t.Fatalf("Failed to query: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 results, got %v", results)
+	}
+
+	invalid := []Condition{
+		{Field: "Name", Value: 1, Operator: HasPrefix},
+		{Field: "Age", Value: "3", Operator: HasPrefix},
+		{Field: "Name", Value: "J*n*", Operator: Wildcard},
+	}
+	for _, condition := range invalid {
+		if _, err := store.GetQuery(context.Background(), &Query{Conditions: []Condition{condition}}); !errors.As(err, &InvalidQueryError{}) {
+			t.Errorf("Expected InvalidQueryError for %+v, got %v", condition, err)
+		}
+	}
+}
+
+func TestQueryIntIndex(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	store, err := NewStore[TestUser](db, "users")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	users := []TestUser{
+		{UUID: "1", Name: "Alice", Age: 9},
+		{UUID: "2", Name: "Bob", Age: 10},
+		{UUID: "3", Name: "Charlie", Age: -5},
+		{UUID: "4", Name: "David", Age: 0},
+		{UUID: "5", Name: "Eve", Age: 100},
+	}
+	if err := store.PutBatch(context.Background(), users); err != nil {
+		t.Fatalf("Failed to put batch: %v", err)
+	}
+	db.Flush()
+
+	// Index order is numeric, not lexicographic
+	keys := store.indexes["Age"].getAllKeys()
+	expected := []string{"3", "4", "1", "2", "5"}
+	for i, key := range expected {
+		if i >= len(keys) || keys[i] != key {
+			t.Fatalf("Expected index order %v, got %v", expected, keys)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		condition Condition
+		expected  []string
+	}{
+		{"equals zero", Condition{Field: "Age", Value: 0}, []string{"4"}},
+		{"equals negative", Condition{Field: "Age", Value: -5}, []string{"3"}},
+		{"greater than", Condition{Field: "Age", Value: 9, Operator: GreaterThan}, []string{"2", "5"}},
+		{"less than", Condition{Field: "Age", Value: 10, Operator: LessThan}, []string{"1", "3", "4"}},
+		{"between", Condition{Field: "Age", Value: []int{-10, 9}, Operator: Between}, []string{"1", "3", "4"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if !store.isIndexedCondition(test.condition) {
+				t.Fatal("Expected int condition to use the index")
+			}
+			results, err := store.GetQuery(context.Background(), &Query{Conditions: []Condition{test.condition}})
+			if err != nil {
+				t.Fatalf("Failed to query: %v", err)
+			}
+			expectUserKeys(t, results, test.expected)
+		})
+	}
+
+	// Sorting by an int index is numeric
+	results, err := store.GetQuery(context.Background(), &Query{
+		Conditions: []Condition{{Field: "Age", Value: -100, Operator: GreaterThan}},
+		Index:      "Age",
+		Sort:       Descending,
+	})
+	if err != nil {
+		t.Fatalf("Failed to query: %v", err)
+	}
+	expectedAges := []int{100, 10, 9, 0, -5}
+	for i, age := range expectedAges {
+		if i >= len(results) || results[i].Age != age {
+			t.Fatalf("Expected ages %v, got %v", expectedAges, results)
+		}
+	}
+}
+
+func TestIntIndexRebuiltWhenPersistedEmpty(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	store, err := NewStore[TestUser](db, "users")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	if err := store.Put(context.Background(), TestUser{UUID: "1", Name: "Alice", Age: 30}); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	// Persist the Age index empty like older versions did
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	data, err := newBTree(32).serialize()
+	if err != nil {
+		t.Fatalf("Failed to serialize: %v", err)
+	}
+	err = db.DB.Update(func(transaction *bbolt.Tx) error {
+		return transaction.Bucket([]byte(btreeBucketName)).Put([]byte(buildBTreeKey("users:", "Age")), data)
+	})
+	if err != nil {
+		t.Fatalf("Failed to write index: %v", err)
+	}
+	crashDB(db)
+
+	db2, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to reopen DB: %v", err)
+	}
+	defer db2.Close()
+	store2, err := NewStore[TestUser](db2, "users")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	if keys := store2.indexes["Age"].search(encodeIndexInt(30)); len(keys) != 1 {
+		t.Fatalf("Expected Age index to be rebuilt, got %v", keys)
+	}
+}
+
+// TestProduct for testing index types other than string and int
+type TestProduct struct {
+	SKU      string    `nnut:"key"`
+	Price    float64   `nnut:"index"`
+	InStock  bool      `nnut:"index"`
+	Quantity uint      `nnut:"index"`
+	Views    int64     `nnut:"index"`
+	Added    time.Time `nnut:"index"`
+}
+
+func TestQueryIndexTypes(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	store, err := NewStore[TestProduct](db, "products")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	products := []TestProduct{
+		{SKU: "a", Price: 9.99, InStock: true, Quantity: 5, Views: -1, Added: base},
+		{SKU: "b", Price: 19.5, InStock: false, Quantity: 0, Views: 100, Added: base.Add(24 * time.Hour)},
+		{SKU: "c", Price: 2, InStock: true, Quantity: 12, Views: 40, Added: base.Add(-24 * time.Hour)},
+	}
+	if err := store.PutBatch(context.Background(), products); err != nil {
+		t.Fatalf("Failed to put batch: %v", err)
+	}
+	db.Flush()
+
+	tests := []struct {
+		name      string
+		condition Condition
+		expected  []string
+	}{
+		{"float range", Condition{Field: "Price", Value: 10, Operator: LessThan}, []string{"a", "c"}},
+		{"float between", Condition{Field: "Price", Value: []float64{2, 9.99}, Operator: Between}, []string{"a", "c"}},
+		{"bool", Condition{Field: "InStock", Value: false}, []string{"b"}},
+		{"uint", Condition{Field: "Quantity", Value: 5, Operator: GreaterThanOrEqual}, []string{"a", "c"}},
+		{"int64", Condition{Field: "Views", Value: int64(0), Operator: GreaterThan}, []string{"b", "c"}},
+		{"time", Condition{Field: "Added", Value: base, Operator: GreaterThanOrEqual}, []string{"a", "b"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if !store.isIndexedCondition(test.condition) {
+				t.Fatal("Expected condition to use the index")
+			}
+			keys := make(map[string]bool)
+			check := func(results []TestProduct) {
+				t.Helper()
+				for key := range keys {
+					delete(keys, key)
+				}
+				for _, result := range results {
+					keys[result.SKU] = true
+				}
+				if len(keys) != len(test.expected) || len(results) != len(test.expected) {
+					t.Fatalf("Expected %v, got %v", test.expected, results)
+				}
+				for _, key := range test.expected {
+					if !keys[key] {
+						t.Fatalf("Expected %v, got %v", test.expected, results)
+					}
+				}
+			}
+			results, err := store.GetQuery(context.Background(), &Query{Conditions: []Condition{test.condition}})
+			if err != nil {
+				t.Fatalf("Failed to query: %v", err)
+			}
+			check(results)
+
+			// The same condition evaluated on decoded records
+			results, err = store.GetQuery(context.Background(), &Query{Filter: Or(Match(test.condition), Match(Condition{Field: "SKU", Value: "none"}))})
+			if err != nil {
+				t.Fatalf("Failed to query: %v", err)
+			}
+			check(results)
+		})
+	}
+
+	// Sorting follows the order of the values
+	results, err := store.GetQuery(context.Background(), &Query{
+		Conditions: []Condition{{Field: "Price", Value: 0, Operator: GreaterThan}},
+		Index:      "Price",
+		Sort:       Ascending,
+	})
+	if err != nil {
+		t.Fatalf("Failed to query: %v", err)
+	}
+	if len(results) != 3 || results[0].SKU != "c" || results[1].SKU != "a" || results[2].SKU != "b" {
+		t.Fatalf("Expected products sorted by price, got %v", results)
+	}
+
+	// Negative zero is found by the index like by a scan
+	if err := store.Put(context.Background(), TestProduct{SKU: "d", Price: math.Copysign(0, -1), InStock: true}); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	zero := Condition{Field: "Price", Value: 0.0}
+	for _, query := range []*Query{{Conditions: []Condition{zero}}, {Filter: Or(Match(zero), Match(Condition{Field: "SKU", Value: "none"}))}} {
+		results, err := store.GetQuery(context.Background(), query)
+		if err != nil || len(results) != 1 || results[0].SKU != "d" {
+			t.Fatalf("Expected d for %+v, got %v (%v)", query, results, err)
+		}
+	}
+
+	// Values that cannot be ordered with the field type are rejected
+	invalid := []Condition{
+		{Field: "Price", Value: "cheap"},
+		{Field: "Quantity", Value: -1},
+		{Field: "Added", Value: "2024-01-01"},
+	}
+	for _, condition := range invalid {
+		if _, err := store.GetQuery(context.Background(), &Query{Conditions: []Condition{condition}}); !errors.As(err, &InvalidQueryError{}) {
+			t.Errorf("Expected InvalidQueryError for %+v, got %v", condition, err)
+		}
+	}
+}
+
+// TestArticle for testing indexes on slice fields
+type TestArticle struct {
+	ID      string   `nnut:"key"`
+	Tags    []string `nnut:"index"`
+	Ratings []int    `nnut:"index"`
+	Authors []string
+}
+
+func TestQueryContains(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	store, err := NewStore[TestArticle](db, "articles")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	ctx := context.Background()
+	articles := []TestArticle{
+		{ID: "a", Tags: []string{"go", "db", "go"}, Ratings: []int{5, -1}, Authors: []string{"ann"}},
+		{ID: "b", Tags: []string{"go", ""}, Ratings: []int{3}, Authors: []string{"bob", "ann"}},
+		{ID: "c"},
+	}
+	if err := store.PutBatch(ctx, articles); err != nil {
+		t.Fatalf("Failed to put batch: %v", err)
+	}
+	db.Flush()
+
+	// One entry per distinct non-empty element
+	if count := store.indexes["Tags"].countKeys(); count != 3 {
+		t.Fatalf("Expected 3 tag index entries, got %d", count)
+	}
+
+	tests := []struct {
+		name     string
+		query    *Query
+		expected []string
+	}{
+		{"indexed", &Query{Conditions: []Condition{{Field: "Tags", Value: "go", Operator: Contains}}}, []string{"a", "b"}},
+		{"indexed single", &Query{Conditions: []Condition{{Field: "Tags", Value: "db", Operator: Contains}}}, []string{"a"}},
+		{"indexed int", &Query{Conditions: []Condition{{Field: "Ratings", Value: int64(-1), Operator: Contains}}}, []string{"a"}},
+		{"scanned", &Query{Conditions: []Condition{{Field: "Authors", Value: "ann", Operator: Contains}}}, []string{"a", "b"}},
+		{"combined", &Query{Conditions: []Condition{{Field: "Tags", Value: "go", Operator: Contains}, {Field: "Authors", Value: "bob", Operator: Contains}}}, []string{"b"}},
+		{"not", &Query{Filter: Not(Match(Condition{Field: "Tags", Value: "db", Operator: Contains}))}, []string{"b", "c"}},
+		{"no match", &Query{Conditions: []Condition{{Field: "Tags", Value: "rust", Operator: Contains}}}, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			results, err := store.GetQuery(ctx, test.query)
+			if err != nil {
+				t.Fatalf("Failed to query: %v", err)
+			}
+			keys := make(map[string]bool)
+			for _, result := range results {
+				keys[result.ID] = true
+			}
+			if len(keys) != len(test.expected) || len(results) != len(test.expected) {
+				t.Fatalf("Expected %v, got %v", test.expected, results)
+			}
+			for _, key := range test.expected {
+				if !keys[key] {
+					t.Fatalf("Expected %v, got %v", test.expected, results)
+				}
+			}
+		})
+	}
+
+	invalid := []*Query{
+		{Conditions: []Condition{{Field: "Tags", Value: "go"}}},
+		{Conditions: []Condition{{Field: "Tags", Value: 1, Operator: Contains}}},
+		{Conditions: []Condition{{Field: "ID", Value: "a", Operator: Contains}}},
+		{Index: "Tags"},
+	}
+	for _, query := range invalid {
+		if _, err := store.GetQuery(ctx, query); !errors.As(err, &InvalidQueryError{}) {
+			t.Errorf("Expected InvalidQueryError for %+v, got %v", query, err)
+		}
+	}
+}
+
+func TestMultiValueIndexMaintenance(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	store, err := NewStore[TestArticle](db, "articles")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	ctx := context.Background()
+	expectTags := func(tag string, expected ...string) {
+		t.Helper()
+		keys := store.indexes["Tags"].search(tag)
+		sort.Strings(keys)
+		if fmt.Sprint(keys) != fmt.Sprint(expected) {
+			t.Fatalf("Expected %s to be indexed for %v, got %v", tag, expected, keys)
+		}
+	}
+
+	if err := store.Put(ctx, TestArticle{ID: "a", Tags: []string{"go", "db"}}); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if err := store.Put(ctx, TestArticle{ID: "b", Tags: []string{"go"}}); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+
+	// Put only replaces the elements that changed
+	if err := store.Put(ctx, TestArticle{ID: "a", Tags: []string{"db", "rust"}}); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	expectTags("go", "b")
+	expectTags("db", "a")
+	expectTags("rust", "a")
+
+	err = store.PutBatch(ctx, []TestArticle{
+		{ID: "a", Tags: []string{"rust"}},
+		{ID: "b", Tags: []string{"go", "rust"}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to put batch: %v", err)
+	}
+	expectTags("db")
+	expectTags("go", "b")
+	expectTags("rust", "a", "b")
+
+	if err := store.Delete(ctx, "a"); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	expectTags("rust", "b")
+	if err := store.DeleteBatch(ctx, []string{"b"}); err != nil {
+		t.Fatalf("Failed to delete batch: %v", err)
+	}
+	expectTags("go")
+	expectTags("rust")
+
+	if err := store.Put(ctx, TestArticle{ID: "c", Tags: []string{"go", "db"}}); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	if err := store.rebuildIndexes(); err != nil {
+		t.Fatalf("Failed to rebuild indexes: %v", err)
+	}
+	expectTags("go", "c")
+	expectTags("db", "c")
+	if count := store.indexes["Tags"].countKeys(); count != 2 {
+		t.Fatalf("Expected 2 tag index entries after rebuild, got %d", count)
+	}
+}
+
+// TestAudit is embedded in TestCustomer, promoting its fields
+type TestAudit struct {
+	CreatedBy string `nnut:"index"`
+}
+
+// TestAddress for testing nested struct fields
+type TestAddress struct {
+	City string `nnut:"index"`
+	Zip  int
+}
+
+// TestCustomer for testing nested, embedded and pointer struct fields
+type TestCustomer struct {
+	TestAudit
+	ID      string `nnut:"key"`
+	Name    string
+	Address TestAddress
+	Billing *TestAddress
+}
+
+func TestQueryNestedFields(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+
+	store, err := NewStore[TestCustomer](db, "customers")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	for _, indexName := range []string{"CreatedBy", "Address.City", "Billing.City"} {
+		if _, indexed := store.indexFields[indexName]; !indexed {
+			t.Fatalf("Expected an index on %s, got %v", indexName, store.indexFields)
+		}
+	}
+	ctx := context.Background()
+	customers := []TestCustomer{
+		{TestAudit: TestAudit{CreatedBy: "ann"}, ID: "a", Address: TestAddress{City: "Oslo", Zip: 150}, Billing: &TestAddress{City: "Bergen", Zip: 5003}},
+		{TestAudit: TestAudit{CreatedBy: "bob"}, ID: "b", Address: TestAddress{City: "Bergen", Zip: 5004}},
+		{TestAudit: TestAudit{CreatedBy: "ann"}, ID: "c", Address: TestAddress{City: "Oslo", Zip: 151}, Billing: &TestAddress{City: "Oslo", Zip: 152}},
+	}
+	if err := store.PutBatch(ctx, customers); err != nil {
+		t.Fatalf("Failed to put batch: %v", err)
+	}
+	db.Flush()
+
+	// Records with a nil pointer on the path are not indexed
+	if count := store.indexes["Billing.City"].countKeys(); count != 2 {
+		t.Fatalf("Expected 2 billing city index entries, got %d", count)
+	}
+
+	tests := []struct {
+		name     string
+		query    *Query
+		expected []string
+	}{
+		{"nested indexed", &Query{Conditions: []Condition{{Field: "Address.City", Value: "Oslo"}}}, []string{"a", "c"}},
+		{"nested scanned", &Query{Conditions: []Condition{{Field: "Address.Zip", Value: 151, Operator: LessThanOrEqual}}}, []string{"a", "c"}},
+		{"embedded", &Query{Conditions: []Condition{{Field: "CreatedBy", Value: "ann"}}}, []string{"a", "c"}},
+		{"pointer", &Query{Conditions: []Condition{{Field: "Billing.City", Value: "Bergen"}}}, []string{"a"}},
+		{"pointer scanned", &Query{Conditions: []Condition{{Field: "Billing.Zip", Value: 5000, Operator: GreaterThan}}}, []string{"a"}},
+		{"nil pointer", &Query{Conditions: []Condition{{Field: "Billing.City", Value: "Bergen", Operator: NotEquals}}}, []string{"b", "c"}},
+		{"prefix", &Query{Conditions: []Condition{{Field: "Address.City", Value: "Os", Operator: HasPrefix}}}, []string{"a", "c"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			results, err := store.GetQuery(ctx, test.query)
+			if err != nil {
+				t.Fatalf("Failed to query: %v", err)
+			}
+			keys := make([]string, len(results))
+			for i, result := range results {
+				keys[i] = result.ID
+			}
+			sort.Strings(keys)
+			if fmt.Sprint(keys) != fmt.Sprint(test.expected) {
+				t.Fatalf("Expected %v, got %v", test.expected, keys)
+			}
+		})
+	}
+
+	// Sorting by a nested index
+	results, err := store.GetQuery(ctx, &Query{Index: "Address.City", Sort: Descending})
+	if err != nil {
+		t.Fatalf("Failed to query: %v", err)
+	}
+	if len(results) != 3 || results[0].Address.City != "Oslo" || results[2].Address.City != "Bergen" {
+		t.Fatalf("Expected results sorted by city descending, got %v", results)
+	}
+
+	invalid := []*Query{
+		{Conditions: []Condition{{Field: "Address", Value: "Oslo"}}},
+		{Conditions: []Condition{{Field: "Address.Street", Value: "Main"}}},
+		{Index: "Address.Zip"},
+	}
+	for _, query := range invalid {
+		if _, err := store.GetQuery(ctx, query); !errors.As(err, &InvalidQueryError{}) {
+			t.Errorf("Expected InvalidQueryError for %+v, got %v", query, err)
+		}
+	}
+
+	// Nested indexes are persisted and loaded on reopen
+	if err := db.Close(); err != nil {
+		t.Fatalf("Failed to close DB: %v", err)
+	}
+	db, err = Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to reopen DB: %v", err)
+	}
+	defer db.Close()
+	store, err = NewStore[TestCustomer](db, "customers")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	if keys := store.indexes["Address.City"].search("Oslo"); len(keys) != 2 {
+		t.Fatalf("Expected 2 records in Oslo after reopen, got %v", keys)
+	}
+}
+
+func TestNestedFieldDefinition(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	// Recursive types are walked once, and outer fields hide promoted fields of the same name
+	type node struct {
+		ID    string `nnut:"key"`
+		Label string `nnut:"index"`
+		Next  *node
+		TestAudit
+		CreatedBy int
+	}
+	store, err := NewStore[node](db, "nodes")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	if _, exists := store.fieldMap["Next.Label"]; exists {
+		t.Fatal("Expected the recursive field not to be walked")
+	}
+	if _, indexed := store.indexFields["CreatedBy"]; indexed {
+		t.Fatal("Expected the outer CreatedBy field to hide the promoted one")
+	}
+
+	type nestedUnsupported struct {
+		ID      string `nnut:"key"`
+		Address struct {
+			Lines map[string]string `nnut:"index"`
+		}
+	}
+	var fieldTypeErr IndexFieldTypeError
+	if _, err := NewStore[nestedUnsupported](db, "unsupported"); !errors.As(err, &fieldTypeErr) || fieldTypeErr.FieldName != "Address.Lines" {
+		t.Errorf("Expected IndexFieldTypeError for Address.Lines, got %v", err)
+	}
+}
@@ -0,0 +1,71 @@
+package nnut
+
+import (
+	"go.etcd.io/bbolt"
+)
+
+// WithSnapshot returns a read-only view of the store as of the given snapshot.
+// Get, GetBatch, GetQuery, Has, Count and CountQuery on the returned store read the snapshot,
+// all writes fail with a ReadOnlyStoreError.
+func (s *Store[T]) WithSnapshot(snapshot *Snapshot) *Store[T] {
+	indexes := make(map[string]*bTree, len(s.indexes))
+	snapshot.mutex.RLock()
+	for name := range s.indexes {
+		if index, exists := snapshot.indexes[s.indexKey(name)]; exists {
+			indexes[name] = index
+		} else {
+			// The store did not exist when the snapshot was taken
+			indexes[name] = newBTree(32)
+		}
+	}
+	snapshot.mutex.RUnlock()
+
+	return &Store[T]{
+		database:         s.database,
+		bucket:           s.bucket,
+		keyField:         s.keyField,
+		versionField:     s.versionField,
+		indexFields:      s.indexFields,
+		compositeIndexes: s.compositeIndexes,
+		partialIndexes:   s.partialIndexes,
+		foldFields:       s.foldFields,
+		fulltextFields:   s.fulltextFields,
+		fieldMap:         s.fieldMap,
+		encoders:         s.encoders,
+		multiValueFields: s.multiValueFields,
+		indexes:          indexes,
+		snapshot:         snapshot,
+	}
+}
+
+// view runs fn with a read transaction, the snapshot's one if the store is bound to a snapshot
+func (s *Store[T]) view(fn func(transaction *bbolt.Tx) error) error {
+	if s.snapshot != nil {
+		return s.snapshot.view(fn)
+	}
+	return s.database.View(fn)
+}
+
+// bufferedOperation returns the pending operation for a key as seen by the store
+func (s *Store[T]) bufferedOperation(key string) (operation, bool) {
+	if s.snapshot != nil {
+		return s.snapshot.bufferedOperation(s.bucket, key)
+	}
+	return s.database.getLatestBufferedOperation(s.bucket, key)
+}
+
+// bufferedOperationsForBucket returns the pending operations for the store's bucket as seen by the store
+func (s *Store[T]) bufferedOperationsForBucket() []operation {
+	if s.snapshot != nil {
+		return s.snapshot.bufferedOperationsForBucket(s.bucket)
+	}
+	return s.database.getBufferedOperationsForBucket(s.bucket)
+}
+
+// checkWritable rejects writes through a store bound to a snapshot
+func (s *Store[T]) checkWritable() error {
+	if s.snapshot != nil {
+		return ReadOnlyStoreError{Bucket: string(s.bucket)}
+	}
+	return nil
+}
@@ -2,8 +2,11 @@ package nnut
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 )
@@ -213,6 +216,43 @@ func TestDelete(t *testing.T) {
 	}
 }
 
+func TestDeleteAfterOverwrite(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	store, err := NewStore[TestUser](db, "users")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	// Overwriting a record must not add a second primary key entry
+	testUser := TestUser{UUID: "key1", Name: "John", Email: "john@example.com"}
+	for i := 0; i < 2; i++ {
+		err = store.Put(context.Background(), testUser)
+		if err != nil {
+			t.Fatalf("Failed to put: %v", err)
+		}
+	}
+	err = store.Delete(context.Background(), "key1")
+	if err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	db.Flush()
+
+	exists, err := store.Has(context.Background(), "key1")
+	if err != nil {
+		t.Fatalf("Failed to check existence: %v", err)
+	}
+	if exists {
+		t.Fatal("Expected record to be gone after delete")
+	}
+}
+
 func TestBatchOperations(t *testing.T) {
 	t.Parallel()
 	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
@@ -323,6 +363,38 @@ func TestBatchOperationsFlushed(t *testing.T) {
 	}
 }
 
+func TestReopenKeepsRecords(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+
+	// Indexes loaded on open must be the ones serialized on the next flush
+	for round := 0; round < 3; round++ {
+		db, err := Open(dbPath)
+		if err != nil {
+			t.Fatalf("Failed to open DB: %v", err)
+		}
+		store, err := NewStore[TestUser](db, "users")
+		if err != nil {
+			t.Fatalf("Failed to create store: %v", err)
+		}
+		key := fmt.Sprintf("user%d", round)
+		if err := store.Put(context.Background(), TestUser{UUID: key, Name: "John"}); err != nil {
+			t.Fatalf("Failed to put: %v", err)
+		}
+		for previous := 0; previous <= round; previous++ {
+			if _, err := store.Get(context.Background(), fmt.Sprintf("user%d", previous)); err != nil {
+				t.Fatalf("Expected user%d after %d reopens: %v", previous, round, err)
+			}
+		}
+		if keys := store.indexes["Name"].search("John"); len(keys) != round+1 {
+			t.Fatalf("Expected %d keys in Name index after %d reopens, got %v", round+1, round, keys)
+		}
+		if err := db.Close(); err != nil {
+			t.Fatalf("Failed to close DB: %v", err)
+		}
+	}
+}
+
 func TestBufferAwareReading(t *testing.T) {
 	t.Parallel()
 	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
@@ -423,3 +495,500 @@ func TestBufferDeduplication(t *testing.T) {
 		t.Fatalf("Expected latest version, got %s", retrieved.Name)
 	}
 }
+
+// TestVersionedUser for testing optimistic concurrency
+type TestVersionedUser struct {
+	UUID    string `nnut:"key"`
+	Name    string `nnut:"index"`
+	Version int64  `nnut:"version"`
+}
+
+func TestVersionField(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	store, err := NewStore[TestVersionedUser](db, "users")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	// Every put increments the stored version regardless of the version passed in
+	for i := 1; i <= 3; i++ {
+		err = store.Put(context.Background(), TestVersionedUser{UUID: "key1", Name: "John"})
+		if err != nil {
+			t.Fatalf("Failed to put: %v", err)
+		}
+		retrieved, err := store.Get(context.Background(), "key1")
+		if err != nil {
+			t.Fatalf("Failed to get: %v", err)
+		}
+		if retrieved.Version != int64(i) {
+			t.Fatalf("Expected version %d, got %d", i, retrieved.Version)
+		}
+	}
+
+	err = store.PutBatch(context.Background(), []TestVersionedUser{{UUID: "key1"}, {UUID: "key2"}})
+	if err != nil {
+		t.Fatalf("Failed to put batch: %v", err)
+	}
+	batch, err := store.GetBatch(context.Background(), []string{"key1", "key2"})
+	if err != nil {
+		t.Fatalf("Failed to get batch: %v", err)
+	}
+	if batch["key1"].Version != 4 || batch["key2"].Version != 1 {
+		t.Fatalf("Expected versions 4 and 1 after batch put, got %d and %d", batch["key1"].Version, batch["key2"].Version)
+	}
+
+	type InvalidVersion struct {
+		UUID    string `nnut:"key"`
+		Version string `nnut:"version"`
+	}
+	_, err = NewStore[InvalidVersion](db, "invalid")
+	if _, ok := err.(VersionFieldNotIntegerError); !ok {
+		t.Fatalf("Expected VersionFieldNotIntegerError, got %v", err)
+	}
+}
+
+func TestPutIfVersion(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	store, err := NewStore[TestVersionedUser](db, "users")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	// A missing record has version 0
+	err = store.PutIfVersion(context.Background(), TestVersionedUser{UUID: "key1", Name: "John", Version: 0})
+	if err != nil {
+		t.Fatalf("Failed to create with version 0: %v", err)
+	}
+
+	first, err := store.Get(context.Background(), "key1")
+	if err != nil {
+		t.Fatalf("Failed to get: %v", err)
+	}
+	second := first
+
+	first.Name = "Johnny"
+	err = store.PutIfVersion(context.Background(), first)
+	if err != nil {
+		t.Fatalf("Failed to put matching version: %v", err)
+	}
+
+	// The second writer read the same version and must lose, also against the buffered write
+	second.Name = "Jack"
+	err = store.PutIfVersion(context.Background(), second)
+	conflict, ok := err.(VersionConflictError)
+	if !ok {
+		t.Fatalf("Expected VersionConflictError, got %v", err)
+	}
+	if conflict.Expected != 1 || conflict.Actual != 2 {
+		t.Fatalf("Expected conflict between versions 1 and 2, got %+v", conflict)
+	}
+
+	db.Flush()
+	retrieved, err := store.Get(context.Background(), "key1")
+	if err != nil {
+		t.Fatalf("Failed to get: %v", err)
+	}
+	if retrieved.Name != "Johnny" || retrieved.Version != 2 {
+		t.Fatalf("Expected winning write at version 2, got %+v", retrieved)
+	}
+	if keys := store.indexes["Name"].search("Jack"); len(keys) != 0 {
+		t.Fatalf("Expected rejected write to leave indexes unchanged, got %v", keys)
+	}
+
+	// Types without a version field cannot use conditional puts
+	users, err := NewStore[TestUser](db, "plain")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	err = users.PutIfVersion(context.Background(), TestUser{UUID: "key1"})
+	if _, ok := err.(VersionFieldNotFoundError); !ok {
+		t.Fatalf("Expected VersionFieldNotFoundError, got %v", err)
+	}
+}
+
+func TestPutIfVersionConcurrent(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	store, err := NewStore[TestVersionedUser](db, "users")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	err = store.Put(context.Background(), TestVersionedUser{UUID: "key1", Name: "John"})
+	if err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+
+	// Writers racing from the same read: exactly one wins
+	const writers = 20
+	results := make(chan error, writers)
+	for i := 0; i < writers; i++ {
+		go func() {
+			results <- store.PutIfVersion(context.Background(), TestVersionedUser{UUID: "key1", Name: "John", Version: 1})
+		}()
+	}
+	succeeded := 0
+	for i := 0; i < writers; i++ {
+		err := <-results
+		if err == nil {
+			succeeded++
+		} else if _, ok := err.(VersionConflictError); !ok {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if succeeded != 1 {
+		t.Fatalf("Expected exactly one successful writer, got %d", succeeded)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	store, err := NewStore[TestUser](db, "users")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	// Updating a missing key fails without writing
+	err = store.Update(context.Background(), "key1", func(user *TestUser) error {
+		user.Name = "John"
+		return nil
+	})
+	if _, ok := err.(KeyNotFoundError); !ok {
+		t.Fatalf("Expected KeyNotFoundError, got %v", err)
+	}
+
+	// Upsert starts from the zero value with the key set
+	err = store.Upsert(context.Background(), "key1", func(user *TestUser) error {
+		if user.UUID != "key1" || user.Name != "" {
+			t.Errorf("Expected zero value with key, got %+v", user)
+		}
+		user.Name = "John"
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to upsert: %v", err)
+	}
+
+	// A failing mutator writes nothing
+	failure := errors.New("rejected")
+	err = store.Update(context.Background(), "key1", func(user *TestUser) error {
+		user.Name = "Jack"
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("Expected mutator error, got %v", err)
+	}
+
+	// Key changes are ignored
+	err = store.Update(context.Background(), "key1", func(user *TestUser) error {
+		user.UUID = "other"
+		user.Email = "john@example.com"
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to update: %v", err)
+	}
+
+	retrieved, err := store.Get(context.Background(), "key1")
+	if err != nil {
+		t.Fatalf("Failed to get: %v", err)
+	}
+	if retrieved != (TestUser{UUID: "key1", Name: "John", Email: "john@example.com"}) {
+		t.Fatalf("Unexpected record after updates: %+v", retrieved)
+	}
+	if _, err := store.Get(context.Background(), "other"); err == nil {
+		t.Fatal("Expected no record under the changed key")
+	}
+}
+
+func TestUpdateConcurrent(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	store, err := NewStore[TestUser](db, "users")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	// Concurrent read-modify-write cycles on one key neither lose updates nor leave stale index entries
+	const writers = 50
+	var waitGroup sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		waitGroup.Add(1)
+		go func(i int) {
+			defer waitGroup.Done()
+			err := store.Upsert(context.Background(), "key1", func(user *TestUser) error {
+				user.Age++
+				user.Name = fmt.Sprintf("Name %d", i)
+				return nil
+			})
+			if err != nil {
+				t.Errorf("Failed to upsert: %v", err)
+			}
+		}(i)
+	}
+	waitGroup.Wait()
+
+	retrieved, err := store.Get(context.Background(), "key1")
+	if err != nil {
+		t.Fatalf("Failed to get: %v", err)
+	}
+	if retrieved.Age != writers {
+		t.Fatalf("Expected %d updates, got %d", writers, retrieved.Age)
+	}
+	if count := store.indexes["Name"].countKeys(); count != 1 {
+		t.Fatalf("Expected a single Name index entry, got %d", count)
+	}
+	if keys := store.indexes["Name"].search(retrieved.Name); len(keys) != 1 || keys[0] != "key1" {
+		t.Fatalf("Expected Name index to point at the stored name, got %v", keys)
+	}
+}
+
+func TestBatchWritesLockKeys(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	store, err := NewStore[TestUser](db, "users")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	ctx := context.Background()
+	if err := store.PutBatch(ctx, []TestUser{{UUID: "key1", Name: "John"}, {UUID: "key2", Name: "Jane"}}); err != nil {
+		t.Fatalf("Failed to put batch: %v", err)
+	}
+
+	// Batch writes wait for a read-modify-write cycle holding one of their keys
+	writes := map[string]func() error{
+		"put batch": func() error {
+			return store.PutBatch(ctx, []TestUser{{UUID: "key1", Name: "Jack"}, {UUID: "key2", Name: "Jill"}})
+		},
+		"delete batch": func() error {
+			return store.DeleteBatch(ctx, []string{"key2"})
+		},
+		"delete query": func() error {
+			_, err := store.DeleteQuery(ctx, &Query{Conditions: []Condition{{Field: "Name", Value: "Jack"}}})
+			return err
+		},
+	}
+	for _, name := range []string{"put batch", "delete batch", "delete query"} {
+		unlock := store.lockKeys([]string{"key1", "key2"})
+		done := make(chan error, 1)
+		go func() {
+			done <- writes[name]()
+		}()
+		select {
+		case err := <-done:
+			unlock()
+			t.Fatalf("Expected %s to wait for the key lock, returned %v", name, err)
+		case <-time.After(50 * time.Millisecond):
+		}
+		unlock()
+		if err := <-done; err != nil {
+			t.Fatalf("Failed to %s: %v", name, err)
+		}
+	}
+
+	// Every write was applied in turn
+	if _, err := store.Get(ctx, "key1"); err == nil {
+		t.Fatal("Expected key1 to be deleted by the query")
+	}
+	if _, err := store.Get(ctx, "key2"); err == nil {
+		t.Fatal("Expected key2 to be deleted by the batch")
+	}
+	if count := store.indexes["Name"].countKeys(); count != 0 {
+		t.Fatalf("Expected no Name index entries, got %d", count)
+	}
+}
+
+func TestUpdateWritesOtherKeys(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	store, err := NewStore[TestUser](db, "users")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	ctx := context.Background()
+
+	// fn may write any other key while the updated key is locked
+	var others []string
+	for i := 0; i < 100; i++ {
+		others = append(others, fmt.Sprintf("k%d", i))
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- store.Upsert(ctx, "a", func(user *TestUser) error {
+			for _, key := range others {
+				if err := store.Put(ctx, TestUser{UUID: key, Name: "Other"}); err != nil {
+					return err
+				}
+			}
+			user.Name = "Updated"
+			return nil
+		})
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Failed to upsert: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the update to finish while fn writes other keys")
+	}
+	db.Flush()
+	if count, err := store.Count(ctx); err != nil || count != len(others)+1 {
+		t.Fatalf("Expected %d records, got %d (%v)", len(others)+1, count, err)
+	}
+}
+
+func TestInsertAndReplace(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	store, err := NewStore[TestUser](db, "users")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	err = store.Replace(context.Background(), TestUser{UUID: "key1", Name: "John"})
+	if _, ok := err.(KeyNotFoundError); !ok {
+		t.Fatalf("Expected KeyNotFoundError, got %v", err)
+	}
+	err = store.Insert(context.Background(), TestUser{UUID: "key1", Name: "John"})
+	if err != nil {
+		t.Fatalf("Failed to insert: %v", err)
+	}
+	err = store.Insert(context.Background(), TestUser{UUID: "key1", Name: "Jack"})
+	if _, ok := err.(AlreadyExistsError); !ok {
+		t.Fatalf("Expected AlreadyExistsError, got %v", err)
+	}
+	err = store.Replace(context.Background(), TestUser{UUID: "key1", Name: "Johnny"})
+	if err != nil {
+		t.Fatalf("Failed to replace: %v", err)
+	}
+
+	// Existence also holds after the buffer is flushed
+	db.Flush()
+	err = store.Insert(context.Background(), TestUser{UUID: "key1", Name: "Jack"})
+	if _, ok := err.(AlreadyExistsError); !ok {
+		t.Fatalf("Expected AlreadyExistsError after flush, got %v", err)
+	}
+	retrieved, err := store.Get(context.Background(), "key1")
+	if err != nil {
+		t.Fatalf("Failed to get: %v", err)
+	}
+	if retrieved.Name != "Johnny" {
+		t.Fatalf("Expected replaced record, got %+v", retrieved)
+	}
+
+	// A pending delete makes the key insertable again
+	err = store.Delete(context.Background(), "key1")
+	if err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	err = store.Replace(context.Background(), TestUser{UUID: "key1", Name: "Jack"})
+	if _, ok := err.(KeyNotFoundError); !ok {
+		t.Fatalf("Expected KeyNotFoundError after delete, got %v", err)
+	}
+	err = store.Insert(context.Background(), TestUser{UUID: "key1", Name: "Jack"})
+	if err != nil {
+		t.Fatalf("Failed to insert after delete: %v", err)
+	}
+}
+
+func TestInsertBatchAndReplaceBatch(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	store, err := NewStore[TestUser](db, "users")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	err = store.InsertBatch(context.Background(), []TestUser{{UUID: "key1", Name: "John"}, {UUID: "key2", Name: "Jane"}})
+	if err != nil {
+		t.Fatalf("Failed to insert batch: %v", err)
+	}
+
+	// A single conflicting key rejects the whole batch
+	err = store.InsertBatch(context.Background(), []TestUser{{UUID: "key3", Name: "Jack"}, {UUID: "key1", Name: "Jill"}})
+	if conflict, ok := err.(AlreadyExistsError); !ok || conflict.Key != "key1" {
+		t.Fatalf("Expected AlreadyExistsError for key1, got %v", err)
+	}
+	err = store.InsertBatch(context.Background(), []TestUser{{UUID: "key4", Name: "Jack"}, {UUID: "key4", Name: "Jill"}})
+	if _, ok := err.(AlreadyExistsError); !ok {
+		t.Fatalf("Expected AlreadyExistsError for duplicate key, got %v", err)
+	}
+	err = store.ReplaceBatch(context.Background(), []TestUser{{UUID: "key1", Name: "Johnny"}, {UUID: "key3", Name: "Jack"}})
+	if missing, ok := err.(KeyNotFoundError); !ok || missing.Key != "key3" {
+		t.Fatalf("Expected KeyNotFoundError for key3, got %v", err)
+	}
+	for _, key := range []string{"key3", "key4"} {
+		if exists, _ := store.Has(context.Background(), key); exists {
+			t.Fatalf("Expected rejected batch not to write %s", key)
+		}
+	}
+
+	err = store.ReplaceBatch(context.Background(), []TestUser{{UUID: "key1", Name: "Johnny"}, {UUID: "key2", Name: "Janet"}})
+	if err != nil {
+		t.Fatalf("Failed to replace batch: %v", err)
+	}
+	retrieved, err := store.GetBatch(context.Background(), []string{"key1", "key2"})
+	if err != nil {
+		t.Fatalf("Failed to get batch: %v", err)
+	}
+	if retrieved["key1"].Name != "Johnny" || retrieved["key2"].Name != "Janet" {
+		t.Fatalf("Expected replaced records, got %v", retrieved)
+	}
+}
@@ -0,0 +1,82 @@
+package nnut
+
+import (
+	"reflect"
+	"sort"
+)
+
+// uniqueField identifies the field of a unique index a change belongs to, for reporting conflicts
+type uniqueField struct {
+	bucket string
+	field  string
+	value  interface{} // field value of the record the change is made for
+}
+
+// uniqueField returns the unique field details for a change to the named index, or nil if the index is not unique
+func (s *Store[T]) uniqueField(name string, value T) *uniqueField {
+	if !s.uniqueFields[name] {
+		return nil
+	}
+	return &uniqueField{
+		bucket: string(s.bucket),
+		field:  name,
+		value:  s.fieldValue(reflect.ValueOf(value), name).Interface(),
+	}
+}
+
+// hasUniqueChanges reports whether any of the changes is to a unique index
+func hasUniqueChanges(changes []indexChange) bool {
+	for _, change := range changes {
+		if change.unique != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// checkUniqueChanges returns a UniqueConstraintError if applying the changes would leave a value
+// of a unique index held by more than one record. Only the state after all changes counts,
+// so records can swap values within a batch or transaction.
+func checkUniqueChanges(changes []indexChange) error {
+	type entry struct {
+		index *bTree
+		value string
+	}
+	holders := make(map[entry]map[string]bool)
+	for _, change := range changes {
+		if change.unique == nil {
+			continue
+		}
+		current := entry{change.index, change.value}
+		keys, exists := holders[current]
+		if !exists {
+			keys = make(map[string]bool)
+			for _, key := range change.index.search(change.value) {
+				keys[key] = true
+			}
+			holders[current] = keys
+		}
+		if change.delete {
+			delete(keys, change.key)
+		} else {
+			keys[change.key] = true
+		}
+	}
+
+	for _, change := range changes {
+		if change.unique == nil || change.delete {
+			continue
+		}
+		var others []string
+		for key := range holders[entry{change.index, change.value}] {
+			if key != change.key {
+				others = append(others, key)
+			}
+		}
+		if len(others) > 0 {
+			sort.Strings(others)
+			return UniqueConstraintError{Bucket: change.unique.bucket, Field: change.unique.field, Value: change.unique.value, Key: others[0]}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package nnut
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// TestAccount for testing unique indexes
+type TestAccount struct {
+	ID    string `nnut:"key"`
+	Email string `nnut:"index,unique"`
+	Name  string
+}
+
+func newUniqueTestStore(t *testing.T) (*DB, *Store[TestAccount]) {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	store, err := NewStore[TestAccount](db, "accounts")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	return db, store
+}
+
+func expectUniqueConstraintError(t *testing.T, err error, value, key string) {
+	t.Helper()
+	var uniqueErr UniqueConstraintError
+	if !errors.As(err, &uniqueErr) {
+		t.Fatalf("Expected UniqueConstraintError, got %v", err)
+	}
+	if uniqueErr.Field != "Email" || uniqueErr.Value != value || uniqueErr.Key != key {
+		t.Fatalf("Expected conflict on %s with key %s, got %+v", value, key, uniqueErr)
+	}
+}
+
+func TestUniqueIndexPut(t *testing.T) {
+	t.Parallel()
+	_, store := newUniqueTestStore(t)
+	ctx := context.Background()
+
+	// The first record is only in the operations buffer
+	if err := store.Put(ctx, TestAccount{ID: "a", Email: "ann@example.com"}); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	err := store.Put(ctx, TestAccount{ID: "b", Email: "ann@example.com"})
+	expectUniqueConstraintError(t, err, "ann@example.com", "a")
+	if has, _ := store.Has(ctx, "b"); has {
+		t.Fatal("Expected rejected record not to be written")
+	}
+
+	// Rewriting a record with its own value is not a conflict
+	if err := store.Put(ctx, TestAccount{ID: "a", Email: "ann@example.com", Name: "Ann"}); err != nil {
+		t.Fatalf("Failed to rewrite record: %v", err)
+	}
+
+	// Records without a value do not hold one
+	for _, key := range []string{"c", "d"} {
+		if err := store.Put(ctx, TestAccount{ID: key}); err != nil {
+			t.Fatalf("Failed to put record without email: %v", err)
+		}
+	}
+
+	// Changing a value through Update is checked and frees the old value
+	err = store.Update(ctx, "c", func(account *TestAccount) error {
+		account.Email = "ann@example.com"
+		return nil
+	})
+	expectUniqueConstraintError(t, err, "ann@example.com", "a")
+	err = store.Update(ctx, "a", func(account *TestAccount) error {
+		account.Email = "annie@example.com"
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to update: %v", err)
+	}
+	if err := store.Insert(ctx, TestAccount{ID: "b", Email: "ann@example.com"}); err != nil {
+		t.Fatalf("Expected released value to be free: %v", err)
+	}
+
+	// Deleting a record frees its value
+	if err := store.Delete(ctx, "b"); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	if err := store.Put(ctx, TestAccount{ID: "e", Email: "ann@example.com"}); err != nil {
+		t.Fatalf("Expected deleted value to be free: %v", err)
+	}
+}
+
+func TestUniqueIndexPutBatch(t *testing.T) {
+	t.Parallel()
+	db, store := newUniqueTestStore(t)
+	ctx := context.Background()
+	if err := store.Put(ctx, TestAccount{ID: "a", Email: "ann@example.com"}); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if err := store.Put(ctx, TestAccount{ID: "b", Email: "bob@example.com"}); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+
+	err := store.PutBatch(ctx, []TestAccount{
+		{ID: "c", Email: "cid@example.com"},
+		{ID: "d", Email: "bob@example.com"},
+	})
+	expectUniqueConstraintError(t, err, "bob@example.com", "b")
+
+	err = store.PutBatch(ctx, []TestAccount{
+		{ID: "c", Email: "cid@example.com"},
+		{ID: "d", Email: "cid@example.com"},
+	})
+	expectUniqueConstraintError(t, err, "cid@example.com", "d")
+	if count, _ := store.Count(ctx); count != 2 {
+		t.Fatalf("Expected rejected batches not to write, got %d records", count)
+	}
+	if keys := store.indexes["Email"].search("cid@example.com"); len(keys) != 0 {
+		t.Fatalf("Expected rejected batches not to change the index, got %v", keys)
+	}
+
+	// Records can swap values within a batch
+	err = store.PutBatch(ctx, []TestAccount{
+		{ID: "a", Email: "bob@example.com"},
+		{ID: "b", Email: "ann@example.com"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to swap values: %v", err)
+	}
+	if account, err := store.Get(ctx, "a"); err != nil || account.Email != "bob@example.com" {
+		t.Fatalf("Expected a to hold bob@example.com, got %v (%v)", account, err)
+	}
+}
+
+func TestUniqueIndexTransaction(t *testing.T) {
+	t.Parallel()
+	db, store := newUniqueTestStore(t)
+	ctx := context.Background()
+	if err := store.Put(ctx, TestAccount{ID: "a", Email: "ann@example.com"}); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+
+	err := db.Update(ctx, func(tx *Tx) error {
+		if err := store.PutTx(tx, TestAccount{ID: "b", Email: "bob@example.com"}); err != nil {
+			return err
+		}
+		return store.PutTx(tx, TestAccount{ID: "c", Email: "ann@example.com"})
+	})
+	expectUniqueConstraintError(t, err, "ann@example.com", "a")
+	if has, _ := store.Has(ctx, "b"); has {
+		t.Fatal("Expected rejected transaction not to write")
+	}
+
+	// A value released earlier in the transaction can be taken
+	err = db.Update(ctx, func(tx *Tx) error {
+		if err := store.DeleteTx(tx, "a"); err != nil {
+			return err
+		}
+		return store.PutTx(tx, TestAccount{ID: "c", Email: "ann@example.com"})
+	})
+	if err != nil {
+		t.Fatalf("Failed to commit transaction: %v", err)
+	}
+	if account, err := store.Get(ctx, "c"); err != nil || account.Email != "ann@example.com" {
+		t.Fatalf("Expected c to hold ann@example.com, got %v (%v)", account, err)
+	}
+}
+
+func TestUniqueIndexConcurrentPuts(t *testing.T) {
+	t.Parallel()
+	_, store := newUniqueTestStore(t)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	errs := make([]error, 20)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = store.Put(ctx, TestAccount{ID: fmt.Sprintf("user%d", i), Email: "same@example.com"})
+		}(i)
+	}
+	wg.Wait()
+
+	succeeded := 0
+	for _, err := range errs {
+		if err == nil {
+			succeeded++
+		} else if !errors.As(err, &UniqueConstraintError{}) {
+			t.Fatalf("Expected UniqueConstraintError, got %v", err)
+		}
+	}
+	if succeeded != 1 {
+		t.Fatalf("Expected exactly one put to succeed, got %d", succeeded)
+	}
+	if keys := store.indexes["Email"].search("same@example.com"); len(keys) != 1 {
+		t.Fatalf("Expected one record to hold the value, got %v", keys)
+	}
+}
+
+func TestUniqueIndexDefinition(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), t.Name()+".db")
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	type uniqueWithoutIndex struct {
+		ID    string `nnut:"key"`
+		Email string `nnut:"unique"`
+	}
+	if _, err := NewStore[uniqueWithoutIndex](db, "accounts"); !errors.As(err, &IndexDefinitionError{}) {
+		t.Fatalf("Expected IndexDefinitionError, got %v", err)
+	}
+
+	type uniqueSlice struct {
+		ID     string   `nnut:"key"`
+		Emails []string `nnut:"index,unique"`
+	}
+	if _, err := NewStore[uniqueSlice](db, "accounts"); !errors.As(err, &IndexDefinitionError{}) {
+		t.Fatalf("Expected IndexDefinitionError for a unique slice field, got %v", err)
+	}
+}
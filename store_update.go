@@ -0,0 +1,71 @@
+package nnut
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Update atomically modifies the record stored under key.
+// The key is locked while the current record, including pending writes in the buffer, is passed to fn
+// and the result is written back. If fn returns an error nothing is written and the error is returned.
+// Returns a KeyNotFoundError if the key does not exist. Changes fn makes to the key field are ignored.
+// fn may read and write other keys, but writing the key being updated from fn deadlocks.
+func (s *Store[T]) Update(ctx context.Context, key string, fn func(value *T) error) error {
+	return s.update(ctx, key, fn, false)
+}
+
+// Upsert atomically modifies the record stored under key like Update.
+// If the key does not exist fn receives the zero value of T with only the key field set.
+func (s *Store[T]) Upsert(ctx context.Context, key string, fn func(value *T) error) error {
+	return s.update(ctx, key, fn, true)
+}
+
+// update runs a locked read-modify-write cycle on a single record
+func (s *Store[T]) update(ctx context.Context, key string, fn func(value *T) error, create bool) error {
+	if err := s.checkWritable(); err != nil {
+		return err
+	}
+
+	if err := validateKey(key); err != nil {
+		return err
+	}
+
+	s.database.Logger().Debugf("Updating record with key %s in bucket %s", key, s.bucket)
+	unlock := s.lockKey(key)
+	defer unlock()
+
+	oldValue, err := s.Get(ctx, key)
+	oldExists := err == nil
+	if err != nil {
+		if _, notFound := err.(KeyNotFoundError); !notFound || !create {
+			return err
+		}
+	}
+
+	// Mutate a deep copy so fn cannot change the old record the index changes are computed from
+	var value T
+	if oldExists {
+		data, err := msgpack.Marshal(oldValue)
+		if err != nil {
+			return WrappedError{Operation: "marshal", Bucket: string(s.bucket), Key: key, Err: err}
+		}
+		if err := msgpack.Unmarshal(data, &value); err != nil {
+			return WrappedError{Operation: "unmarshal", Bucket: string(s.bucket), Key: key, Err: err}
+		}
+	}
+	keyField := reflect.ValueOf(&value).Elem().Field(s.keyField)
+	keyField.SetString(key)
+	if err := fn(&value); err != nil {
+		return err
+	}
+	keyField.SetString(key)
+
+	dataOperation, indexChanges, modifiedIndexes, err := s.planPut(key, value, oldValue, oldExists)
+	if err != nil {
+		return err
+	}
+	ops := append([]operation{dataOperation}, indexMarkers(modifiedIndexes)...)
+	return s.database.writeWithIndexChanges(ctx, ops, indexChanges)
+}